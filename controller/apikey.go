@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/haran/biophonie-api/controller/apikey"
+	"github.com/haran/biophonie-api/controller/role"
+	"github.com/haran/biophonie-api/controller/user"
+	"github.com/haran/biophonie-api/database"
+)
+
+const (
+	apiKeyHeader = "X-Api-Key"
+	// a key cannot make more than its rate limit of requests during apiKeyWindow
+	apiKeyWindow           = time.Minute
+	defaultApiKeyRateLimit = 60
+	apiKeyPrefixLength     = 8
+)
+
+var errInvalidApiKey = errors.New("api key is not valid")
+
+// GetApiKeys godoc
+// @Summary list the api keys
+// @Description list the api keys with their scope and when they were last used, without the keys
+// @Accept json
+// @Produce json
+// @Tags Authentication
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {array} apikey.ApiKey
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/apikey [get]
+func (c *Controller) GetApiKeys(ctx *gin.Context) {
+	keys := make([]apikey.ApiKey, 0)
+	if err := c.Db.Select(&keys, database.GetApiKeys); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get api keys")
+		ctx.Abort()
+		return
+	}
+	for i := range keys {
+		keys[i].Key = ""
+	}
+
+	ctx.JSON(http.StatusOK, keys)
+}
+
+// CreateApiKey godoc
+// @Summary create an api key
+// @Description issue a key for the scripts of a partner, returned only once, acting as the user within the scope: read (favourites and playlists), upload (also creating geopoints) or moderation (also moderating, for a moderator), none of them reaches the sessions, the credentials or the api keys
+// @Accept json
+// @Produce json
+// @Tags Authentication
+// @Param apikey body apikey.AddApiKey true "name, user, scope and requests per minute of the key"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} apikey.ApiKey
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/apikey [post]
+func (c *Controller) CreateApiKey(ctx *gin.Context) {
+	addApiKey := apikey.AddApiKey{RateLimit: defaultApiKeyRateLimit}
+	if err := ctx.BindJSON(&addApiKey); err != nil {
+		return
+	}
+
+	var owner user.User
+	if err := c.Db.Get(&owner, database.GetUserById, addApiKey.UserId); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get user of api key")
+		ctx.Abort()
+		return
+	}
+
+	if addApiKey.Scope == apikey.Moderation && !role.Can(owner.Role, role.ModerateGeoPoints) {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("%s is not a moderator", owner.Name)).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	key, err := randomHex(32)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	var id int
+	if err := c.Db.Get(&id, database.PostApiKey, addApiKey.Name, owner.Id, addApiKey.Scope, hashToken(key), key[:apiKeyPrefixLength], addApiKey.RateLimit, ctx.GetInt("userId")); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not create api key")
+		ctx.Abort()
+		return
+	}
+
+	var created apikey.ApiKey
+	if err := c.Db.Get(&created, database.GetApiKey, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve created api key")
+		ctx.Abort()
+		return
+	}
+	created.Key = key
+
+	ctx.JSON(http.StatusOK, created)
+}
+
+// RevokeApiKey godoc
+// @Summary revoke an api key
+// @Description the key cannot be used anymore, it stays listed
+// @Accept json
+// @Produce json
+// @Tags Authentication
+// @Param id path int true "api key id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {string} string
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/apikey/{id} [delete]
+func (c *Controller) RevokeApiKey(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	result, err := c.Db.Exec(database.RevokeApiKey, id)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if rowsAffected != 1 {
+		ctx.AbortWithError(http.StatusNotFound, fmt.Errorf("not found")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "api key was revoked"})
+}
+
+// authorizeApiKey authorizes the request as the user of the key, within the scope and the rate limit of the key
+func (c *Controller) authorizeApiKey(ctx *gin.Context, key string) {
+	var used apikey.ApiKey
+	if err := c.Db.Get(&used, database.UseApiKey, hashToken(key), apiKeyWindow.Seconds()); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.AbortWithError(http.StatusUnauthorized, errInvalidApiKey).SetType(gin.ErrorTypePublic)
+			return
+		}
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not use api key: %s", err))
+		return
+	}
+
+	if used.WindowCount > used.RateLimit {
+		ctx.AbortWithError(http.StatusTooManyRequests, fmt.Errorf("api key is limited to %d requests per minute", used.RateLimit)).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if !apikey.Allows(used.Scope, ctx.Request.Method, ctx.FullPath()) {
+		ctx.AbortWithError(http.StatusForbidden, fmt.Errorf("api key with the %s scope cannot %s %s", used.Scope, ctx.Request.Method, ctx.FullPath())).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	userRole, err := c.getRole(used.UserId)
+	if err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get user of api key")
+		ctx.Abort()
+		return
+	}
+
+	ctx.Set("userId", used.UserId)
+	ctx.Set("role", userRole)
+	ctx.Set("scope", used.Scope)
+	ctx.Next()
+}
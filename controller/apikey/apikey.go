@@ -0,0 +1,99 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/haran/biophonie-api/controller/role"
+)
+
+// scopes of the keys, all of them can read
+const (
+	ReadOnly   = "read"
+	Upload     = "upload"
+	Moderation = "moderation"
+)
+
+// reads are the restricted routes every scope can call, the sessions, the credentials and the api keys
+// are never listed nor managed with a key
+var reads = []string{
+	"GET /api/v1/restricted/ping",
+	"GET /api/v1/restricted/favourite",
+	"GET /api/v1/restricted/playlist",
+	"GET /api/v1/restricted/playlist/:id",
+}
+
+// routes are the other routes each scope can call
+var routes = map[string][]string{
+	Upload: {
+		"GET /api/v1/restricted/upload/:id",
+		"POST /api/v1/restricted/geopoint",
+		"POST /api/v1/restricted/geopoint/upload",
+		"POST /api/v1/restricted/upload",
+		"PATCH /api/v1/restricted/upload/:id",
+	},
+	Moderation: {
+		"GET /api/v1/restricted/geopoint/:id",
+		"GET /api/v1/restricted/geopoint/:id/comments",
+		"GET /api/v1/restricted/report",
+		"PATCH /api/v1/restricted/geopoint/:id/enable",
+		"DELETE /api/v1/restricted/geopoint/:id",
+		"PATCH /api/v1/restricted/comment/:id/hide",
+		"DELETE /api/v1/restricted/comment/:id",
+		"PUT /api/v1/restricted/walk/:id",
+		"DELETE /api/v1/restricted/walk/:id",
+		"PATCH /api/v1/restricted/report/:id/resolve",
+		"PATCH /api/v1/restricted/report/:id/dismiss",
+	},
+}
+
+// permissions are the permissions of the role of the user which each scope keeps
+var permissions = map[string][]string{
+	Moderation: {role.ModerateGeoPoints, role.ModerateComments, role.ModerateWalks, role.HandleReports},
+}
+
+// ApiKey authenticates the scripts of a partner as the user it was issued for, within its scope
+type ApiKey struct {
+	Id          int        `db:"id" json:"id" example:"4"`
+	Name        string     `db:"name" json:"name" example:"museum bulk upload"`
+	UserId      int        `db:"user_id" json:"userId" example:"12"`
+	Scope       string     `db:"scope" json:"scope" example:"upload"`
+	Key         string     `db:"key" json:"key,omitempty" example:"3f9a0c1d5e7b4a2c8d6e0f1a3b5c7d9e2f4a6b8c0d1e3f5a7b9c2d4e6f8a0b1c"`
+	Prefix      string     `db:"prefix" json:"prefix" example:"3f9a0c1d"`
+	RateLimit   int        `db:"rate_limit" json:"rateLimit" example:"60"`
+	CreatedBy   *int       `db:"created_by" json:"createdBy" example:"1"`
+	CreatedOn   time.Time  `db:"created_on" json:"createdOn" example:"2022-05-26T11:17:35.079344Z"`
+	LastUsedOn  *time.Time `db:"last_used_on" json:"lastUsedOn" example:"2022-06-02T08:40:12.079344Z"`
+	Revoked     bool       `db:"revoked" json:"revoked" example:"false"`
+	WindowStart time.Time  `db:"window_start" json:"-"`
+	WindowCount int        `db:"window_count" json:"-"`
+}
+
+type AddApiKey struct {
+	Name   string `json:"name" example:"museum bulk upload" binding:"required,max=50"`
+	UserId int    `json:"userId" example:"12" binding:"required,gt=0"`
+	Scope  string `json:"scope" example:"upload" binding:"required,oneof=read upload moderation"`
+	// RateLimit is the number of requests per minute, 60 by default
+	RateLimit int `json:"rateLimit" example:"60" binding:"omitempty,min=1,max=6000"`
+}
+
+// Allows tells whether a key of the scope can call the route (as given by gin.Context.FullPath)
+func Allows(scope string, method string, route string) bool {
+	for _, allowed := range [][]string{reads, routes[scope]} {
+		for _, r := range allowed {
+			if r == method+" "+route {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Grants tells whether a key of the scope keeps the permission of the role of its user
+func Grants(scope string, permission string) bool {
+	for _, p := range permissions[scope] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -1,12 +1,24 @@
 package controller
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime/multipart"
 	"os"
+	"path"
+	"sort"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/haran/biophonie-api/controller/geopoint"
 	"github.com/haran/biophonie-api/database"
+	"github.com/haran/biophonie-api/storage"
+	"github.com/jmoiron/sqlx"
 )
 
 const MINSIZE = 49
@@ -29,17 +41,194 @@ func (c *Controller) refreshGeoJson() {
 	}
 }
 
+// asset is a file to save in the storage under key
+type asset struct {
+	key     string
+	staging string
+	size    int64
+	open    func() (io.ReadCloser, error)
+}
+
+func fileAsset(key string, fileHeader *multipart.FileHeader) asset {
+	return asset{
+		key:  key,
+		size: fileHeader.Size,
+		open: func() (io.ReadCloser, error) { return fileHeader.Open() },
+	}
+}
+
+// fileChecksum is the hex encoded SHA-256 of the uploaded file
+func fileChecksum(fileHeader *multipart.FileHeader) (string, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// soundFingerprint reads the fingerprint of the sound asset, see geopoint.SoundFingerprint
+func soundFingerprint(sound asset) (int64, error) {
+	file, err := sound.open()
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return geopoint.SoundFingerprint(file)
+}
+
+func (c *Controller) saveAsset(ctx context.Context, asset asset) error {
+	file, err := asset.open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return c.store.Save(ctx, asset.key, file, asset.size)
+}
+
+// stageAssets saves the assets under a staging key, nothing is left if one of them cannot be saved.
+// The assets are named after their content, those already stored are shared and not staged:
+// they are locked until tx ends so that they are not removed in the meantime (see removeUnreferencedAssets).
+func (c *Controller) stageAssets(ctx context.Context, tx *sqlx.Tx, assets []asset) ([]asset, error) {
+	if err := lockAssets(tx, assets); err != nil {
+		return nil, err
+	}
+
+	stagingId := uuid.NewString()
+	staged := make([]asset, 0, len(assets))
+	for _, a := range assets {
+		if _, err := c.store.Stat(ctx, a.key); err == nil {
+			continue
+		}
+
+		a.staging = storage.StagingKey(stagingId, a.key)
+		staging := a
+		staging.key = a.staging
+		if err := c.saveAsset(ctx, staging); err != nil {
+			c.removeAssets(ctx, append(stagingKeys(staged), a.staging))
+			return nil, fmt.Errorf("could not save uploaded %s: %s", a.key, err)
+		}
+		staged = append(staged, a)
+	}
+	return staged, nil
+}
+
+// publishAssets moves the staged assets to their final key, the staged ones are removed if one cannot be moved,
+// the caller removes the published ones once its transaction is rolled back
+func (c *Controller) publishAssets(ctx context.Context, staged []asset) error {
+	for _, a := range staged {
+		if err := c.store.Move(ctx, a.staging, a.key); err != nil {
+			c.removeAssets(ctx, stagingKeys(staged))
+			return fmt.Errorf("could not move staged %s: %s", a.key, err)
+		}
+	}
+	return nil
+}
+
+// removeAssets is best effort, assets which do not exist are ignored
+func (c *Controller) removeAssets(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := c.store.Remove(ctx, key); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("could not rm %s: %s", key, err)
+		}
+	}
+}
+
+// removeUnreferencedAssets removes the published assets which are not used by a committed geopoint or a template,
+// since identical assets are shared
+func (c *Controller) removeUnreferencedAssets(ctx context.Context, assets []asset) {
+	for _, a := range assets {
+		if err := c.removeUnreferencedAsset(ctx, a); err != nil {
+			log.Printf("could not remove %s: %s", a.key, err)
+		}
+	}
+}
+
+// removeUnreferencedAsset waits for the creations sharing the asset to end before counting its references
+func (c *Controller) removeUnreferencedAsset(ctx context.Context, a asset) error {
+	_, err := c.collectUnreferencedAsset(ctx, a.key, func(key string) error {
+		c.removeAssets(ctx, []string{key})
+		return nil
+	})
+	return err
+}
+
+// collectUnreferencedAsset hands the asset under key to collect while it is locked, unless it is published
+// and used by a committed geopoint or a template. It tells whether the asset was collected.
+func (c *Controller) collectUnreferencedAsset(ctx context.Context, key string, collect func(key string) error) (bool, error) {
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := lockAssets(tx, []asset{{key: key}}); err != nil {
+		return false, err
+	}
+	if !storage.Private(key) {
+		var references int
+		if err := tx.Get(&references, database.CountAssetReferences, path.Base(key)); err != nil {
+			return false, fmt.Errorf("could not count references: %s", err)
+		}
+		if references > 0 {
+			return false, nil
+		}
+	}
+	if err := collect(key); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// lockAssets locks the assets in the order of their names so that transactions locking the same assets do not deadlock
+func lockAssets(tx *sqlx.Tx, assets []asset) error {
+	names := make([]string, len(assets))
+	for i, a := range assets {
+		names[i] = path.Base(a.key)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := tx.Exec(database.LockAsset, name); err != nil {
+			return fmt.Errorf("could not lock asset %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func stagingKeys(assets []asset) []string {
+	keys := make([]string, len(assets))
+	for i, a := range assets {
+		keys[i] = a.staging
+	}
+	return keys
+}
+
+func (c *Controller) setAssetUrls(geoPoint *geopoint.GeoPoint) {
+	geoPoint.PictureUrl = c.store.URL(storage.PictureKey(geoPoint.Picture))
+	geoPoint.SoundUrl = c.store.URL(storage.SoundKey(geoPoint.Sound))
+}
+
 func (c *Controller) ClearGeoPoint(ctx *gin.Context) {
 	ctx.Next()
+	if ctx.IsAborted() {
+		return
+	}
 	picture := ctx.GetString("picture")
 	sound := ctx.GetString("sound")
 
-	if err := os.Remove(picture); err != nil {
-		log.Println("could not rm picture: ", err)
-	}
-	if err := os.Remove(sound); err != nil {
-		log.Println("could not rm sound: ", err)
-	}
+	// the assets may still be used by other geopoints or templates
+	c.removeUnreferencedAssets(ctx, []asset{
+		{key: storage.PictureKey(picture)},
+		{key: storage.SoundKey(sound)},
+	})
 
 	c.refreshGeoJson()
 }
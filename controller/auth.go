@@ -1,27 +1,45 @@
 package controller
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/golang-jwt/jwt/v4/request"
+	"github.com/google/uuid"
+	"github.com/haran/biophonie-api/controller/apikey"
+	"github.com/haran/biophonie-api/controller/role"
 	"github.com/haran/biophonie-api/controller/user"
+	"github.com/haran/biophonie-api/database"
+	"github.com/haran/biophonie-api/keyring"
 )
 
 const (
-	privKey = "app.rsa"
-	pubKey  = "app.rsa.pub"
+	legacyKeyId        = "app"
+	keysReloadInterval = time.Minute
+	// the roles are read from the database, cached for a short time
+	rolesCacheLifetime = 30 * time.Second
+	// the access tokens are short-lived, the clients renew them with their refresh token
+	accessTokenLifetime  = 15 * time.Minute
+	refreshTokenLifetime = 30 * 24 * time.Hour
 )
 
+// Authorize authenticates the user with the access token of the Authorization header or with an api key
 func (c *Controller) Authorize(ctx *gin.Context) {
-	token, err := request.ParseFromRequest(ctx.Request, request.AuthorizationHeaderExtractor, func(token *jwt.Token) (interface{}, error) {
-		return c.verifyKey, nil
-	}, request.WithClaims(&user.CustomClaims{}))
+	if key := ctx.GetHeader(apiKeyHeader); key != "" {
+		c.authorizeApiKey(ctx, key)
+		return
+	}
+
+	token, err := request.ParseFromRequest(ctx.Request, request.AuthorizationHeaderExtractor, c.verificationKey, request.WithClaims(&user.CustomClaims{}))
 
 	// If the token is missing or invalid, return error
 	if err != nil {
@@ -29,43 +47,138 @@ func (c *Controller) Authorize(ctx *gin.Context) {
 		return
 	}
 
-	var userId int
-	if err := c.Db.Get(&userId, "SELECT id FROM accounts WHERE name = $1", token.Claims.(*user.CustomClaims).Name); err != nil {
+	claims := token.Claims.(*user.CustomClaims)
+	userId, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		ctx.AbortWithError(http.StatusUnauthorized, errors.New("token is outdated, please log in again")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	userRole, err := c.getRole(userId)
+	if err != nil {
 		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get user for auth")
 		ctx.Abort()
 		return
 	}
 
+	// tokens issued before they had an id cannot be revoked
+	if claims.ID == "" {
+		ctx.AbortWithError(http.StatusUnauthorized, errors.New("token is outdated, please log in again")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var revoked bool
+	if err := c.Db.Get(&revoked, database.IsAccessTokenRevoked, claims.ID, userId); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not check token revocation: %s", err))
+		return
+	} else if err != nil || revoked {
+		ctx.AbortWithError(http.StatusUnauthorized, errors.New("token was revoked, please log in again")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
 	ctx.Set("userId", userId)
-	ctx.Set("admin", token.Claims.(*user.CustomClaims).Admin)
+	ctx.Set("role", userRole)
+	ctx.Set("sessionId", claims.Session)
 	ctx.Next()
 }
 
-func (c *Controller) AuthorizeAdmin(ctx *gin.Context) {
-	admin := ctx.GetBool("admin")
-	if !admin {
-		ctx.AbortWithError(http.StatusUnauthorized, errors.New("restricted to admins")).SetType(gin.ErrorTypePublic)
+// AuthorizeOptional authorizes the user when the request has an Authorization header or an api key and lets anonymous requests through
+func (c *Controller) AuthorizeOptional(ctx *gin.Context) {
+	if ctx.GetHeader("Authorization") == "" && ctx.GetHeader(apiKeyHeader) == "" {
+		ctx.Next()
 		return
 	}
-	ctx.Next()
+	c.Authorize(ctx)
 }
 
-// read the key files before starting http handlers
-func (c *Controller) readKeys() {
-	privKeyPath := os.Getenv("SECRETS_FOLDER") + string(os.PathSeparator) + privKey // openssl genrsa -out app.rsa keysize
-	pubKeyPath := os.Getenv("SECRETS_FOLDER") + string(os.PathSeparator) + pubKey   // openssl rsa -in app.rsa -pubout > app.rsa.pub
+// rolesCache keeps the roles of the recently authorized users
+type rolesCache struct {
+	mu      sync.Mutex
+	entries map[int]cachedRoles
+}
 
-	signBytes, err := os.ReadFile(privKeyPath)
-	fatal(err)
+type cachedRoles struct {
+	role    string
+	expires time.Time
+}
 
-	c.signKey, err = jwt.ParseRSAPrivateKeyFromPEM(signBytes)
-	fatal(err)
+// getRole reads the role of the user from the cache or from the database
+func (c *Controller) getRole(userId int) (string, error) {
+	c.roles.mu.Lock()
+	cached, ok := c.roles.entries[userId]
+	c.roles.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.role, nil
+	}
 
-	verifyBytes, err := os.ReadFile(pubKeyPath)
-	fatal(err)
+	var userRole string
+	if err := c.Db.Get(&userRole, database.GetRole, userId); err != nil {
+		return "", err
+	}
+
+	c.roles.mu.Lock()
+	defer c.roles.mu.Unlock()
+	if c.roles.entries == nil {
+		c.roles.entries = make(map[int]cachedRoles)
+	}
+	c.roles.entries[userId] = cachedRoles{role: userRole, expires: time.Now().Add(rolesCacheLifetime)}
+	return userRole, nil
+}
+
+// forgetRoles drops the cached roles of the user after they changed
+func (c *Controller) forgetRoles(userId int) {
+	c.roles.mu.Lock()
+	defer c.roles.mu.Unlock()
+	delete(c.roles.entries, userId)
+}
+
+// AuthorizePermission lets through the users whose role has the permission, after Authorize
+func (c *Controller) AuthorizePermission(permission string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !can(ctx, permission) {
+			ctx.AbortWithError(http.StatusUnauthorized, fmt.Errorf("restricted to the users allowed to %s", permission)).SetType(gin.ErrorTypePublic)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// can tells whether the authorized user has the permission, anonymous users have none
+// and api keys only keep the permissions of their scope
+func can(ctx *gin.Context, permission string) bool {
+	if scope, ok := ctx.Get("scope"); ok && !apikey.Grants(scope.(string), permission) {
+		return false
+	}
+	return role.Can(ctx.GetString("role"), permission)
+}
+
+// GetJwks publishes the public keys verifying the tokens (outside of the API base path, so not in swagger)
+func (c *Controller) GetJwks(ctx *gin.Context) {
+	ctx.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(keysReloadInterval.Seconds())))
+	ctx.JSON(http.StatusOK, c.keys.JWKS())
+}
 
-	c.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(verifyBytes)
+// read the key files before starting http handlers and watch the new ones
+func (c *Controller) readKeys() {
+	// openssl genrsa -out <kid>.rsa keysize, the newest key signs the tokens
+	keys, err := keyring.New(os.Getenv("SECRETS_FOLDER"), accessTokenLifetime)
 	fatal(err)
+
+	c.keys = keys
+	go c.keys.Watch(keysReloadInterval)
+}
+
+// verificationKey is the public key of the kid of the token, tokens without kid were signed with app.rsa
+func (c *Controller) verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = legacyKeyId
+	}
+	return c.keys.PublicKey(kid)
 }
 
 func fatal(err error) {
@@ -74,17 +187,25 @@ func fatal(err error) {
 	}
 }
 
-func (c *Controller) createToken(name string, admin bool) (string, error) {
+// createToken signs an access token of the session, its jti is returned to be recorded
+func (c *Controller) createToken(userId int, session string) (string, string, error) {
 	// create a signer for rsa 256
 	t := jwt.New(jwt.GetSigningMethod("RS256"))
+	kid, signKey := c.keys.Signer()
+	t.Header["kid"] = kid
 
+	jti := uuid.NewString()
 	t.Claims = &user.CustomClaims{
 		RegisteredClaims: &jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 365)),
+			ID:        jti,
+			Subject:   strconv.Itoa(userId),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenLifetime)),
 		},
-		UserInfo: user.UserInfo{Name: name, Admin: admin},
+		Session: session,
 	}
 
 	// create token string
-	return t.SignedString(c.signKey)
+	token, err := t.SignedString(signKey)
+	return token, jti, err
 }
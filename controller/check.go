@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/haran/biophonie-api/controller/check"
+	"github.com/haran/biophonie-api/database"
+	"github.com/haran/biophonie-api/storage"
+)
+
+const defaultGraceHours = 24
+
+// CheckAssets godoc
+// @Summary check the assets against the geopoints
+// @Description report the assets of geopoints which are missing and the orphan assets, orphans older than the grace period can be quarantined or removed. Pictures of templates are never orphans.
+// @Accept json
+// @Produce json
+// @Tags Assets
+// @Param action query string false "what to do with the orphans" Enums(report, quarantine, remove)
+// @Param grace query int false "grace period in hours before an orphan can be quarantined or removed (24 by default)"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} check.Result
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/assets/check [post]
+func (c *Controller) CheckAssets(ctx *gin.Context) {
+	options := check.Options{Action: check.Report, GraceHours: defaultGraceHours}
+	if err := ctx.BindQuery(&options); err != nil {
+		return
+	}
+
+	result, err := c.CheckAssetsConsistency(ctx, options)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+// CheckAssetsConsistency compares the storage with the geopoints, templates and uploads of the database
+func (c *Controller) CheckAssetsConsistency(ctx context.Context, options check.Options) (check.Result, error) {
+	result := check.Result{
+		Missing:     make([]check.Missing, 0),
+		Orphans:     make([]string, 0),
+		Quarantined: make([]string, 0),
+		Removed:     make([]string, 0),
+	}
+
+	var geoAssets []struct {
+		Id      int    `db:"id"`
+		Picture string `db:"picture"`
+		Sound   string `db:"sound"`
+	}
+	if err := c.Db.Select(&geoAssets, database.GetGeoPointsAssets); err != nil {
+		return result, fmt.Errorf("could not get assets of geopoints: %s", err)
+	}
+
+	var templatesPictures []string
+	if err := c.Db.Select(&templatesPictures, database.GetTemplatesPictures); err != nil {
+		return result, fmt.Errorf("could not get pictures of templates: %s", err)
+	}
+
+	var uploadsIds []string
+	if err := c.Db.Select(&uploadsIds, database.GetUploadsIds); err != nil {
+		return result, fmt.Errorf("could not get uploads: %s", err)
+	}
+
+	stored := make(map[string]storage.Object)
+	keys := make([]string, 0)
+	for _, folder := range []string{storage.PictureFolder, storage.SoundFolder, storage.StagingFolder, storage.UploadFolder} {
+		objects, err := c.store.List(ctx, folder)
+		if err != nil {
+			return result, fmt.Errorf("could not list %s: %s", folder, err)
+		}
+		for _, object := range objects {
+			stored[object.Key] = object
+			keys = append(keys, object.Key)
+		}
+	}
+
+	referenced := make(map[string]bool)
+	for _, picture := range templatesPictures {
+		referenced[storage.PictureKey(picture)] = true
+	}
+	for _, geoAsset := range geoAssets {
+		for _, key := range []string{storage.PictureKey(geoAsset.Picture), storage.SoundKey(geoAsset.Sound)} {
+			referenced[key] = true
+			if _, ok := stored[key]; !ok {
+				result.Missing = append(result.Missing, check.Missing{GeoId: geoAsset.Id, Key: key})
+			}
+		}
+	}
+
+	liveUploads := make(map[string]bool)
+	for _, id := range uploadsIds {
+		liveUploads[id] = true
+	}
+
+	graceLimit := time.Now().Add(-time.Duration(options.GraceHours) * time.Hour)
+	sort.Strings(keys)
+	for _, key := range keys {
+		if referenced[key] || strings.HasPrefix(path.Base(key), ".") {
+			continue
+		}
+		if strings.HasPrefix(key, storage.UploadFolder+"/") && liveUploads[path.Base(path.Dir(key))] {
+			continue
+		}
+
+		result.Orphans = append(result.Orphans, key)
+		if stored[key].ModTime.After(graceLimit) {
+			continue
+		}
+
+		var collect func(key string) error
+		var collected *[]string
+		switch options.Action {
+		case check.Quarantine:
+			collect = func(key string) error { return c.store.Move(ctx, key, storage.QuarantineKey(key)) }
+			collected = &result.Quarantined
+		case check.Remove:
+			collect = func(key string) error { return c.store.Remove(ctx, key) }
+			collected = &result.Removed
+		default:
+			continue
+		}
+
+		// a geopoint created since the listing may share the asset: its date is the one of the first upload
+		// so the references are counted again while the asset is locked
+		ok, err := c.collectUnreferencedAsset(ctx, key, collect)
+		if err != nil {
+			return result, fmt.Errorf("could not %s %s: %s", options.Action, key, err)
+		}
+		if !ok {
+			result.Orphans = result.Orphans[:len(result.Orphans)-1]
+			continue
+		}
+		*collected = append(*collected, key)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,24 @@
+package check
+
+const (
+	Report     = "report"
+	Quarantine = "quarantine"
+	Remove     = "remove"
+)
+
+type Options struct {
+	Action     string `form:"action" json:"action" example:"quarantine" binding:"omitempty,oneof=report quarantine remove"`
+	GraceHours int    `form:"grace" json:"grace" example:"24" binding:"min=0"`
+}
+
+type Missing struct {
+	GeoId int    `json:"geoId" example:"12"`
+	Key   string `json:"key" example:"sound/9b768967-d491-4baa-a812-24ea8a9c274d.aac"`
+}
+
+type Result struct {
+	Missing     []Missing `json:"missing"`
+	Orphans     []string  `json:"orphans" example:"picture/9b768967-d491-4baa-a812-24ea8a9c274d.webp"`
+	Quarantined []string  `json:"quarantined" example:"picture/9b768967-d491-4baa-a812-24ea8a9c274d.webp"`
+	Removed     []string  `json:"removed" example:"picture/9b768967-d491-4baa-a812-24ea8a9c274d.webp"`
+}
@@ -0,0 +1,290 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/haran/biophonie-api/controller/comment"
+	"github.com/haran/biophonie-api/controller/role"
+	"github.com/haran/biophonie-api/database"
+)
+
+const (
+	defaultCommentsLimit = 50
+	// a user cannot post more than commentsRate comments during commentsPeriod
+	commentsRate   = 5
+	commentsPeriod = time.Minute
+)
+
+// GetRestrictedComments godoc
+// @Summary get the comments of a geopoint which was not enabled
+// @Description page the comments of the geopoint in chronological order, including the hidden ones
+// @Accept json
+// @Produce json
+// @Tags Comment
+// @Param id path int true "geopoint id"
+// @Param after query int false "id of the last comment of the previous page"
+// @Param limit query int false "maximum number of comments (50 by default)"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {array} comment.Comment
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/geopoint/{id}/comments [get]
+func GetRestrictedComments() {
+	// kept only for swagger generation
+}
+
+// GetComments godoc
+// @Summary get the comments of a geopoint
+// @Description page the comments of the enabled geopoint in chronological order, replies have the id of their parent
+// @Accept json
+// @Produce json
+// @Tags Comment
+// @Param id path int true "geopoint id"
+// @Param after query int false "id of the last comment of the previous page"
+// @Param limit query int false "maximum number of comments (50 by default)"
+// @Success 200 {array} comment.Comment
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 403 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /geopoint/{id}/comments [get]
+func (c *Controller) GetComments(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	page := comment.Page{Limit: defaultCommentsLimit}
+	if err := ctx.BindQuery(&page); err != nil {
+		return
+	}
+
+	var available bool
+	if err := c.Db.Get(&available, database.IsGeoPointAvailable, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get geopoint")
+		ctx.Abort()
+		return
+	}
+
+	if !available && !can(ctx, role.ModerateComments) {
+		ctx.AbortWithError(http.StatusForbidden, errors.New("geopoint is not enabled yet")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	comments := make([]comment.Comment, 0)
+	if err := c.Db.Select(&comments, database.GetComments, id, page.After, page.Limit, can(ctx, role.ModerateComments)); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get comments")
+		ctx.Abort()
+		return
+	}
+
+	ctx.JSON(http.StatusOK, comments)
+}
+
+// PostComment godoc
+// @Summary comment a geopoint
+// @Description comment the enabled geopoint or reply to one of its comments, a user can post 5 comments per minute
+// @Accept json
+// @Produce json
+// @Tags Comment
+// @Param id path int true "geopoint id"
+// @Param comment body comment.AddComment true "content and optional parent comment"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} comment.Comment
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 429 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/geopoint/{id}/comment [post]
+func (c *Controller) PostComment(ctx *gin.Context) {
+	geoId, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var addComment comment.AddComment
+	if err := ctx.BindJSON(&addComment); err != nil {
+		return
+	}
+
+	if !c.isEnabled(ctx, geoId) {
+		return
+	}
+
+	var recent int
+	if err := c.Db.Get(&recent, database.CountRecentComments, ctx.GetInt("userId"), commentsPeriod.Seconds()); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not count recent comments: %s", err))
+		return
+	}
+	if recent >= commentsRate {
+		ctx.AbortWithError(http.StatusTooManyRequests, errors.New("too many comments, please wait a minute")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var id int
+	if err := c.Db.Get(&id, database.PostComment, geoId, ctx.GetInt("userId"), addComment.ParentId, addComment.Content); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.AbortWithError(http.StatusBadRequest, errors.New("parent is not a comment of the geopoint")).SetType(gin.ErrorTypePublic)
+			return
+		}
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not create comment")
+		ctx.Abort()
+		return
+	}
+
+	c.respondComment(ctx, uint64(id))
+}
+
+// EditComment godoc
+// @Summary edit a comment
+// @Description replace the content of a comment, restricted to its author
+// @Accept json
+// @Produce json
+// @Tags Comment
+// @Param id path int true "comment id"
+// @Param comment body comment.EditComment true "new content"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} comment.Comment
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 403 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/comment/{id} [patch]
+func (c *Controller) EditComment(ctx *gin.Context) {
+	var edit comment.EditComment
+	if err := ctx.BindJSON(&edit); err != nil {
+		return
+	}
+
+	id, ok := c.ownComment(ctx, false)
+	if !ok {
+		return
+	}
+
+	if _, err := c.Db.Exec(database.EditComment, id, edit.Content); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.respondComment(ctx, id)
+}
+
+// DeleteComment godoc
+// @Summary delete a comment
+// @Description delete a comment and its replies, restricted to its author and the moderators
+// @Accept json
+// @Produce json
+// @Tags Comment
+// @Param id path int true "comment id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {string} string
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 403 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/comment/{id} [delete]
+func (c *Controller) DeleteComment(ctx *gin.Context) {
+	id, ok := c.ownComment(ctx, true)
+	if !ok {
+		return
+	}
+
+	if _, err := c.Db.Exec(database.DeleteComment, id); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "comment was deleted"})
+}
+
+// HideComment godoc
+// @Summary hide a comment
+// @Description hide a comment from the public or show it again, the replies stay visible
+// @Accept json
+// @Produce json
+// @Tags Comment
+// @Param id path int true "comment id"
+// @Param comment body comment.HideComment true "whether the comment is hidden"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} comment.Comment
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/comment/{id}/hide [patch]
+func (c *Controller) HideComment(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var hide comment.HideComment
+	if err := ctx.BindJSON(&hide); err != nil {
+		return
+	}
+
+	result, err := c.Db.Exec(database.HideComment, id, *hide.Hidden)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if rowsAffected != 1 {
+		ctx.AbortWithError(http.StatusNotFound, fmt.Errorf("not found")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	c.respondComment(ctx, id)
+}
+
+// ownComment parses the id of the comment and aborts unless the user wrote it (or is a moderator when allowed)
+func (c *Controller) ownComment(ctx *gin.Context, allowModerators bool) (uint64, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return 0, false
+	}
+
+	var com comment.Comment
+	if err := c.Db.Get(&com, database.GetComment, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get comment")
+		ctx.Abort()
+		return 0, false
+	}
+
+	if com.UserId != ctx.GetInt("userId") && !(allowModerators && can(ctx, role.ModerateComments)) {
+		ctx.AbortWithError(http.StatusForbidden, errors.New("comment belongs to another user")).SetType(gin.ErrorTypePublic)
+		return 0, false
+	}
+	return id, true
+}
+
+func (c *Controller) respondComment(ctx *gin.Context, id uint64) {
+	var com comment.Comment
+	if err := c.Db.Get(&com, database.GetComment, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve comment")
+		ctx.Abort()
+		return
+	}
+
+	ctx.JSON(http.StatusOK, com)
+}
@@ -0,0 +1,33 @@
+package comment
+
+import "time"
+
+type Comment struct {
+	Id        int        `db:"id" json:"id" example:"1"`
+	GeoId     int        `db:"geopoint_id" json:"geoId" example:"3"`
+	UserId    int        `db:"user_id" json:"userId" example:"1"`
+	UserName  string     `db:"user_name" json:"userName" example:"bob"`
+	ParentId  *int       `db:"parent_id" json:"parentId,omitempty" example:"1"`
+	Content   string     `db:"content" json:"content" example:"Is that a nightingale at 0:42?"`
+	Hidden    bool       `db:"hidden" json:"hidden" example:"false"`
+	CreatedOn time.Time  `db:"created_on" json:"createdOn" example:"2022-05-26T11:17:35.079344Z"`
+	EditedOn  *time.Time `db:"edited_on" json:"editedOn,omitempty" example:"2022-05-26T12:03:10.079344Z"`
+}
+
+type AddComment struct {
+	Content  string `json:"content" example:"Is that a nightingale at 0:42?" binding:"required,min=1,max=1000"`
+	ParentId *int   `json:"parentId" example:"1" binding:"omitempty,min=1"`
+}
+
+type EditComment struct {
+	Content string `json:"content" example:"Is that a nightingale at 0:42?" binding:"required,min=1,max=1000"`
+}
+
+type HideComment struct {
+	Hidden *bool `json:"hidden" example:"true" binding:"required"`
+}
+
+type Page struct {
+	After int `form:"after" example:"120" binding:"min=0"`
+	Limit int `form:"limit" example:"50" binding:"min=1,max=100"`
+}
@@ -1,23 +1,40 @@
 package controller
 
 import (
-	"crypto/rsa"
 	"log"
 	"os"
+	"strconv"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/haran/biophonie-api/database"
+	"github.com/haran/biophonie-api/keyring"
+	"github.com/haran/biophonie-api/oidc"
+	"github.com/haran/biophonie-api/storage"
 	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/bcrypt"
 )
 
-const geoJsonFileName = "geojson.json"
+const (
+	geoJsonFileName = "geojson.json"
+	// identity providers of the partner organisations, optional
+	oidcProvidersFile = "oidc.json"
+	// number of independent reports hiding a geopoint from the map when REPORTS_THRESHOLD is not set
+	defaultReportsThreshold = 3
+)
 
 type Controller struct {
 	Db           *sqlx.DB
 	assetsFolder string
 	webFolder    string
 	geoJsonPath  string
-	verifyKey    *rsa.PublicKey
-	signKey      *rsa.PrivateKey
+	keys         *keyring.Keyring
+	roles        rolesCache
+	oidc         map[string]*oidc.Provider
+	validate     *validator.Validate
+	store        storage.Storage
+	// reportsThreshold is the number of independent reports hiding a geopoint from the map
+	reportsThreshold int
+	bcryptCost       int
 }
 
 func NewController() *Controller {
@@ -35,11 +52,48 @@ func NewController() *Controller {
 		log.Fatalf("assets path is empty")
 	}
 
+	store, err := storage.New()
+	if err != nil {
+		log.Fatalf("error initializing storage: %q", err)
+	}
+	c.store = store
+
 	c.webFolder = os.Getenv("WEB_FOLDER")
 	if c.webFolder == "" {
 		log.Fatalf("web path is empty")
 	}
 
+	c.reportsThreshold = defaultReportsThreshold
+	if threshold := os.Getenv("REPORTS_THRESHOLD"); threshold != "" {
+		if c.reportsThreshold, err = strconv.Atoi(threshold); err != nil || c.reportsThreshold < 1 {
+			log.Fatalf("reports threshold must be a positive integer: %q", threshold)
+		}
+	}
+
+	c.bcryptCost = bcrypt.DefaultCost
+	if cost := os.Getenv("BCRYPT_COST"); cost != "" {
+		if c.bcryptCost, err = strconv.Atoi(cost); err != nil || c.bcryptCost < bcrypt.MinCost || c.bcryptCost > bcrypt.MaxCost {
+			log.Fatalf("bcrypt cost must be an integer between %d and %d: %q", bcrypt.MinCost, bcrypt.MaxCost, cost)
+		}
+	}
+
+	c.oidc, err = oidc.Load(os.Getenv("SECRETS_FOLDER") + string(os.PathSeparator) + oidcProvidersFile)
+	if err != nil {
+		log.Fatalf("error loading identity providers: %q", err)
+	}
+
+	c.validate = validator.New()
+
+	if err := c.computeFeatures(); err != nil {
+		log.Fatalf("error computing acoustic features: %q", err)
+	}
+	if err := c.computeFingerprints(); err != nil {
+		log.Fatalf("error computing fingerprints: %q", err)
+	}
+	if err := c.computeSolar(); err != nil {
+		log.Fatalf("error computing solar context: %q", err)
+	}
+
 	c.geoJsonPath = c.assetsFolder + string(os.PathSeparator) + geoJsonFileName
 	c.refreshGeoJson()
 
@@ -2,17 +2,30 @@ package controller
 
 import (
 	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -22,8 +35,23 @@ import (
 	"github.com/go-playground/assert/v2"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
+	"github.com/haran/biophonie-api/controller/apikey"
+	"github.com/haran/biophonie-api/controller/check"
+	"github.com/haran/biophonie-api/controller/comment"
 	"github.com/haran/biophonie-api/controller/geopoint"
+	"github.com/haran/biophonie-api/controller/picture"
+	"github.com/haran/biophonie-api/controller/playlist"
+	"github.com/haran/biophonie-api/controller/report"
+	"github.com/haran/biophonie-api/controller/role"
+	"github.com/haran/biophonie-api/controller/upload"
 	"github.com/haran/biophonie-api/controller/user"
+	"github.com/haran/biophonie-api/controller/walk"
+	"github.com/haran/biophonie-api/controller/zone"
+	"github.com/haran/biophonie-api/database"
+	"github.com/haran/biophonie-api/keyring"
+	"github.com/haran/biophonie-api/oidc"
+	"github.com/haran/biophonie-api/solar"
+	"github.com/haran/biophonie-api/storage"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -35,12 +63,14 @@ var adminUser user.User = user.User{
 	Name:     "admin",
 	Password: "57aba9df-969f-4871-a095-e916d06ba38b",
 	Admin:    true,
+	Role:     role.Admin,
 }
 var standardUser user.User = user.User{
 	Id:       2,
 	Name:     "alice",
 	Password: "57aca9df-969f-4861-a095-e916d06ba38b",
 	Admin:    false,
+	Role:     role.Contributor,
 }
 var adminToken string
 var standardToken string
@@ -91,9 +121,18 @@ var unavailableGeoPoint geopoint.DbGeoPoint = geopoint.DbGeoPoint{
 	Location: postgis.PointS{SRID: geopoint.WGS84, X: 3.02, Y: 3.0},
 }
 
+var templates []picture.Template = []picture.Template{
+	{Id: 1, Name: "clearing", Picture: "clearing.webp"},
+	{Id: 2, Name: "desert", Picture: "desert.webp"},
+}
+var retiredTemplate picture.Template = picture.Template{Id: 3, Name: "lake", Picture: "lake.webp", Retired: true}
+
 func TestMain(m *testing.M) {
 	gin.SetMode(gin.TestMode)
 	preparePublicDir()
+	if os.Getenv("PRIVATE_ASSETS_FOLDER") == "" {
+		os.Setenv("PRIVATE_ASSETS_FOLDER", "/tmp/private")
+	}
 	c = NewController()
 	r = SetupRouter(c)
 	c.clearDatabase()
@@ -207,7 +246,9 @@ func TestAuthorizeUser(t *testing.T) {
 		AuthUser   user.AuthUser
 		StatusCode int
 	}{
-		{user.AuthUser{Name: standardUser.Name, Password: "random"}, http.StatusBadRequest},
+		// the passwords chosen by the users are not uuids
+		{user.AuthUser{Name: standardUser.Name, Password: "random"}, http.StatusUnauthorized},
+		{user.AuthUser{Name: standardUser.Name, Password: strings.Repeat("a", 73)}, http.StatusBadRequest},
 		{user.AuthUser{Name: standardUser.Name, Password: ""}, http.StatusBadRequest},
 		{user.AuthUser{Name: "charles", Password: "9b768967-d491-4baa-a812-24ea8a9c274d"}, http.StatusNotFound},
 		{user.AuthUser{Name: standardUser.Name, Password: adminUser.Password}, http.StatusUnauthorized},
@@ -228,88 +269,2178 @@ func TestAuthorizeUser(t *testing.T) {
 			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
 				t.Error(err)
 			}
-			_, err := jwt.Parse(got.Token, func(token *jwt.Token) (interface{}, error) {
-				return c.verifyKey, nil
-			})
+			claims := &user.CustomClaims{}
+			_, err := jwt.ParseWithClaims(got.Token, claims, c.verificationKey)
 			if err != nil {
 				t.Errorf("could not parse returned token: %s", err)
 			}
+			// the subject is the id of the user, not its name which could change
+			var id int
+			c.Db.Get(&id, "SELECT id FROM accounts WHERE name = $1", test.AuthUser.Name)
+			assert.Equal(t, strconv.Itoa(id), claims.Subject)
+			assert.Equal(t, 64, len(got.RefreshToken))
+			assert.Equal(t, int(accessTokenLifetime.Seconds()), got.ExpiresIn)
 		}
 	}
+
+	// the failures are limited by name and by ip
+	defer c.Db.MustExec("TRUNCATE TABLE login_failures")
+	var failures int
+	c.Db.Get(&failures, "SELECT COUNT(*) FROM login_failures WHERE name = 'charles'")
+	assert.Equal(t, 1, failures)
+
+	authorize := func(authUser user.AuthUser, ip string) int {
+		w := httptest.NewRecorder()
+		body, _ := json.Marshal(authUser)
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/authorize", bytes.NewReader(body))
+		req.RemoteAddr = ip + ":4242"
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	c.Db.MustExec("INSERT INTO login_failures (name, ip, created_on) SELECT $1, '10.0.1.1', now() FROM generate_series(1, $2)", standardUser.Name, loginFailuresPerName)
+	assert.Equal(t, http.StatusTooManyRequests, authorize(user.AuthUser{Name: standardUser.Name, Password: standardUser.Password}, "10.0.1.2"))
+	assert.Equal(t, http.StatusOK, authorize(user.AuthUser{Name: adminUser.Name, Password: adminUser.Password}, "10.0.1.1"))
+
+	c.Db.MustExec("INSERT INTO login_failures (name, ip, created_on) SELECT 'charles', '10.0.1.3', now() FROM generate_series(1, $1)", loginFailuresPerIp)
+	assert.Equal(t, http.StatusTooManyRequests, authorize(user.AuthUser{Name: adminUser.Name, Password: adminUser.Password}, "10.0.1.3"))
+	assert.Equal(t, http.StatusOK, authorize(user.AuthUser{Name: adminUser.Name, Password: adminUser.Password}, "10.0.1.4"))
+
+	// the old failures are forgotten
+	c.Db.MustExec("UPDATE login_failures SET created_on = now() - $1 * interval '1 second'", loginFailuresPeriod.Seconds())
+	assert.Equal(t, http.StatusOK, authorize(user.AuthUser{Name: standardUser.Name, Password: standardUser.Password}, "10.0.1.3"))
 }
 
-func TestPingAuthenticated(t *testing.T) {
-	unvalidTokens := c.wrongToken()
+func TestRefreshToken(t *testing.T) {
+	defer c.Db.MustExec("TRUNCATE TABLE refresh_tokens")
+
+	login := func() user.AccessToken {
+		body, _ := json.Marshal(user.AuthUser{Name: standardUser.Name, Password: standardUser.Password})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/authorize", bytes.NewReader(body))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var tokens user.AccessToken
+		if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+			t.Error(err)
+		}
+		return tokens
+	}
+	post := func(path string, refreshToken string) (int, user.AccessToken) {
+		body, _ := json.Marshal(user.Refresh{RefreshToken: refreshToken})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/user"+path, bytes.NewReader(body))
+		r.ServeHTTP(w, req)
+		var tokens user.AccessToken
+		if w.Code == http.StatusOK && path == "/token/refresh" {
+			if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+				t.Error(err)
+			}
+		}
+		return w.Code, tokens
+	}
+
+	first := login()
+	code, second := post("/token/refresh", first.RefreshToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	// the refreshed access token is short-lived and accepted
+	claims := &user.CustomClaims{}
+	if _, err := jwt.ParseWithClaims(second.Token, claims, c.verificationKey); err != nil {
+		t.Errorf("could not parse refreshed token: %s", err)
+	}
+	assert.Equal(t, true, time.Until(claims.ExpiresAt.Time) <= accessTokenLifetime)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/restricted/ping", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", second.Token))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// reusing a refresh token revokes the whole family
+	code, _ = post("/token/refresh", first.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = post("/token/refresh", second.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// logout revokes the family too, other logins are kept
+	third, fourth := login(), login()
+	code, _ = post("/logout", third.RefreshToken)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = post("/token/refresh", third.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = post("/token/refresh", fourth.RefreshToken)
+	assert.Equal(t, http.StatusOK, code)
+
+	expired := login()
+	c.Db.MustExec("UPDATE refresh_tokens SET expires_on = now() - interval '1 second' WHERE token = $1", hashToken(expired.RefreshToken))
+	code, _ = post("/token/refresh", expired.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// the next login purges the expired and revoked refresh tokens
+	login()
+	var stale int
+	c.Db.Get(&stale, "SELECT COUNT(*) FROM refresh_tokens WHERE expires_on < now() OR revoked = TRUE")
+	assert.Equal(t, 0, stale)
+	var left int
+	c.Db.Get(&left, "SELECT COUNT(*) FROM refresh_tokens WHERE token = $1", hashToken(fourth.RefreshToken))
+	assert.Equal(t, 1, left)
+
+	code, _ = post("/token/refresh", strings.Repeat("0", 64))
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = post("/logout", "not a token")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestSessions(t *testing.T) {
+	// the admin revokes all the tokens of the standard user at the end
+	defer func() { standardToken = c.sessionToken(standardUser) }()
+
+	login := func(device string) user.AccessToken {
+		body, _ := json.Marshal(user.AuthUser{Name: standardUser.Name, Password: standardUser.Password})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/authorize", bytes.NewReader(body))
+		req.Header.Set("User-Agent", device)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var tokens user.AccessToken
+		if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+			t.Error(err)
+		}
+		return tokens
+	}
+	call := func(method string, path string, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/api/v1/restricted"+path, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	phone, tablet := login("biophonie (Android 13)"), login("biophonie (iPadOS 16)")
+	w := call(http.MethodGet, "/session", phone.Token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var sessions []user.Session
+	if err := json.Unmarshal(w.Body.Bytes(), &sessions); err != nil {
+		t.Error(err)
+	}
+	devices := make(map[string]user.Session)
+	for _, session := range sessions {
+		devices[session.Device] = session
+	}
+	assert.Equal(t, true, devices["biophonie (Android 13)"].Current)
+	assert.Equal(t, false, devices["biophonie (iPadOS 16)"].Current)
+	tabletSession := devices["biophonie (iPadOS 16)"].Id
+
 	tests := []struct {
-		JWT        string
+		Method     string
+		Path       string
+		Token      string
 		StatusCode int
 	}{
-		{standardToken, http.StatusOK},
-		{unvalidTokens[0], http.StatusNotFound},
-		{unvalidTokens[1], http.StatusUnauthorized},
-		{unvalidTokens[2], http.StatusUnauthorized},
+		{http.MethodDelete, "/session/" + tabletSession, adminToken, http.StatusNotFound},
+		{http.MethodDelete, "/session/tablet", phone.Token, http.StatusBadRequest},
+		{http.MethodDelete, "/session/" + tabletSession, phone.Token, http.StatusOK},
+		{http.MethodGet, "/ping", tablet.Token, http.StatusUnauthorized},
+		{http.MethodGet, "/ping", phone.Token, http.StatusOK},
+		{http.MethodDelete, "/user/2/sessions", phone.Token, http.StatusUnauthorized},
+		{http.MethodDelete, "/user/1000/sessions", adminToken, http.StatusNotFound},
+		{http.MethodDelete, "/user/2/sessions", adminToken, http.StatusOK},
+		{http.MethodGet, "/ping", phone.Token, http.StatusUnauthorized},
+		{http.MethodGet, "/ping", standardToken, http.StatusUnauthorized},
+		{http.MethodGet, "/ping", adminToken, http.StatusOK},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.StatusCode, call(test.Method, test.Path, test.Token).Code)
+	}
+
+	// the refresh tokens of revoked sessions are revoked too
+	body, _ := json.Marshal(user.Refresh{RefreshToken: tablet.RefreshToken})
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/token/refresh", bytes.NewReader(body))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	laptop := login("Firefox")
+	assert.Equal(t, http.StatusOK, call(http.MethodDelete, "/session", laptop.Token).Code)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/ping", laptop.Token).Code)
+
+	// tokens without jti cannot be revoked so they are refused
+	legacy := jwt.New(jwt.GetSigningMethod("RS256"))
+	legacy.Claims = &user.CustomClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(adminUser.Id),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 365)),
+		},
+	}
+	_, signKey := c.keys.Signer()
+	legacyToken, _ := legacy.SignedString(signKey)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/ping", legacyToken).Code)
+}
+
+func TestChosenPassword(t *testing.T) {
+	defer func() {
+		c.Db.MustExec("DELETE FROM credentials WHERE user_id = $1", standardUser.Id)
+		c.Db.MustExec("DELETE FROM accounts WHERE name = $1", "webuser")
+	}()
+
+	login := func(name string, password string) int {
+		body, _ := json.Marshal(user.AuthUser{Name: name, Password: password})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/authorize", bytes.NewReader(body))
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	choose := func(choosePassword user.ChoosePassword) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(choosePassword)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPut, "/api/v1/restricted/user/password", bytes.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", standardToken))
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		Password   string
+		StatusCode int
+	}{
+		{"Sh0rt!", http.StatusBadRequest},
+		{"alllowercase", http.StatusBadRequest},
+		{"aaaaaaaaaaaaaaaaaaaa", http.StatusBadRequest},
+		{"Alice-2022!", http.StatusBadRequest},
+		{strings.Repeat("Ab1!", 19), http.StatusBadRequest},
+		{"Tr0mbone-Forest", http.StatusOK},
+		// passphrases do not need symbols
+		{"correct horse battery staple", http.StatusOK},
 	}
 	for _, test := range tests {
+		assert.Equal(t, test.StatusCode, choose(user.ChoosePassword{Password: test.Password, CurrentPassword: standardUser.Password}).Code)
+	}
+
+	// the current password or a recovery code is needed, so that a forgotten session cannot take over the account
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/restricted/user/%d/recovery", standardUser.Id), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", adminToken))
+	r.ServeHTTP(w, req)
+	var code user.RecoveryCode
+	if err := json.Unmarshal(w.Body.Bytes(), &code); err != nil {
+		t.Error(err)
+	}
+	proofs := []struct {
+		ChoosePassword user.ChoosePassword
+		StatusCode     int
+	}{
+		{user.ChoosePassword{Password: "Tr0mbone-Forest"}, http.StatusBadRequest},
+		{user.ChoosePassword{Password: "Tr0mbone-Forest", CurrentPassword: adminUser.Password}, http.StatusUnauthorized},
+		{user.ChoosePassword{Password: "Tr0mbone-Forest", RecoveryCode: "0123456789abcdef"}, http.StatusUnauthorized},
+		{user.ChoosePassword{Password: "Tr0mbone-Forest", RecoveryCode: code.Code}, http.StatusOK},
+		{user.ChoosePassword{Password: "Tr0mbone-Forest", RecoveryCode: code.Code}, http.StatusUnauthorized},
+		// the chosen password proves it too
+		{user.ChoosePassword{Password: "correct horse battery staple", CurrentPassword: "Tr0mbone-Forest"}, http.StatusOK},
+	}
+	for _, proof := range proofs {
+		assert.Equal(t, proof.StatusCode, choose(proof.ChoosePassword).Code)
+	}
+
+	// the last chosen password replaced the previous one, the generated password still works
+	assert.Equal(t, http.StatusUnauthorized, login(standardUser.Name, "Tr0mbone-Forest"))
+	assert.Equal(t, http.StatusOK, login(standardUser.Name, "correct horse battery staple"))
+	assert.Equal(t, http.StatusOK, login(standardUser.Name, standardUser.Password))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/api/v1/restricted/credential", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", standardToken))
+	r.ServeHTTP(w, req)
+	var credentials []user.Credential
+	if err := json.Unmarshal(w.Body.Bytes(), &credentials); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, 1, len(credentials))
+	assert.Equal(t, user.ChosenCredential, credentials[0].Kind)
+
+	// the password can be chosen when creating the user
+	for _, test := range []struct {
+		AddUser    user.AddUser
+		StatusCode int
+	}{
+		{user.AddUser{Name: "webuser", Password: "webuser-Pa55"}, http.StatusBadRequest},
+		{user.AddUser{Name: "webuser", Password: "Tr0mbone-Forest"}, http.StatusOK},
+	} {
+		body, _ := json.Marshal(test.AddUser)
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest(http.MethodGet, "/api/v1/restricted/ping", nil)
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/user", bytes.NewReader(body))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
 
-		if test.JWT != "" {
-			// Write authorization token in header
-			req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.JWT))
+		if w.Code == http.StatusOK {
+			var created user.User
+			if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, http.StatusOK, login(created.Name, created.Password))
+			assert.Equal(t, http.StatusOK, login(created.Name, test.AddUser.Password))
 		}
+	}
+}
+
+func TestApiKeys(t *testing.T) {
+	defer c.Db.MustExec("DELETE FROM api_keys")
 
+	create := func(addApiKey apikey.AddApiKey, token string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(addApiKey)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/restricted/apikey", bytes.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
 		r.ServeHTTP(w, req)
-		assert.Equal(t, test.StatusCode, w.Code)
+		return w
+	}
+	issue := func(addApiKey apikey.AddApiKey) apikey.ApiKey {
+		w := create(addApiKey, adminToken)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var created apikey.ApiKey
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, 64, len(created.Key))
+		assert.Equal(t, created.Key[:8], created.Prefix)
+		return created
+	}
+	call := func(method string, path string, key string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/api/v1"+path, nil)
+		req.Header.Set("X-Api-Key", key)
+		r.ServeHTTP(w, req)
+		return w.Code
 	}
 
-}
+	invalid := []struct {
+		AddApiKey  apikey.AddApiKey
+		Token      string
+		StatusCode int
+	}{
+		{apikey.AddApiKey{Name: "script", UserId: standardUser.Id, Scope: apikey.ReadOnly}, standardToken, http.StatusUnauthorized},
+		{apikey.AddApiKey{Name: "script", UserId: standardUser.Id, Scope: "admin"}, adminToken, http.StatusBadRequest},
+		{apikey.AddApiKey{Name: "script", UserId: standardUser.Id, Scope: apikey.ReadOnly, RateLimit: -1}, adminToken, http.StatusBadRequest},
+		{apikey.AddApiKey{Name: "script", UserId: 99999, Scope: apikey.ReadOnly}, adminToken, http.StatusNotFound},
+		// contributors cannot moderate, with a key neither
+		{apikey.AddApiKey{Name: "script", UserId: standardUser.Id, Scope: apikey.Moderation}, adminToken, http.StatusBadRequest},
+	}
+	for _, test := range invalid {
+		assert.Equal(t, test.StatusCode, create(test.AddApiKey, test.Token).Code)
+	}
+
+	read := issue(apikey.AddApiKey{Name: "bulk download", UserId: standardUser.Id, Scope: apikey.ReadOnly})
+	assert.Equal(t, defaultApiKeyRateLimit, read.RateLimit)
+	upload := issue(apikey.AddApiKey{Name: "bulk upload", UserId: standardUser.Id, Scope: apikey.Upload})
+	moderation := issue(apikey.AddApiKey{Name: "moderation bot", UserId: adminUser.Id, Scope: apikey.Moderation})
 
-func TestPostGeoPoint(t *testing.T) {
 	tests := []struct {
-		SoundPath   string
-		PicturePath string
-		GeoPoint    geopoint.AddGeoPoint
-		JWT         string
-		StatusCode  int
+		Method     string
+		Path       string
+		Key        string
+		StatusCode int
 	}{
-		{"../testassets/merle.aac", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.1, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusOK},
-		{"../testassets/merle.aac", "", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(100), PictureTemplate: "clearing"}, standardToken, http.StatusOK},
-		{"../testassets/merle.aac", "", geopoint.AddGeoPoint{Title: "Mountain by day", Latitude: 1.0, Longitude: 1.3, Date: time.Now(), Amplitudes: newAmplitudes(100), PictureTemplate: "desert"}, standardToken, http.StatusOK},
-		{"../testassets/merle.aac", "", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
-		{"../testassets/merle.aac", "../testassets/russie.jpg", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.1, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
-		{"../testassets/merle.wav", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.1, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
-		{"../testassets/merle.aac", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Fo", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
-		{"../testassets/merle.aac", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night very late at night", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
-		{"../testassets/merle.aac", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 100000001.0, Longitude: 1000000000.2, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
-		{"../testassets/merle.aac", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.2, Date: time.Now().Add(200000 * time.Hour), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
-		{"../testassets/merle.aac", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(1)}, standardToken, http.StatusBadRequest},
-		{"../testassets/merle.aac", "../main.go", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(1)}, standardToken, http.StatusBadRequest},
-		{"../main.go", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(1)}, standardToken, http.StatusBadRequest},
+		{http.MethodGet, "/restricted/ping", strings.Repeat("0", 64), http.StatusUnauthorized},
+		{http.MethodGet, "/restricted/ping", read.Key, http.StatusOK},
+		{http.MethodGet, "/restricted/favourite", read.Key, http.StatusOK},
+		{http.MethodPut, fmt.Sprintf("/restricted/favourite/%d", availableGeoPoint1.Id), read.Key, http.StatusForbidden},
+		{http.MethodPost, "/restricted/upload", read.Key, http.StatusForbidden},
+		{http.MethodGet, "/restricted/report", read.Key, http.StatusForbidden},
+		{http.MethodGet, "/restricted/upload/1", read.Key, http.StatusForbidden},
+		// the sessions, the credentials and the api keys are out of reach of every scope
+		{http.MethodGet, "/restricted/session", read.Key, http.StatusForbidden},
+		{http.MethodGet, "/restricted/credential", upload.Key, http.StatusForbidden},
+		{http.MethodGet, "/restricted/apikey", moderation.Key, http.StatusForbidden},
+		// the upload key reaches the handler which rejects the empty upload
+		{http.MethodPost, "/restricted/upload", upload.Key, http.StatusBadRequest},
+		{http.MethodPost, "/restricted/walk", upload.Key, http.StatusForbidden},
+		{http.MethodGet, "/restricted/report", moderation.Key, http.StatusOK},
+		{http.MethodGet, fmt.Sprintf("/restricted/geopoint/%d", unavailableGeoPoint.Id), moderation.Key, http.StatusOK},
+		// the moderation key of an admin does not manage anything
+		{http.MethodGet, "/restricted/template", moderation.Key, http.StatusForbidden},
+		{http.MethodPost, "/restricted/apikey", moderation.Key, http.StatusForbidden},
+		{http.MethodDelete, "/restricted/session", moderation.Key, http.StatusForbidden},
+		{http.MethodPost, fmt.Sprintf("/geopoint/%d/report", availableGeoPoint1.Id), read.Key, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.StatusCode, call(test.Method, test.Path, test.Key))
+	}
+
+	limited := issue(apikey.AddApiKey{Name: "limited", UserId: standardUser.Id, Scope: apikey.ReadOnly, RateLimit: 3})
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/restricted/ping", limited.Key))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, call(http.MethodGet, "/restricted/ping", limited.Key))
+	assert.Equal(t, http.StatusTooManyRequests, call(http.MethodGet, "/restricted/ping", limited.Key))
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/restricted/ping", read.Key))
+	// the rejected requests are not counted
+	var count int
+	c.Db.Get(&count, "SELECT window_count FROM api_keys WHERE id = $1", limited.Id)
+	assert.Equal(t, 4, count)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/restricted/apikey", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", adminToken))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var keys []apikey.ApiKey
+	if err := json.Unmarshal(w.Body.Bytes(), &keys); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, 4, len(keys))
+	for _, key := range keys {
+		assert.Equal(t, "", key.Key)
+		assert.NotEqual(t, nil, key.LastUsedOn)
+		assert.Equal(t, adminUser.Id, *key.CreatedBy)
+	}
+
+	revoke := func(id int) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("/api/v1/restricted/apikey/%d", id), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", adminToken))
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusNotFound, revoke(99999))
+	assert.Equal(t, http.StatusOK, revoke(read.Id))
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/restricted/ping", read.Key))
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/restricted/ping", upload.Key))
+}
+
+func TestCredentials(t *testing.T) {
+	// the recovery revokes the sessions and every test changes the password of the standard user
+	defer func() {
+		hash, _ := bcrypt.GenerateFromPassword([]byte(standardUser.Password), bcrypt.DefaultCost)
+		c.Db.MustExec("UPDATE accounts SET password = $2 WHERE id = $1", standardUser.Id, hash)
+		c.Db.MustExec("DELETE FROM credentials WHERE user_id = $1", standardUser.Id)
+		standardToken = c.sessionToken(standardUser)
+	}()
+
+	login := func(password string) int {
+		body, _ := json.Marshal(user.AuthUser{Name: standardUser.Name, Password: password})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/user/authorize", bytes.NewReader(body))
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	call := func(method string, path string, token string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/api/v1"+path, bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call(http.MethodPost, "/restricted/credential", standardToken, user.AddCredential{Device: "tablet"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tablet user.Credential
+	if err := json.Unmarshal(w.Body.Bytes(), &tablet); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, http.StatusOK, login(tablet.Password))
+	assert.Equal(t, http.StatusOK, login(standardUser.Password))
+
+	w = call(http.MethodGet, "/restricted/credential", standardToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var credentials []user.Credential
+	if err := json.Unmarshal(w.Body.Bytes(), &credentials); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, 1, len(credentials))
+	assert.Equal(t, "", credentials[0].Password)
+	assert.NotEqual(t, nil, credentials[0].LastUsedOn)
+
+	for i := 1; i < maxCredentials; i++ {
+		assert.Equal(t, http.StatusOK, call(http.MethodPost, "/restricted/credential", standardToken, user.AddCredential{Device: "phone"}).Code)
+	}
+	assert.Equal(t, http.StatusConflict, call(http.MethodPost, "/restricted/credential", standardToken, user.AddCredential{Device: "phone"}).Code)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/restricted/credential", standardToken, user.AddCredential{}).Code)
+
+	assert.Equal(t, http.StatusNotFound, call(http.MethodDelete, fmt.Sprintf("/restricted/credential/%d", tablet.Id), adminToken, nil).Code)
+	assert.Equal(t, http.StatusOK, call(http.MethodDelete, fmt.Sprintf("/restricted/credential/%d", tablet.Id), standardToken, nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodDelete, fmt.Sprintf("/restricted/credential/%d", tablet.Id), standardToken, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, login(tablet.Password))
+
+	// the rotated password replaces the previous one, given the current password
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/restricted/user/password", standardToken, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodPost, "/restricted/user/password", standardToken, user.RotatePassword{Password: tablet.Password}).Code)
+	w = call(http.MethodPost, "/restricted/user/password", standardToken, user.RotatePassword{Password: standardUser.Password})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rotated user.User
+	if err := json.Unmarshal(w.Body.Bytes(), &rotated); err != nil {
+		t.Error(err)
+	}
+	assert.NotEqual(t, standardUser.Password, rotated.Password)
+	assert.Equal(t, http.StatusUnauthorized, login(standardUser.Password))
+	assert.Equal(t, http.StatusOK, login(rotated.Password))
+
+	// the recovery deletes the credentials added before
+	w = call(http.MethodPost, "/restricted/credential", standardToken, user.AddCredential{Device: "laptop"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var laptop user.Credential
+	if err := json.Unmarshal(w.Body.Bytes(), &laptop); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, http.StatusOK, login(laptop.Password))
+
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodPost, fmt.Sprintf("/restricted/user/%d/recovery", standardUser.Id), standardToken, nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodPost, "/restricted/user/99999/recovery", adminToken, nil).Code)
+	w = call(http.MethodPost, fmt.Sprintf("/restricted/user/%d/recovery", standardUser.Id), adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var code user.RecoveryCode
+	if err := json.Unmarshal(w.Body.Bytes(), &code); err != nil {
+		t.Error(err)
 	}
 
+	tests := []struct {
+		Recover    user.Recover
+		StatusCode int
+	}{
+		{user.Recover{Name: standardUser.Name, Code: "not a code"}, http.StatusBadRequest},
+		{user.Recover{Name: standardUser.Name, Code: "0123456789abcdef"}, http.StatusUnauthorized},
+		{user.Recover{Name: adminUser.Name, Code: code.Code}, http.StatusUnauthorized},
+		{user.Recover{Name: standardUser.Name, Code: code.Code}, http.StatusOK},
+		{user.Recover{Name: standardUser.Name, Code: code.Code}, http.StatusUnauthorized},
+	}
+	var recovered user.User
 	for _, test := range tests {
-		userBytes, err := json.Marshal(test.GeoPoint)
-		if err != nil {
-			t.Error(err)
+		w = call(http.MethodPost, "/user/recover", "", test.Recover)
+		assert.Equal(t, test.StatusCode, w.Code)
+		if test.StatusCode == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &recovered); err != nil {
+				t.Error(err)
+			}
 		}
-		values := map[string]io.Reader{
-			"sound":    mustOpen(test.SoundPath),
-			"geopoint": strings.NewReader(string(userBytes)),
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login(rotated.Password))
+	assert.Equal(t, http.StatusUnauthorized, login(laptop.Password))
+	assert.Equal(t, http.StatusOK, login(recovered.Password))
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/restricted/ping", standardToken, nil).Code)
+}
+
+func TestKeyRotation(t *testing.T) {
+	folder := t.TempDir()
+	appKey, err := ioutil.ReadFile(os.Getenv("SECRETS_FOLDER") + string(os.PathSeparator) + "app.rsa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey := func(name string, pem []byte, age time.Duration) {
+		path := folder + string(os.PathSeparator) + name
+		if err := ioutil.WriteFile(path, pem, 0600); err != nil {
+			t.Fatal(err)
 		}
-		if test.PicturePath != "" {
-			values["picture"] = mustOpen(test.PicturePath)
+		os.Chtimes(path, time.Now().Add(-age), time.Now().Add(-age))
+	}
+	// the date a key was first seen is kept next to it
+	writeSince := func(kid string, age time.Duration) {
+		since := []byte(time.Now().Add(-age).UTC().Format(time.RFC3339))
+		if err := ioutil.WriteFile(folder+string(os.PathSeparator)+kid+".since", since, 0600); err != nil {
+			t.Fatal(err)
 		}
+	}
+	writeKey("app.rsa", appKey, time.Hour)
+	writeSince("app", time.Hour)
+
+	// the previous keys are kept for the retention after a new key appeared
+	retention := 10 * time.Minute
+	keys, err := keyring.New(folder, retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous *keyring.Keyring) { c.keys = previous }(c.keys)
+	c.keys = keys
+	oldToken := c.sessionToken(standardUser)
+
+	// the new key signs the tokens, even when it was copied with an older modification time,
+	// the previous one still verifies the tokens it signed
+	newKey, _ := rsa.GenerateKey(cryptorand.Reader, 2048)
+	writeKey("next.rsa", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(newKey)}), 2*time.Hour)
+	if err := keys.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	newToken := c.sessionToken(standardUser)
+	kid, _ := keys.Signer()
+	assert.Equal(t, "next", kid)
+	if _, err := os.Stat(folder + string(os.PathSeparator) + "next.since"); err != nil {
+		t.Errorf("new key was not dated: %s", err)
+	}
 
+	jwks := func() []string {
 		w := httptest.NewRecorder()
-		req, err := buildFormData(values, "/api/v1/restricted/geopoint")
-		if err != nil {
+		req, _ := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var got keyring.JWKS
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Error(err)
+		}
+		kids := make([]string, 0)
+		for _, key := range got.Keys {
+			assert.Equal(t, "RS256", key.Alg)
+			kids = append(kids, key.Kid)
+		}
+		return kids
+	}
+	ping := func(token string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/restricted/ping", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, []string{"app", "next"}, jwks())
+	assert.Equal(t, http.StatusOK, ping(oldToken))
+	assert.Equal(t, http.StatusOK, ping(newToken))
+
+	// once the tokens signed with the previous key expired, the key is not published anymore,
+	// even by a server started afterwards
+	writeSince("next", retention+time.Minute)
+	if err := keys.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"next"}, jwks())
+	assert.Equal(t, http.StatusUnauthorized, ping(oldToken))
+	assert.Equal(t, http.StatusOK, ping(newToken))
+
+	if c.keys, err = keyring.New(folder, retention); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"next"}, jwks())
+	assert.Equal(t, http.StatusUnauthorized, ping(oldToken))
+
+	// a broken key does not replace the loaded ones
+	writeKey("broken.rsa", []byte("not a key"), 0)
+	if err := c.keys.Reload(); err == nil {
+		t.Error("broken key was loaded")
+	}
+	assert.Equal(t, http.StatusOK, ping(newToken))
+}
+
+func TestOidcLogin(t *testing.T) {
+	// mock identity provider issuing the id tokens of the grants
+	key, _ := rsa.GenerateKey(cryptorand.Reader, 2048)
+	grants := make(map[string]*oidc.Claims)
+	challenges := make(map[string]string)
+	kid, jwksFetches := "mock", 0
+	var mock *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 mock.URL,
+			"authorization_endpoint": mock.URL + "/authorize",
+			"token_endpoint":         mock.URL + "/token",
+			"jwks_uri":               mock.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwksFetches++
+		json.NewEncoder(w).Encode(keyring.JWKS{Keys: []keyring.JWK{{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: "mock",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   "AQAB",
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		code := r.PostForm.Get("code")
+		claims, ok := grants[code]
+		if !ok || r.PostForm.Get("client_id") != "biophonie" || oidc.Challenge(r.PostForm.Get("code_verifier")) != challenges[code] {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		delete(grants, code)
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		idToken, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": idToken})
+	})
+	mock = httptest.NewServer(mux)
+	defer mock.Close()
+
+	c.oidc = map[string]*oidc.Provider{"mock": oidc.New(oidc.Config{
+		Name:         "mock",
+		Issuer:       mock.URL,
+		ClientId:     "biophonie",
+		ClientSecret: "secret",
+		RedirectUrl:  "http://localhost:8080/api/v1/user/oidc/mock/callback",
+	})}
+	defer func() {
+		c.oidc = map[string]*oidc.Provider{}
+		c.Db.MustExec("DELETE FROM accounts WHERE id IN (SELECT user_id FROM identities)")
+	}()
+
+	get := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/user/oidc"+path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	// the callback is sent with the cookies of the login, unless it was started in another browser
+	var foreign bool
+	login := func(subject string, username string, tamper func(*oidc.Claims)) *httptest.ResponseRecorder {
+		w := get("/mock/login")
+		assert.Equal(t, http.StatusFound, w.Code)
+		location, _ := url.Parse(w.Header().Get("Location"))
+		query := location.Query()
+		assert.Equal(t, mock.URL+"/authorize", fmt.Sprintf("%s://%s%s", location.Scheme, location.Host, location.Path))
+		assert.Equal(t, "S256", query.Get("code_challenge_method"))
+
+		// the user logs in at the provider which redirects with a code
+		code := uuid.NewString()
+		claims := &oidc.Claims{
+			RegisteredClaims: &jwt.RegisteredClaims{
+				Issuer:    mock.URL,
+				Subject:   subject,
+				Audience:  jwt.ClaimStrings{"biophonie"},
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			Nonce:             query.Get("nonce"),
+			PreferredUsername: username,
+		}
+		if tamper != nil {
+			tamper(claims)
+		}
+		grants[code] = claims
+		challenges[code] = query.Get("code_challenge")
+
+		callback := "/mock/callback?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+		if foreign {
+			return get(callback)
+		}
+		return get(callback, w.Result().Cookies()...)
+	}
+	account := func(w *httptest.ResponseRecorder) user.User {
+		var tokens user.AccessToken
+		if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
 			t.Error(err)
 		}
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.JWT))
-
-		r.ServeHTTP(w, req)
-		fmt.Println(w.Body.String())
-		assert.Equal(t, test.StatusCode, w.Code)
+		claims := &user.CustomClaims{}
+		if _, err := jwt.ParseWithClaims(tokens.Token, claims, c.verificationKey); err != nil {
+			t.Errorf("could not parse returned token: %s", err)
+		}
+		var logged user.User
+		if err := c.Db.Get(&logged, "SELECT * FROM accounts WHERE id = $1", claims.Subject); err != nil {
+			t.Errorf("logged user not in database: %s", err)
+		}
+		return logged
+	}
+
+	w := get("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `["mock"]`, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, get("/unknown/login").Code)
+
+	w = login("1", "jdoe", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	first := account(w)
+	assert.Equal(t, "jdoe", first.Name)
+
+	// the subject keeps its account even if its name changed at the provider
+	w = login("1", "john", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, first.Id, account(w).Id)
+
+	// names are unique
+	w = login("2", "jdoe", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	second := account(w)
+	assert.NotEqual(t, first.Id, second.Id)
+	assert.NotEqual(t, "jdoe", second.Name)
+	assert.Equal(t, true, strings.HasPrefix(second.Name, "jdoe"))
+
+	w = login("3", "?!", func(claims *oidc.Claims) { claims.Email = "Jane Doe@example.org" })
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Jane-Doe", account(w).Name)
+
+	tampered := []func(*oidc.Claims){
+		func(claims *oidc.Claims) { claims.Nonce = "replayed" },
+		func(claims *oidc.Claims) { claims.Audience = jwt.ClaimStrings{"another client"} },
+		func(claims *oidc.Claims) { claims.Issuer = "https://impostor.example.org" },
+		func(claims *oidc.Claims) { claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) },
+		func(claims *oidc.Claims) { claims.Subject = "" },
+	}
+	for _, tamper := range tampered {
+		assert.Equal(t, http.StatusUnauthorized, login("4", "mallory", tamper).Code)
+	}
+
+	// the callback of a login started in another browser is refused
+	foreign = true
+	assert.Equal(t, http.StatusUnauthorized, login("4", "mallory", nil).Code)
+	foreign = false
+
+	// a token signed with an unknown key fetches the keys of the provider again, at most once a minute
+	kid = "forged"
+	fetches := jwksFetches
+	assert.Equal(t, http.StatusUnauthorized, login("4", "mallory", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, login("4", "mallory", nil).Code)
+	assert.Equal(t, true, jwksFetches-fetches <= 1)
+	kid = "mock"
+
+	tests := []struct {
+		Path       string
+		StatusCode int
+	}{
+		{"/mock/callback?error=access_denied", http.StatusUnauthorized},
+		{"/mock/callback?code=abc", http.StatusBadRequest},
+		{"/mock/callback?code=abc&state=" + strings.Repeat("0", 64), http.StatusUnauthorized},
+		{"/unknown/callback?code=abc&state=" + strings.Repeat("0", 64), http.StatusNotFound},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.StatusCode, get(test.Path).Code)
+	}
+
+	// a state cannot be used twice
+	w = get("/mock/login")
+	location, _ := url.Parse(w.Header().Get("Location"))
+	callback := "/mock/callback?" + url.Values{"code": {"unknown"}, "state": {location.Query().Get("state")}}.Encode()
+	assert.Equal(t, http.StatusUnauthorized, get(callback, w.Result().Cookies()...).Code)
+	assert.Equal(t, http.StatusUnauthorized, get(callback, w.Result().Cookies()...).Code)
+}
+
+func TestPingAuthenticated(t *testing.T) {
+	unvalidTokens := c.wrongToken()
+	tests := []struct {
+		JWT        string
+		StatusCode int
+	}{
+		{standardToken, http.StatusOK},
+		{unvalidTokens[0], http.StatusNotFound},
+		{unvalidTokens[1], http.StatusUnauthorized},
+		{unvalidTokens[2], http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/restricted/ping", nil)
+
+		if test.JWT != "" {
+			// Write authorization token in header
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.JWT))
+		}
+
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+	}
+
+}
+
+func TestPostGeoPoint(t *testing.T) {
+	tests := []struct {
+		SoundPath   string
+		PicturePath string
+		GeoPoint    geopoint.AddGeoPoint
+		JWT         string
+		StatusCode  int
+	}{
+		{"../testassets/merle.aac", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.1, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusOK},
+		{"../testassets/merle.aac", "", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(100), PictureTemplate: "clearing"}, standardToken, http.StatusOK},
+		{"../testassets/merle.aac", "", geopoint.AddGeoPoint{Title: "Mountain by day", Latitude: 1.0, Longitude: 1.3, Date: time.Now(), Amplitudes: newAmplitudes(100), PictureTemplate: "desert"}, standardToken, http.StatusOK},
+		{"../testassets/merle.aac", "", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
+		{"../testassets/merle.aac", "../testassets/russie.jpg", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.1, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
+		{"../testassets/merle.wav", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.1, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
+		{"../testassets/merle.aac", "", geopoint.AddGeoPoint{Title: "Lake by day", Latitude: 1.0, Longitude: 1.3, Date: time.Now(), Amplitudes: newAmplitudes(100), PictureTemplate: retiredTemplate.Name}, standardToken, http.StatusBadRequest},
+		{"../testassets/merle.aac", "", geopoint.AddGeoPoint{Title: "Lake by day", Latitude: 1.0, Longitude: 1.3, Date: time.Now(), Amplitudes: newAmplitudes(100), PictureTemplate: "unknown"}, standardToken, http.StatusBadRequest},
+		{"../testassets/merle.aac", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Fo", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
+		{"../testassets/merle.aac", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night very late at night", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
+		{"../testassets/merle.aac", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 100000001.0, Longitude: 1000000000.2, Date: time.Now(), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
+		{"../testassets/merle.aac", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.2, Date: time.Now().Add(200000 * time.Hour), Amplitudes: newAmplitudes(100)}, standardToken, http.StatusBadRequest},
+		{"../testassets/merle.aac", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(1)}, standardToken, http.StatusBadRequest},
+		{"../testassets/merle.aac", "../main.go", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(1)}, standardToken, http.StatusBadRequest},
+		{"../main.go", "../testassets/russie.webp", geopoint.AddGeoPoint{Title: "Forest by night", Latitude: 1.0, Longitude: 1.2, Date: time.Now(), Amplitudes: newAmplitudes(1)}, standardToken, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		userBytes, err := json.Marshal(test.GeoPoint)
+		if err != nil {
+			t.Error(err)
+		}
+		values := map[string]io.Reader{
+			"sound":    mustOpen(test.SoundPath),
+			"geopoint": strings.NewReader(string(userBytes)),
+		}
+		if test.PicturePath != "" {
+			values["picture"] = mustOpen(test.PicturePath)
+		}
+
+		w := httptest.NewRecorder()
+		req, err := buildFormData(values, "/api/v1/restricted/geopoint")
+		if err != nil {
+			t.Error(err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.JWT))
+
+		r.ServeHTTP(w, req)
+		fmt.Println(w.Body.String())
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.StatusCode == http.StatusOK {
+			var got geopoint.GeoPoint
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Error(err)
+			}
+			file, err := c.store.Open(context.Background(), storage.SoundKey(got.Sound))
+			if err != nil {
+				t.Errorf("sound was not saved: %s", err)
+			} else {
+				file.Close()
+			}
+			assert.Equal(t, c.store.URL(storage.SoundKey(got.Sound)), got.SoundUrl)
+		}
+	}
+}
+
+func TestPostGeoPointFailures(t *testing.T) {
+	store := c.store
+	defer func() { c.store = store }()
+
+	c.Db.MustExec("ALTER TABLE geopoints ADD CONSTRAINT failing_insert CHECK (title <> 'Failing insert')")
+	defer c.Db.MustExec("ALTER TABLE geopoints DROP CONSTRAINT failing_insert")
+
+	tests := []struct {
+		Title    string
+		FailSave string
+		FailMove string
+	}{
+		{"Failing sound", storage.SoundFolder, ""},
+		{"Failing picture", storage.PictureFolder, ""},
+		{"Failing move", "", storage.PictureFolder},
+		{"Failing insert", "", ""},
+	}
+
+	for _, test := range tests {
+		failing := &failingStore{Storage: store, failSave: test.FailSave, failMove: test.FailMove}
+		c.store = failing
+
+		addGeo := geopoint.AddGeoPoint{Title: test.Title, Latitude: 1.0, Longitude: 1.6, Date: time.Now(), Amplitudes: newAmplitudes(100)}
+		geoBytes, _ := json.Marshal(addGeo)
+		// identical assets would already be stored
+		values := map[string]io.Reader{
+			"sound":    mustOpen(uniqueFile(t, "../testassets/merle.aac")),
+			"picture":  mustOpen(uniqueFile(t, "../testassets/russie.webp")),
+			"geopoint": strings.NewReader(string(geoBytes)),
+		}
+
+		w := httptest.NewRecorder()
+		req, err := buildFormData(values, "/api/v1/restricted/geopoint")
+		if err != nil {
+			t.Error(err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", standardToken))
+
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+		var count int
+		if err := c.Db.Get(&count, "SELECT COUNT(*) FROM geopoints WHERE title = $1", test.Title); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, 0, count)
+
+		for _, key := range failing.saved {
+			// staging/<id>/<key>
+			for _, k := range []string{key, strings.SplitN(key, "/", 3)[2]} {
+				_, err := store.Open(context.Background(), k)
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("%s was not cleaned after %q: %v", k, test.Title, err)
+				}
+			}
+		}
+	}
+}
+
+func TestDeduplicatedAssets(t *testing.T) {
+	soundPath := uniqueFile(t, "../testassets/merle.aac")
+	content, _ := ioutil.ReadFile(soundPath)
+	checksum := sha256.Sum256(content)
+	soundChecksum := hex.EncodeToString(checksum[:])
+
+	tests := []struct {
+		Checksum   string
+		StatusCode int
+	}{
+		{strings.Repeat("0", 64), http.StatusBadRequest},
+		{soundChecksum, http.StatusOK},
+		{"", http.StatusOK},
+	}
+
+	created := make([]geopoint.GeoPoint, 0)
+	for _, test := range tests {
+		addGeo := geopoint.AddGeoPoint{Title: "Shared sound", Latitude: 1.0, Longitude: 1.7, Date: time.Now(), Amplitudes: newAmplitudes(100), PictureTemplate: templates[0].Name, SoundChecksum: test.Checksum}
+		geoBytes, _ := json.Marshal(addGeo)
+		values := map[string]io.Reader{
+			"sound":    mustOpen(soundPath),
+			"geopoint": strings.NewReader(string(geoBytes)),
+		}
+
+		w := httptest.NewRecorder()
+		req, err := buildFormData(values, "/api/v1/restricted/geopoint")
+		if err != nil {
+			t.Error(err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", standardToken))
+
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.StatusCode == http.StatusOK {
+			var got geopoint.GeoPoint
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, soundChecksum+".aac", got.Sound)
+			assert.Equal(t, soundChecksum, got.SoundChecksum)
+			assert.Equal(t, int64(len(content)), got.SoundSize)
+			created = append(created, got)
+		}
+	}
+
+	c.Db.MustExec("UPDATE geopoints SET available = TRUE WHERE id = $1", created[0].Id)
+	defer c.Db.MustExec("DELETE FROM geopoints WHERE id = $1", created[0].Id)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/geopoint/%d/assets", created[0].Id), nil)
+	r.ServeHTTP(w, req)
+	var assets geopoint.Assets
+	if err := json.Unmarshal(w.Body.Bytes(), &assets); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, soundChecksum, assets.SoundChecksum)
+
+	// the sound is kept as long as a geopoint uses it
+	for i, toDelete := range created {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("/api/v1/restricted/geopoint/%d", toDelete.Id), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", adminToken))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		_, err := c.store.Stat(context.Background(), storage.SoundKey(toDelete.Sound))
+		assert.Equal(t, i == len(created)-1, errors.Is(err, os.ErrNotExist))
+	}
+
+	// pictures of templates are never removed with a geopoint
+	file, err := c.store.Open(context.Background(), storage.PictureKey(templates[0].Picture))
+	if err == nil {
+		file.Close()
+	}
+	assert.Equal(t, false, errors.Is(err, os.ErrNotExist))
+}
+
+func TestDuplicateGeoPoint(t *testing.T) {
+	// the fingerprint is computed from the sound whatever the amplitudes sent,
+	// the frames are reordered so that the sounds differ from the ones of the other tests
+	amplitudes := newAmplitudes(200)
+	original := reorderedFrames(t, "../testassets/merle.aac", true)
+	sharedSound := uniqueFile(t, reorderedFrames(t, "../testassets/merle.aac", false))
+
+	tests := []struct {
+		Title       string
+		Amplitudes  []float64
+		Sound       string
+		DuplicateOf int
+	}{
+		{"Original", amplitudes, uniqueFile(t, original), 0},
+		{"Copy", newAmplitudes(200), uniqueFile(t, original), 1},
+		{"Other", amplitudes, sharedSound, 0},
+		{"Same sound", newAmplitudes(200), sharedSound, 3},
+	}
+
+	created := make([]geopoint.GeoPoint, 0)
+	for _, test := range tests {
+		addGeo := geopoint.AddGeoPoint{Title: test.Title, Latitude: 1.0, Longitude: 1.7, Date: time.Now(), Amplitudes: test.Amplitudes, PictureTemplate: templates[0].Name}
+		geoBytes, _ := json.Marshal(addGeo)
+		values := map[string]io.Reader{
+			"sound":    mustOpen(test.Sound),
+			"geopoint": strings.NewReader(string(geoBytes)),
+		}
+
+		w := httptest.NewRecorder()
+		req, err := buildFormData(values, "/api/v1/restricted/geopoint")
+		if err != nil {
+			t.Error(err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", standardToken))
+
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var got geopoint.GeoPoint
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Error(err)
+		}
+		defer c.Db.MustExec("DELETE FROM geopoints WHERE id = $1", got.Id)
+		created = append(created, got)
+
+		if test.DuplicateOf == 0 {
+			assert.Equal(t, (*int)(nil), got.DuplicateOf)
+		} else if got.DuplicateOf == nil {
+			t.Errorf("%s was not detected as a duplicate", test.Title)
+		} else {
+			assert.Equal(t, created[test.DuplicateOf-1].Id, *got.DuplicateOf)
+		}
+	}
+
+	// moderators see the original of the duplicate
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/restricted/geopoint/%d", created[1].Id), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", adminToken))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var got geopoint.GeoPoint
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Error(err)
+	}
+	if got.DuplicateOf == nil {
+		t.Error("duplicate is not shown to moderators")
+	} else {
+		assert.Equal(t, created[0].Id, *got.DuplicateOf)
+	}
+}
+
+func TestGetSimilarGeoPoints(t *testing.T) {
+	// the fixtures are inserted without features
+	if err := c.computeFeatures(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Query      string
+		StatusCode int
+		Similar    []int
+	}{
+		{fmt.Sprintf("/api/v1/geopoint/%d/similar", availableGeoPoint1.Id), http.StatusOK, []int{availableGeoPoint2.Id}},
+		{fmt.Sprintf("/api/v1/geopoint/%d/similar?distance=200000", availableGeoPoint1.Id), http.StatusOK, []int{availableGeoPoint2.Id}},
+		{fmt.Sprintf("/api/v1/geopoint/%d/similar?distance=1000", availableGeoPoint1.Id), http.StatusOK, []int{}},
+		{fmt.Sprintf("/api/v1/geopoint/%d/similar?limit=0", availableGeoPoint1.Id), http.StatusBadRequest, nil},
+		{fmt.Sprintf("/api/v1/geopoint/%d/similar?distance=-1", availableGeoPoint1.Id), http.StatusBadRequest, nil},
+		{fmt.Sprintf("/api/v1/geopoint/%d/similar", unavailableGeoPoint.Id), http.StatusForbidden, nil},
+		{"/api/v1/geopoint/1000/similar", http.StatusNotFound, nil},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, test.Query, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.StatusCode == http.StatusOK {
+			var similar []geopoint.SimilarGeoPoint
+			if err := json.Unmarshal(w.Body.Bytes(), &similar); err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, len(test.Similar), len(similar))
+			for i, geoPoint := range similar {
+				assert.Equal(t, test.Similar[i], geoPoint.Id)
+				assert.Equal(t, true, geoPoint.Similarity >= -1.0001 && geoPoint.Similarity <= 1.0001)
+			}
+		}
+	}
+
+	// a recording is the most similar to a louder copy of itself
+	features := geopoint.Features(availableGeoPoint1.Amplitudes)
+	louder := make([]float64, len(availableGeoPoint1.Amplitudes))
+	for i, amplitude := range availableGeoPoint1.Amplitudes {
+		louder[i] = 3 * amplitude
+	}
+	var similarity float64
+	for i, value := range geopoint.Features(louder) {
+		similarity += value * features[i]
+	}
+	assert.Equal(t, true, similarity > 0.9999)
+}
+
+func TestLocationPrivacy(t *testing.T) {
+	tests := []struct {
+		Privacy    string
+		StatusCode int
+		Latitude   float64
+		Longitude  float64
+		MaxOffset  float64
+	}{
+		{"", http.StatusOK, 45.123, 6.871, 0},
+		{geopoint.Precise, http.StatusOK, 45.123, 6.871, 0},
+		{geopoint.Approximate, http.StatusOK, 45.123, 6.871, 1000 / 111320. / math.Cos(45.123*math.Pi/180)},
+		{geopoint.Coarse, http.StatusOK, 45.15, 6.85, 0},
+		{"secret", http.StatusBadRequest, 0, 0, 0},
+	}
+
+	for _, test := range tests {
+		addGeo := geopoint.AddGeoPoint{Title: "Private garden", Latitude: 45.123, Longitude: 6.871, Date: time.Now(), Amplitudes: newAmplitudes(100), PictureTemplate: templates[0].Name, Privacy: test.Privacy}
+		w := postGeoPoint(t, addGeo)
+		assert.Equal(t, test.StatusCode, w.Code)
+		if test.StatusCode != http.StatusOK {
+			continue
+		}
+
+		var created geopoint.GeoPoint
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+			t.Error(err)
+		}
+		defer c.Db.MustExec("DELETE FROM geopoints WHERE id = $1", created.Id)
+		c.Db.MustExec("UPDATE geopoints SET available = TRUE WHERE id = $1", created.Id)
+
+		public := getGeoPoint(t, created.Id, "")
+		assert.Equal(t, true, math.Abs(public.Latitude-test.Latitude) <= test.MaxOffset+1e-9)
+		assert.Equal(t, true, math.Abs(public.Longitude-test.Longitude) <= test.MaxOffset+1e-9)
+
+		precise := getGeoPoint(t, created.Id, adminToken)
+		assert.Equal(t, addGeo.Latitude, precise.Latitude)
+		assert.Equal(t, addGeo.Longitude, precise.Longitude)
+	}
+}
+
+func TestPrivacyZones(t *testing.T) {
+	square := func(lon, lat, size float64) zone.Polygon {
+		return zone.Polygon{Type: "Polygon", Coordinates: [][][2]float64{{{lon, lat}, {lon + size, lat}, {lon + size, lat + size}, {lon, lat + size}, {lon, lat}}}}
+	}
+
+	tests := []struct {
+		AddZone    zone.AddZone
+		StatusCode int
+	}{
+		{zone.AddZone{Name: "Open ring", Area: zone.Polygon{Type: "Polygon", Coordinates: [][][2]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 1}}}}}, http.StatusBadRequest},
+		{zone.AddZone{Name: "Not a ring", Area: zone.Polygon{Type: "Polygon", Coordinates: [][][2]float64{{{0, 0}, {1, 0}, {0, 0}}}}}, http.StatusBadRequest},
+		{zone.AddZone{Name: "Point", Area: zone.Polygon{Type: "Point", Coordinates: square(0, 0, 1).Coordinates}}, http.StatusBadRequest},
+		{zone.AddZone{Name: "Out of earth", Area: square(179.5, 0, 1)}, http.StatusBadRequest},
+		{zone.AddZone{Name: "Heronry", Area: square(1.01, 0.99, 0.02)}, http.StatusOK},
+	}
+
+	// the geopoint was located near its precise location
+	defer c.Db.MustExec("TRUNCATE TABLE localities")
+	defer c.Db.MustExec("UPDATE geopoints SET locality = '', region = '', country = '', country_code = '', timezone = '' WHERE id = $1", availableGeoPoint1.Id)
+	c.Db.MustExec(database.PostLocality, 1, "Heron village", "Maritime", "Togo", "TG", 100, "Africa/Lome", availableGeoPoint1.Location.Y, availableGeoPoint1.Location.X)
+	c.Db.MustExec(database.PostLocality, 2, "Coarse town", "Maritime", "Togo", "TG", 100, "Africa/Lome", 1.05, 1.05)
+	c.Db.MustExec(database.LocateGeoPoint, availableGeoPoint1.Id)
+	assert.Equal(t, "Heron village", getGeoPoint(t, availableGeoPoint1.Id, adminToken).Locality)
+
+	var created zone.Zone
+	for _, test := range tests {
+		body, _ := json.Marshal(test.AddZone)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/restricted/zone", bytes.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", adminToken))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.StatusCode == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, test.AddZone.Name, created.Name)
+		}
+	}
+	defer c.refreshGeoJson()
+	defer c.Db.MustExec("UPDATE geopoints SET public_location = location WHERE id = $1", availableGeoPoint1.Id)
+
+	// the geopoint already recorded in the zone is generalized
+	public := getGeoPoint(t, availableGeoPoint1.Id, "")
+	assert.Equal(t, true, math.Abs(public.Latitude-1.05) < 1e-9)
+	assert.Equal(t, true, math.Abs(public.Longitude-1.05) < 1e-9)
+	precise := getGeoPoint(t, availableGeoPoint1.Id, adminToken)
+	assert.Equal(t, availableGeoPoint1.Location.Y, precise.Latitude)
+	// and located again from its public location
+	assert.Equal(t, "Coarse town", public.Locality)
+
+	// and so are the new ones, even when they are precise
+	addGeo := geopoint.AddGeoPoint{Title: "Heron nest", Latitude: 1.003, Longitude: 1.022, Date: time.Now(), Amplitudes: newAmplitudes(100), PictureTemplate: templates[0].Name, Privacy: geopoint.Precise}
+	w := postGeoPoint(t, addGeo)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var geoPoint geopoint.GeoPoint
+	if err := json.Unmarshal(w.Body.Bytes(), &geoPoint); err != nil {
+		t.Error(err)
+	}
+	defer c.Db.MustExec("DELETE FROM geopoints WHERE id = $1", geoPoint.Id)
+	c.Db.MustExec("UPDATE geopoints SET available = TRUE WHERE id = $1", geoPoint.Id)
+	public = getGeoPoint(t, geoPoint.Id, "")
+	assert.Equal(t, true, math.Abs(public.Latitude-1.05) < 1e-9)
+	assert.Equal(t, true, math.Abs(public.Longitude-1.05) < 1e-9)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/restricted/zone", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", adminToken))
+	r.ServeHTTP(w, req)
+	var zones []zone.Zone
+	if err := json.Unmarshal(w.Body.Bytes(), &zones); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, 1, len(zones))
+
+	for _, statusCode := range []int{http.StatusOK, http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("/api/v1/restricted/zone/%d", created.Id), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", adminToken))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, statusCode, w.Code)
+	}
+
+	// forbidden to standard users
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/api/v1/restricted/zone", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", standardToken))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+const (
+	testCities = "# geonameid\tname\tasciiname\talternatenames\tlatitude\tlongitude\tfeature class\tfeature code\tcountry code\tcc2\tadmin1 code\tadmin2 code\tadmin3 code\tadmin4 code\tpopulation\televation\tdem\ttimezone\tmodification date\n" +
+		"3027301\tChamonix-Mont-Blanc\tChamonix-Mont-Blanc\t\t45.92375\t6.86933\tP\tPPL\tFR\t\t84\t74\t742\t74056\t8906\t\t1038\tEurope/Paris\t2019-03-26\n" +
+		"2659836\tMartigny-Ville\tMartigny-Ville\t\t46.10276\t7.07305\tP\tPPL\tCH\t\tVS\t\t\t\t15000\t\t471\tEurope/Zurich\t2018-02-28\n" +
+		"2363079\tLomé\tLome\t\t1.1\t1.05\tP\tPPLC\tTG\t\t24\t\t\t\t749700\t\t35\tAfrica/Lome\t2019-09-05\n" +
+		"3027302\tAiguille du Midi\tAiguille du Midi\t\t45.87865\t6.88763\tT\tPK\tFR\t\t84\t\t\t\t0\t3842\t3700\tEurope/Paris\t2012-01-17\n"
+	testCountries = "#ISO\tISO3\tISO-Numeric\tfips\tCountry\n" +
+		"FR\tFRA\t250\tFR\tFrance\n" +
+		"CH\tCHE\t756\tSZ\tSwitzerland\n" +
+		"TG\tTGO\t768\tTO\tTogo\n"
+	testRegions = "FR.84\tAuvergne-Rhône-Alpes\tAuvergne-Rhone-Alpes\t11071625\n" +
+		"CH.VS\tValais\tValais\t2658205\n" +
+		"TG.24\tMaritime\tMaritime\t2365210\n"
+)
+
+func TestGazetteer(t *testing.T) {
+	defer c.Db.MustExec("TRUNCATE TABLE localities")
+	defer c.Db.MustExec("UPDATE geopoints SET locality = '', region = '', country = '', country_code = ''")
+
+	// no locality while the gazetteer is not imported, the timezone approximated from the longitude
+	// is an hour behind the one of Chamonix in summer
+	midnight, _ := time.Parse(time.RFC3339, "2022-05-31T23:00:00Z")
+	addGeo := geopoint.AddGeoPoint{Title: "Glacier", Latitude: 45.91, Longitude: 6.89, Date: midnight, Amplitudes: newAmplitudes(100), PictureTemplate: templates[0].Name}
+	w := postGeoPoint(t, addGeo)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var before geopoint.GeoPoint
+	if err := json.Unmarshal(w.Body.Bytes(), &before); err != nil {
+		t.Error(err)
+	}
+	defer c.Db.MustExec("DELETE FROM geopoints WHERE id = $1", before.Id)
+	assert.Equal(t, "", before.Locality)
+	assert.Equal(t, 5, before.Month)
+
+	if _, err := c.ImportGazetteer(strings.NewReader("1\tshort line\n"), strings.NewReader(testCountries), strings.NewReader(testRegions)); err == nil {
+		t.Error("malformed gazetteer was imported")
+	}
+
+	count, err := c.ImportGazetteer(strings.NewReader(testCities), strings.NewReader(testCountries), strings.NewReader(testRegions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, count)
+
+	tests := []struct {
+		Latitude  float64
+		Longitude float64
+		Place     geopoint.Place
+	}{
+		{45.91, 6.89, geopoint.Place{Locality: "Chamonix-Mont-Blanc", Region: "Auvergne-Rhône-Alpes", Country: "France", CountryCode: "FR", Timezone: "Europe/Paris"}},
+		{46.08, 7.05, geopoint.Place{Locality: "Martigny-Ville", Region: "Valais", Country: "Switzerland", CountryCode: "CH", Timezone: "Europe/Zurich"}},
+	}
+
+	for _, test := range tests {
+		addGeo := geopoint.AddGeoPoint{Title: "Alpine meadow", Latitude: test.Latitude, Longitude: test.Longitude, Date: time.Now(), Amplitudes: newAmplitudes(100), PictureTemplate: templates[0].Name}
+		w := postGeoPoint(t, addGeo)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var created geopoint.GeoPoint
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+			t.Error(err)
+		}
+		defer c.Db.MustExec("DELETE FROM geopoints WHERE id = $1", created.Id)
+		assert.Equal(t, test.Place, created.Place)
+		assert.Equal(t, test.Place, getGeoPoint(t, created.Id, adminToken).Place)
+	}
+
+	// the geopoints created before the import are located too, in their local day
+	located := getGeoPoint(t, before.Id, adminToken)
+	assert.Equal(t, tests[0].Place, located.Place)
+	assert.Equal(t, 6, located.Month)
+	assert.Equal(t, "summer", located.Season)
+	assert.Equal(t, "Togo", getGeoPoint(t, availableGeoPoint1.Id, "").Country)
+
+	bytesGeoJson, err := ioutil.ReadFile(c.geoJsonPath)
+	if err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, true, strings.Contains(string(bytesGeoJson), "Lomé"))
+
+	closestTests := []struct {
+		Country    string
+		StatusCode int
+	}{
+		{"TG", http.StatusOK},
+		{"FR", http.StatusNotFound},
+		{"fr", http.StatusBadRequest},
+	}
+	for _, test := range closestTests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/geopoint/closest/to/1.0/1.0?country="+test.Country, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+	}
+}
+
+func TestSolarContext(t *testing.T) {
+	tests := []struct {
+		Date      string
+		Latitude  float64
+		Longitude float64
+		Solar     geopoint.Solar
+		Timezone  string
+	}{
+		{"2022-05-15T04:00:00Z", 45.92, 6.87, geopoint.Solar{Phase: "dawn", Season: "spring", Hemisphere: "north", Month: 5}, "Etc/GMT"},
+		{"2022-05-15T11:30:00Z", 45.92, 6.87, geopoint.Solar{Phase: "day", Season: "spring", Hemisphere: "north", Month: 5}, "Etc/GMT"},
+		{"2022-05-15T19:30:00Z", 45.92, 6.87, geopoint.Solar{Phase: "dusk", Season: "spring", Hemisphere: "north", Month: 5}, "Etc/GMT"},
+		{"2022-05-31T21:30:00Z", 45.92, 6.87, geopoint.Solar{Phase: "night", Season: "spring", Hemisphere: "north", Month: 5}, "Etc/GMT"},
+		{"2022-05-31T23:30:00Z", -33.9, 18.4, geopoint.Solar{Phase: "night", Season: "winter", Hemisphere: "south", Month: 6}, "Etc/GMT-1"},
+	}
+
+	created := make([]geopoint.GeoPoint, 0)
+	for _, test := range tests {
+		date, _ := time.Parse(time.RFC3339, test.Date)
+		addGeo := geopoint.AddGeoPoint{Title: "Chorus", Latitude: test.Latitude, Longitude: test.Longitude, Date: date, Amplitudes: newAmplitudes(100), PictureTemplate: templates[0].Name}
+		w := postGeoPoint(t, addGeo)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var geoPoint geopoint.GeoPoint
+		if err := json.Unmarshal(w.Body.Bytes(), &geoPoint); err != nil {
+			t.Error(err)
+		}
+		defer c.Db.MustExec("DELETE FROM geopoints WHERE id = $1", geoPoint.Id)
+		c.Db.MustExec("UPDATE geopoints SET available = TRUE WHERE id = $1", geoPoint.Id)
+		created = append(created, geoPoint)
+
+		assert.Equal(t, test.Timezone, geoPoint.Timezone)
+		test.Solar.SunElevation = geoPoint.SunElevation
+		assert.Equal(t, test.Solar, geoPoint.Solar)
+		assert.Equal(t, test.Solar, getGeoPoint(t, geoPoint.Id, "").Solar)
+	}
+	assert.Equal(t, true, created[1].SunElevation > 60 && created[1].SunElevation < 65)
+
+	// the sun of a coarse geopoint is placed at its public location, not the precise one
+	date, _ := time.Parse(time.RFC3339, tests[0].Date)
+	w := postGeoPoint(t, geopoint.AddGeoPoint{Title: "Chorus", Latitude: 45.92, Longitude: 6.87, Date: date, Amplitudes: newAmplitudes(100), PictureTemplate: templates[0].Name, Privacy: geopoint.Coarse})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var coarse geopoint.GeoPoint
+	if err := json.Unmarshal(w.Body.Bytes(), &coarse); err != nil {
+		t.Error(err)
+	}
+	defer c.Db.MustExec("DELETE FROM geopoints WHERE id = $1", coarse.Id)
+	latitude, longitude := geopoint.PublicLocation(45.92, 6.87, geopoint.Coarse)
+	elevation, _ := solar.Position(date, latitude, longitude)
+	assert.Equal(t, elevation, coarse.SunElevation)
+	assert.NotEqual(t, created[0].SunElevation, coarse.SunElevation)
+
+	searchTests := []struct {
+		Query      string
+		StatusCode int
+		Found      []int
+	}{
+		{"?phase=dawn&month=5", http.StatusOK, []int{created[0].Id}},
+		{"?phase=dawn&bbox=-10&bbox=35&bbox=30&bbox=60", http.StatusOK, []int{created[0].Id}},
+		{"?phase=dawn&bbox=-80&bbox=35&bbox=-60&bbox=60", http.StatusOK, []int{}},
+		{"?season=winter", http.StatusOK, []int{created[4].Id}},
+		{"?phase=night&month=5", http.StatusOK, []int{created[3].Id}},
+		{"?month=5&limit=2", http.StatusOK, []int{created[3].Id, created[2].Id}},
+		{"?phase=noon", http.StatusBadRequest, nil},
+		{"?month=13", http.StatusBadRequest, nil},
+		{"?bbox=1&bbox=2&bbox=3", http.StatusBadRequest, nil},
+	}
+
+	for _, test := range searchTests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/geopoint/search"+test.Query, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.StatusCode == http.StatusOK {
+			var found []geopoint.FoundGeoPoint
+			if err := json.Unmarshal(w.Body.Bytes(), &found); err != nil {
+				t.Error(err)
+			}
+			ids := make([]int, 0)
+			for _, geoPoint := range found {
+				ids = append(ids, geoPoint.Id)
+			}
+			assert.Equal(t, test.Found, ids)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/geopoint/closest/to/45.9/6.8?phase=dusk", nil)
+	r.ServeHTTP(w, req)
+	var closest geopoint.ClosestGeoId
+	if err := json.Unmarshal(w.Body.Bytes(), &closest); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, created[2].Id, closest.Id)
+}
+
+func TestWalks(t *testing.T) {
+	defer c.Db.MustExec("TRUNCATE TABLE walks, walk_geopoints RESTART IDENTITY")
+
+	tests := []struct {
+		Token      string
+		AddWalk    walk.AddWalk
+		StatusCode int
+	}{
+		{standardToken, walk.AddWalk{Title: "Along the river", Description: "From the bridge", GeoPoints: []int64{int64(availableGeoPoint1.Id), int64(availableGeoPoint2.Id)}}, http.StatusOK},
+		{adminToken, walk.AddWalk{Title: "Back home", GeoPoints: []int64{int64(availableGeoPoint2.Id), int64(availableGeoPoint1.Id)}}, http.StatusOK},
+		{standardToken, walk.AddWalk{Title: "Disabled", GeoPoints: []int64{int64(availableGeoPoint1.Id), int64(unavailableGeoPoint.Id)}}, http.StatusBadRequest},
+		{standardToken, walk.AddWalk{Title: "Missing", GeoPoints: []int64{int64(availableGeoPoint1.Id), 1000}}, http.StatusBadRequest},
+		{standardToken, walk.AddWalk{Title: "Twice", GeoPoints: []int64{int64(availableGeoPoint1.Id), int64(availableGeoPoint1.Id)}}, http.StatusBadRequest},
+		{standardToken, walk.AddWalk{Title: "Alone", GeoPoints: []int64{int64(availableGeoPoint1.Id)}}, http.StatusBadRequest},
+		{"", walk.AddWalk{Title: "Anonymous", GeoPoints: []int64{int64(availableGeoPoint1.Id), int64(availableGeoPoint2.Id)}}, http.StatusUnauthorized},
+	}
+
+	created := make([]walk.Walk, 0)
+	for _, test := range tests {
+		body, _ := json.Marshal(test.AddWalk)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/restricted/walk", bytes.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.Token))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.StatusCode == http.StatusOK {
+			var got walk.Walk
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, test.AddWalk.Title, got.Title)
+			assert.Equal(t, test.AddWalk.GeoPoints, []int64(got.GeoPoints))
+			// about 157 km between the fixtures
+			assert.Equal(t, true, got.Length > 150000 && got.Length < 160000)
+			created = append(created, got)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/walk", nil)
+	r.ServeHTTP(w, req)
+	var walks []walk.Walk
+	if err := json.Unmarshal(w.Body.Bytes(), &walks); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, 2, len(walks))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/walk/%d/geojson", created[0].Id), nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var geoJson struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &geoJson); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, "FeatureCollection", geoJson.Type)
+	assert.Equal(t, 3, len(geoJson.Features))
+	assert.Equal(t, "LineString", geoJson.Features[0].Geometry.Type)
+	assert.Equal(t, "Point", geoJson.Features[1].Geometry.Type)
+	assert.Equal(t, float64(availableGeoPoint1.Id), geoJson.Features[1].Properties["id"])
+	assert.Equal(t, float64(availableGeoPoint2.Id), geoJson.Features[2].Properties["id"])
+
+	// a walk left with a single enabled stop has no line
+	c.Db.MustExec("UPDATE geopoints SET available = FALSE WHERE id = $1", availableGeoPoint2.Id)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/walk/%d/geojson", created[0].Id), nil)
+	r.ServeHTTP(w, req)
+	c.Db.MustExec("UPDATE geopoints SET available = TRUE WHERE id = $1", availableGeoPoint2.Id)
+	assert.Equal(t, http.StatusOK, w.Code)
+	geoJson.Features = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &geoJson); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, 1, len(geoJson.Features))
+	assert.Equal(t, "Point", geoJson.Features[0].Geometry.Type)
+	assert.Equal(t, float64(availableGeoPoint1.Id), geoJson.Features[0].Properties["id"])
+
+	updateTests := []struct {
+		Method     string
+		Token      string
+		Id         int
+		StatusCode int
+	}{
+		{http.MethodPut, standardToken, created[1].Id, http.StatusForbidden},
+		{http.MethodPut, standardToken, created[0].Id, http.StatusOK},
+		{http.MethodPut, adminToken, created[0].Id, http.StatusOK},
+		{http.MethodPut, adminToken, 1000, http.StatusNotFound},
+		{http.MethodDelete, standardToken, created[1].Id, http.StatusForbidden},
+		{http.MethodDelete, adminToken, created[0].Id, http.StatusOK},
+		{http.MethodDelete, adminToken, created[0].Id, http.StatusNotFound},
+	}
+
+	for _, test := range updateTests {
+		body, _ := json.Marshal(walk.AddWalk{Title: "Renamed walk", GeoPoints: []int64{int64(availableGeoPoint2.Id), int64(availableGeoPoint1.Id)}})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.Method, fmt.Sprintf("/api/v1/restricted/walk/%d", test.Id), bytes.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.Token))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.Method == http.MethodPut && test.StatusCode == http.StatusOK {
+			var got walk.Walk
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, "Renamed walk", got.Title)
+			assert.Equal(t, []int64{int64(availableGeoPoint2.Id), int64(availableGeoPoint1.Id)}, []int64(got.GeoPoints))
+		}
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/walk/%d", created[0].Id), nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestFavourites(t *testing.T) {
+	defer c.Db.MustExec("TRUNCATE TABLE favourites")
+
+	tests := []struct {
+		Method     string
+		Token      string
+		GeoId      int
+		StatusCode int
+	}{
+		{http.MethodPut, standardToken, availableGeoPoint1.Id, http.StatusOK},
+		{http.MethodPut, standardToken, availableGeoPoint1.Id, http.StatusOK},
+		{http.MethodPut, adminToken, availableGeoPoint1.Id, http.StatusOK},
+		{http.MethodPut, standardToken, availableGeoPoint2.Id, http.StatusOK},
+		{http.MethodPut, standardToken, unavailableGeoPoint.Id, http.StatusNotFound},
+		{http.MethodPut, standardToken, 1000, http.StatusNotFound},
+		{http.MethodDelete, standardToken, availableGeoPoint2.Id, http.StatusOK},
+		{http.MethodDelete, standardToken, availableGeoPoint2.Id, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.Method, fmt.Sprintf("/api/v1/restricted/favourite/%d", test.GeoId), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.Token))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+	}
+
+	assert.Equal(t, 2, getGeoPoint(t, availableGeoPoint1.Id, "").Favourites)
+	assert.Equal(t, 0, getGeoPoint(t, availableGeoPoint2.Id, "").Favourites)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/restricted/favourite", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", standardToken))
+	r.ServeHTTP(w, req)
+	var favourites playlist.Favourites
+	if err := json.Unmarshal(w.Body.Bytes(), &favourites); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, []int64{int64(availableGeoPoint1.Id)}, []int64(favourites.GeoPoints))
+}
+
+func TestPlaylists(t *testing.T) {
+	defer c.Db.MustExec("TRUNCATE TABLE playlists, playlist_geopoints RESTART IDENTITY")
+	geo1, geo2 := int64(availableGeoPoint1.Id), int64(availableGeoPoint2.Id)
+
+	tests := []struct {
+		Method     string
+		Path       string
+		Token      string
+		Body       interface{}
+		StatusCode int
+		GeoPoints  []int64
+	}{
+		{http.MethodPost, "", standardToken, playlist.AddPlaylist{Name: "Dawn", GeoPoints: []int64{geo1, geo2}}, http.StatusOK, []int64{geo1, geo2}},
+		{http.MethodPost, "", standardToken, playlist.AddPlaylist{Name: "Dawn"}, http.StatusConflict, nil},
+		{http.MethodPost, "", standardToken, playlist.AddPlaylist{Name: "Disabled", GeoPoints: []int64{int64(unavailableGeoPoint.Id)}}, http.StatusBadRequest, nil},
+		{http.MethodPost, "", standardToken, playlist.AddPlaylist{Name: "Twice", GeoPoints: []int64{geo1, geo1}}, http.StatusBadRequest, nil},
+		{http.MethodPost, "", adminToken, playlist.AddPlaylist{Name: "Dawn"}, http.StatusOK, []int64{}},
+		{http.MethodGet, "/1", adminToken, nil, http.StatusForbidden, nil},
+		{http.MethodPut, fmt.Sprintf("/1/geopoint/%d", geo1), standardToken, nil, http.StatusConflict, nil},
+		{http.MethodPut, fmt.Sprintf("/1/geopoint/%d", unavailableGeoPoint.Id), standardToken, nil, http.StatusNotFound, nil},
+		{http.MethodPut, "/1/order", standardToken, playlist.OrderPlaylist{GeoPoints: []int64{geo2, geo1}}, http.StatusOK, []int64{geo2, geo1}},
+		{http.MethodPut, "/1/order", standardToken, playlist.OrderPlaylist{GeoPoints: []int64{geo2}}, http.StatusBadRequest, nil},
+		{http.MethodPut, "/1/order", standardToken, playlist.OrderPlaylist{GeoPoints: []int64{geo2, 1000}}, http.StatusBadRequest, nil},
+		{http.MethodPatch, "/1", standardToken, playlist.RenamePlaylist{Name: "Dusk"}, http.StatusOK, []int64{geo2, geo1}},
+		{http.MethodDelete, fmt.Sprintf("/1/geopoint/%d", geo2), standardToken, nil, http.StatusOK, []int64{geo1}},
+		{http.MethodDelete, fmt.Sprintf("/1/geopoint/%d", geo2), standardToken, nil, http.StatusNotFound, nil},
+		{http.MethodPut, fmt.Sprintf("/1/geopoint/%d", geo2), standardToken, nil, http.StatusOK, []int64{geo1, geo2}},
+		{http.MethodGet, "/1", standardToken, nil, http.StatusOK, []int64{geo1, geo2}},
+		{http.MethodDelete, "/2", standardToken, nil, http.StatusForbidden, nil},
+		{http.MethodDelete, "/2", adminToken, nil, http.StatusOK, nil},
+		{http.MethodGet, "/2", adminToken, nil, http.StatusNotFound, nil},
+	}
+
+	for i, test := range tests {
+		var body io.Reader
+		if test.Body != nil {
+			bodyBytes, _ := json.Marshal(test.Body)
+			body = bytes.NewReader(bodyBytes)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.Method, "/api/v1/restricted/playlist"+test.Path, body)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.Token))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.GeoPoints != nil {
+			var got playlist.Playlist
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Errorf("test %d: %s", i, err)
+			}
+			assert.Equal(t, test.GeoPoints, []int64(got.GeoPoints))
+		}
+	}
+
+	// deleted geopoints leave the playlists
+	addGeo := geopoint.AddGeoPoint{Title: "Short lived", Latitude: 1.0, Longitude: 1.7, Date: time.Now(), Amplitudes: newAmplitudes(100), PictureTemplate: templates[0].Name}
+	w := postGeoPoint(t, addGeo)
+	var created geopoint.GeoPoint
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Error(err)
+	}
+	c.Db.MustExec("UPDATE geopoints SET available = TRUE WHERE id = $1", created.Id)
+	c.Db.MustExec("INSERT INTO playlist_geopoints (playlist_id, geopoint_id, position) VALUES (1, $1, 10)", created.Id)
+	c.Db.MustExec("DELETE FROM geopoints WHERE id = $1", created.Id)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/restricted/playlist", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", standardToken))
+	r.ServeHTTP(w, req)
+	var playlists []playlist.Playlist
+	if err := json.Unmarshal(w.Body.Bytes(), &playlists); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, 1, len(playlists))
+	assert.Equal(t, "Dusk", playlists[0].Name)
+	assert.Equal(t, []int64{geo1, geo2}, []int64(playlists[0].GeoPoints))
+}
+
+func TestComments(t *testing.T) {
+	defer c.Db.MustExec("TRUNCATE TABLE comments RESTART IDENTITY")
+	parent := 1
+
+	tests := []struct {
+		Method     string
+		Path       string
+		Token      string
+		Body       interface{}
+		StatusCode int
+	}{
+		{http.MethodPost, fmt.Sprintf("/geopoint/%d/comment", availableGeoPoint1.Id), standardToken, comment.AddComment{Content: "Blackbirds"}, http.StatusOK},
+		{http.MethodPost, fmt.Sprintf("/geopoint/%d/comment", availableGeoPoint1.Id), standardToken, comment.AddComment{Content: "And a robin", ParentId: &parent}, http.StatusOK},
+		{http.MethodPost, fmt.Sprintf("/geopoint/%d/comment", availableGeoPoint2.Id), standardToken, comment.AddComment{Content: "Elsewhere", ParentId: &parent}, http.StatusBadRequest},
+		{http.MethodPost, fmt.Sprintf("/geopoint/%d/comment", availableGeoPoint1.Id), standardToken, comment.AddComment{Content: ""}, http.StatusBadRequest},
+		{http.MethodPost, fmt.Sprintf("/geopoint/%d/comment", unavailableGeoPoint.Id), standardToken, comment.AddComment{Content: "Pending"}, http.StatusNotFound},
+		{http.MethodPost, fmt.Sprintf("/geopoint/%d/comment", availableGeoPoint1.Id), adminToken, comment.AddComment{Content: "Spam"}, http.StatusOK},
+		{http.MethodPatch, "/comment/1", adminToken, comment.EditComment{Content: "Edited"}, http.StatusForbidden},
+		{http.MethodPatch, "/comment/1", standardToken, comment.EditComment{Content: "Blackbirds at dawn"}, http.StatusOK},
+		{http.MethodPatch, "/comment/3/hide", standardToken, comment.HideComment{Hidden: &[]bool{true}[0]}, http.StatusUnauthorized},
+		{http.MethodPatch, "/comment/3/hide", adminToken, comment.HideComment{Hidden: &[]bool{true}[0]}, http.StatusOK},
+		{http.MethodDelete, "/comment/3", standardToken, nil, http.StatusForbidden},
+		{http.MethodDelete, "/comment/1000", standardToken, nil, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		var body io.Reader
+		if test.Body != nil {
+			bodyBytes, _ := json.Marshal(test.Body)
+			body = bytes.NewReader(bodyBytes)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.Method, "/api/v1/restricted"+test.Path, body)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.Token))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+	}
+
+	pages := []struct {
+		Path       string
+		Token      string
+		StatusCode int
+		Comments   []int
+	}{
+		{fmt.Sprintf("/api/v1/geopoint/%d/comments", availableGeoPoint1.Id), "", http.StatusOK, []int{1, 2}},
+		{fmt.Sprintf("/api/v1/geopoint/%d/comments?after=1&limit=1", availableGeoPoint1.Id), "", http.StatusOK, []int{2}},
+		{fmt.Sprintf("/api/v1/geopoint/%d/comments?limit=0", availableGeoPoint1.Id), "", http.StatusBadRequest, nil},
+		{fmt.Sprintf("/api/v1/geopoint/%d/comments", unavailableGeoPoint.Id), "", http.StatusForbidden, nil},
+		{fmt.Sprintf("/api/v1/restricted/geopoint/%d/comments", availableGeoPoint1.Id), adminToken, http.StatusOK, []int{1, 2, 3}},
+		{fmt.Sprintf("/api/v1/restricted/geopoint/%d/comments", unavailableGeoPoint.Id), adminToken, http.StatusOK, []int{}},
+		{fmt.Sprintf("/api/v1/restricted/geopoint/%d/comments", availableGeoPoint1.Id), standardToken, http.StatusUnauthorized, nil},
+	}
+
+	for i, page := range pages {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, page.Path, nil)
+		if page.Token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", page.Token))
+		}
+		r.ServeHTTP(w, req)
+		assert.Equal(t, page.StatusCode, w.Code)
+
+		if page.Comments != nil {
+			var comments []comment.Comment
+			if err := json.Unmarshal(w.Body.Bytes(), &comments); err != nil {
+				t.Errorf("page %d: %s", i, err)
+			}
+			ids := make([]int, 0)
+			for _, com := range comments {
+				ids = append(ids, com.Id)
+			}
+			assert.Equal(t, page.Comments, ids)
+			if len(comments) > 1 {
+				assert.Equal(t, "Blackbirds at dawn", comments[0].Content)
+				assert.Equal(t, standardUser.Name, comments[0].UserName)
+				assert.Equal(t, &parent, comments[1].ParentId)
+			}
+		}
+	}
+
+	// replies are deleted with their parent, by the author or an admin
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodDelete, "/api/v1/restricted/comment/1", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", adminToken))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var left int
+	c.Db.Get(&left, "SELECT COUNT(*) FROM comments")
+	assert.Equal(t, 1, left)
+
+	// the comments of the standard user were deleted with the thread
+	for i := 0; i <= commentsRate; i++ {
+		bodyBytes, _ := json.Marshal(comment.AddComment{Content: fmt.Sprintf("Comment %d", i)})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/restricted/geopoint/%d/comment", availableGeoPoint2.Id), bytes.NewReader(bodyBytes))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", standardToken))
+		r.ServeHTTP(w, req)
+		if i < commentsRate {
+			assert.Equal(t, http.StatusOK, w.Code)
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		}
+	}
+}
+
+func TestReports(t *testing.T) {
+	c.reportsThreshold = 2
+	defer func() { c.reportsThreshold = defaultReportsThreshold }()
+	defer c.refreshGeoJson()
+	defer c.Db.MustExec("UPDATE geopoints SET reported = FALSE")
+	defer c.Db.MustExec("TRUNCATE TABLE reports RESTART IDENTITY")
+
+	tests := []struct {
+		Path       string
+		Token      string
+		Ip         string
+		AddReport  report.AddReport
+		StatusCode int
+	}{
+		{fmt.Sprintf("/geopoint/%d/report", availableGeoPoint2.Id), "", "10.0.0.1", report.AddReport{Reason: "privacy", Details: "I can hear my neighbours"}, http.StatusOK},
+		{fmt.Sprintf("/geopoint/%d/report", availableGeoPoint2.Id), "", "10.0.0.1", report.AddReport{Reason: "privacy"}, http.StatusConflict},
+		{fmt.Sprintf("/geopoint/%d/report", availableGeoPoint2.Id), "", "10.0.0.2", report.AddReport{Reason: "boring"}, http.StatusBadRequest},
+		{fmt.Sprintf("/geopoint/%d/report", unavailableGeoPoint.Id), "", "10.0.0.2", report.AddReport{Reason: "spam"}, http.StatusNotFound},
+		{fmt.Sprintf("/geopoint/%d/report", availableGeoPoint2.Id), standardToken, "10.0.0.1", report.AddReport{Reason: "offensive"}, http.StatusOK},
+		{fmt.Sprintf("/user/%s/report", standardUser.Name), "", "10.0.0.2", report.AddReport{Reason: "spam"}, http.StatusOK},
+		{"/user/nobody/report", "", "10.0.0.2", report.AddReport{Reason: "spam"}, http.StatusNotFound},
+	}
+
+	post := func(path string, token string, ip string, addReport report.AddReport, statusCode int) report.Report {
+		body, _ := json.Marshal(addReport)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1"+path, bytes.NewReader(body))
+		req.RemoteAddr = ip + ":4242"
+		if token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
+		}
+		r.ServeHTTP(w, req)
+		assert.Equal(t, statusCode, w.Code)
+		var got report.Report
+		if statusCode == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Error(err)
+			}
+		}
+		return got
+	}
+
+	created := make([]report.Report, 0)
+	for _, test := range tests {
+		if got := post(test.Path, test.Token, test.Ip, test.AddReport, test.StatusCode); got.GeoId != nil {
+			created = append(created, got)
+		}
+	}
+	if len(created) != 2 {
+		t.Fatalf("expected 2 geopoint reports, got %d", len(created))
+	}
+	anonymous := created[0]
+
+	// the anonymous and the authenticated report sent from the same ip count once
+	assert.Equal(t, false, getGeoPoint(t, availableGeoPoint2.Id, "").Reported)
+
+	// the report of an account younger than reporterMinAge does not count
+	young := post(fmt.Sprintf("/geopoint/%d/report", availableGeoPoint2.Id), adminToken, "10.0.0.4", report.AddReport{Reason: "spam"}, http.StatusOK)
+	assert.Equal(t, false, getGeoPoint(t, availableGeoPoint2.Id, "").Reported)
+
+	// until the account grows older, two independent reports hide the geopoint from the map
+	c.Db.MustExec("UPDATE accounts SET created_on = created_on - $2 * interval '1 second' WHERE id = $1", adminUser.Id, reporterMinAge.Seconds())
+	defer c.Db.MustExec("UPDATE accounts SET created_on = created_on + $2 * interval '1 second' WHERE id = $1", adminUser.Id, reporterMinAge.Seconds())
+	if err := c.updateReported(availableGeoPoint2.Id); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, true, getGeoPoint(t, availableGeoPoint2.Id, "").Reported)
+	assert.Equal(t, false, contains(geoJsonIds(t), strconv.Itoa(availableGeoPoint2.Id)))
+
+	queue := func(status string, token string, statusCode int) []report.Report {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/restricted/report?status="+status, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, statusCode, w.Code)
+		var reports []report.Report
+		if statusCode == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &reports); err != nil {
+				t.Error(err)
+			}
+		}
+		return reports
+	}
+	assert.Equal(t, 4, len(queue(report.Pending, adminToken, http.StatusOK)))
+	queue(report.Pending, standardToken, http.StatusUnauthorized)
+	queue("unknown", adminToken, http.StatusBadRequest)
+
+	actions := []struct {
+		Path       string
+		StatusCode int
+		Reported   bool
+	}{
+		{fmt.Sprintf("/%d/dismiss", young.Id), http.StatusOK, false},
+		{fmt.Sprintf("/%d/resolve", young.Id), http.StatusConflict, false},
+		{fmt.Sprintf("/%d/resolve", anonymous.Id), http.StatusOK, true},
+		{"/1000/dismiss", http.StatusNotFound, true},
+	}
+	for _, action := range actions {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPatch, "/api/v1/restricted/report"+action.Path, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", adminToken))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, action.StatusCode, w.Code)
+		assert.Equal(t, action.Reported, getGeoPoint(t, availableGeoPoint2.Id, "").Reported)
+		assert.Equal(t, !action.Reported, contains(geoJsonIds(t), strconv.Itoa(availableGeoPoint2.Id)))
+	}
+	assert.Equal(t, 1, len(queue(report.Dismissed, adminToken, http.StatusOK)))
+	resolved := queue(report.Resolved, adminToken, http.StatusOK)
+	assert.Equal(t, 1, len(resolved))
+	assert.Equal(t, 1, *resolved[0].HandledBy)
+
+	// anonymous reports are limited by ip, not the authenticated ones
+	for i := 0; i < reportsRate; i++ {
+		c.Db.MustExec("INSERT INTO reports (account_id, ip, reason, status, created_on) VALUES (1, '10.0.0.3', 'spam', 'dismissed', now())")
+	}
+	limits := []struct {
+		Token      string
+		StatusCode int
+	}{
+		{"", http.StatusTooManyRequests},
+		{standardToken, http.StatusOK},
+	}
+	for _, limit := range limits {
+		body, _ := json.Marshal(report.AddReport{Reason: "spam"})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/geopoint/%d/report", availableGeoPoint1.Id), bytes.NewReader(body))
+		req.RemoteAddr = "10.0.0.3:4242"
+		if limit.Token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", limit.Token))
+		}
+		r.ServeHTTP(w, req)
+		assert.Equal(t, limit.StatusCode, w.Code)
+	}
+}
+
+func TestIdempotentPostGeoPoint(t *testing.T) {
+	addGeo := geopoint.AddGeoPoint{Title: "Idempotent forest", Latitude: 1.0, Longitude: 1.5, Date: time.Now(), Amplitudes: newAmplitudes(100), PictureTemplate: templates[0].Name}
+	// a crashed request left a claim without response
+	c.Db.MustExec("INSERT INTO idempotency_keys (user_id, key, claim, created_on) VALUES ($1, 'crashed-key', $2, now() - interval '1 hour')", standardUser.Id, uuid.NewString())
+	c.Db.MustExec("INSERT INTO idempotency_keys (user_id, key, claim, created_on) VALUES ($1, 'pending-key', $2, now())", standardUser.Id, uuid.NewString())
+
+	tests := []struct {
+		Key        string
+		Title      string
+		JWT        string
+		StatusCode int
+		Replayed   bool
+	}{
+		{strings.Repeat("k", 256), addGeo.Title, standardToken, http.StatusBadRequest, false},
+		{"first-key", addGeo.Title, standardToken, http.StatusOK, false},
+		{"first-key", addGeo.Title, standardToken, http.StatusOK, true},
+		{"first-key", "Another forest", standardToken, http.StatusUnprocessableEntity, false},
+		{"first-key", addGeo.Title, adminToken, http.StatusOK, false},
+		{"second-key", addGeo.Title, standardToken, http.StatusOK, false},
+		{"pending-key", addGeo.Title, standardToken, http.StatusConflict, false},
+		{"crashed-key", addGeo.Title, standardToken, http.StatusOK, false},
+	}
+
+	ids := make(map[string]int)
+	for _, test := range tests {
+		addGeo := addGeo
+		addGeo.Title = test.Title
+		geoBytes, _ := json.Marshal(addGeo)
+		values := map[string]io.Reader{
+			"sound":    mustOpen("../testassets/merle.aac"),
+			"geopoint": strings.NewReader(string(geoBytes)),
+		}
+
+		w := httptest.NewRecorder()
+		req, err := buildFormData(values, "/api/v1/restricted/geopoint")
+		if err != nil {
+			t.Error(err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.JWT))
+		req.Header.Set("Idempotency-Key", test.Key)
+
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.StatusCode == http.StatusOK {
+			var got geopoint.GeoPoint
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Error(err)
+			}
+			previousId, seen := ids[test.JWT+test.Key]
+			assert.Equal(t, test.Replayed, seen)
+			if seen {
+				assert.Equal(t, previousId, got.Id)
+			}
+			ids[test.JWT+test.Key] = got.Id
+		}
+	}
+
+	// the key cannot be reused on another route
+	body, _ := json.Marshal(geopoint.UploadedGeoPoint{GeoPoint: addGeo, Sound: uuid.NewString()})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/restricted/geopoint/upload", bytes.NewReader(body))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", standardToken))
+	req.Header.Set("Idempotency-Key", "first-key")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var count int
+	if err := c.Db.Get(&count, "SELECT COUNT(*) FROM geopoints WHERE title = $1", addGeo.Title); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, 4, count)
+}
+
+func TestUploadGeoPoint(t *testing.T) {
+	sound := newUpload(t, "../testassets/merle.aac", upload.Sound, standardToken)
+	picture := newUpload(t, "../testassets/russie.webp", upload.Picture, standardToken)
+	corrupted := newUpload(t, "../testassets/merle.aac", upload.Sound, standardToken)
+	incomplete := newUpload(t, "../testassets/merle.aac", upload.Sound, standardToken)
+
+	soundBytes, _ := ioutil.ReadFile("../testassets/merle.aac")
+	pictureBytes, _ := ioutil.ReadFile("../testassets/russie.webp")
+	corruptedBytes := append([]byte{}, soundBytes...)
+	corruptedBytes[len(corruptedBytes)-1]++
+	half := int64(len(soundBytes) / 2)
+
+	chunks := []struct {
+		Id         string
+		Offset     int64
+		Chunk      []byte
+		JWT        string
+		StatusCode int
+	}{
+		{sound.Id, 0, soundBytes[:half], adminToken, http.StatusNotFound},
+		{sound.Id, half, soundBytes[half:], standardToken, http.StatusConflict},
+		{sound.Id, 0, soundBytes, standardToken, http.StatusOK},
+		{sound.Id, 0, soundBytes, standardToken, http.StatusConflict},
+		{picture.Id, 0, append(pictureBytes, 0), standardToken, http.StatusBadRequest},
+		{picture.Id, 0, pictureBytes[:half/100], standardToken, http.StatusOK},
+		{picture.Id, half / 100, pictureBytes[half/100:], standardToken, http.StatusOK},
+		{corrupted.Id, 0, corruptedBytes, standardToken, http.StatusOK},
+		{incomplete.Id, 0, soundBytes[:half], standardToken, http.StatusOK},
+	}
+
+	for _, test := range chunks {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/api/v1/restricted/upload/%s", test.Id), bytes.NewReader(test.Chunk))
+		req.Header.Set("Upload-Offset", fmt.Sprint(test.Offset))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.JWT))
+
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.StatusCode == http.StatusOK {
+			assert.Equal(t, fmt.Sprint(test.Offset+int64(len(test.Chunk))), w.Header().Get("Upload-Offset"))
+		}
+	}
+
+	// the partial uploads are not downloadable
+	partial, err := c.store.List(context.Background(), path.Join(storage.UploadFolder, incomplete.Id))
+	if err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, 1, len(partial))
+	for _, chunk := range partial {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/assets/"+chunk.Key, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+
+	addGeo := geopoint.AddGeoPoint{Title: "Uploaded forest", Latitude: 1.0, Longitude: 1.4, Date: time.Now(), Amplitudes: newAmplitudes(100)}
+	tests := []struct {
+		Uploaded   geopoint.UploadedGeoPoint
+		JWT        string
+		StatusCode int
+	}{
+		{geopoint.UploadedGeoPoint{GeoPoint: addGeo, Sound: sound.Id, Picture: picture.Id}, adminToken, http.StatusNotFound},
+		{geopoint.UploadedGeoPoint{GeoPoint: addGeo, Sound: sound.Id}, standardToken, http.StatusBadRequest},
+		{geopoint.UploadedGeoPoint{GeoPoint: addGeo, Sound: picture.Id, Picture: sound.Id}, standardToken, http.StatusBadRequest},
+		{geopoint.UploadedGeoPoint{GeoPoint: addGeo, Sound: incomplete.Id, Picture: picture.Id}, standardToken, http.StatusConflict},
+		{geopoint.UploadedGeoPoint{GeoPoint: addGeo, Sound: corrupted.Id, Picture: picture.Id}, standardToken, http.StatusBadRequest},
+		{geopoint.UploadedGeoPoint{GeoPoint: addGeo, Sound: sound.Id, Picture: picture.Id}, standardToken, http.StatusOK},
+		{geopoint.UploadedGeoPoint{GeoPoint: addGeo, Sound: sound.Id, Picture: picture.Id}, standardToken, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		body, _ := json.Marshal(test.Uploaded)
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/restricted/geopoint/upload", bytes.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.JWT))
+
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.StatusCode == http.StatusOK {
+			var got geopoint.GeoPoint
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Error(err)
+			}
+			file, err := c.store.Open(context.Background(), storage.SoundKey(got.Sound))
+			if err != nil {
+				t.Fatalf("sound was not saved: %s", err)
+			}
+			saved, _ := ioutil.ReadAll(file)
+			file.Close()
+			assert.Equal(t, soundBytes, saved)
+
+			chunks, err := c.store.List(context.Background(), path.Join(storage.UploadFolder, sound.Id))
+			if err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, 0, len(chunks))
+		}
 	}
 }
 
@@ -405,6 +2536,8 @@ func TestGetAssets(t *testing.T) {
 			}
 			assert.Equal(t, test.GeoPoint.Picture, got.Picture)
 			assert.Equal(t, test.GeoPoint.Sound, got.Sound)
+			assert.Equal(t, c.store.URL(storage.PictureKey(test.GeoPoint.Picture)), got.PictureUrl)
+			assert.Equal(t, c.store.URL(storage.SoundKey(test.GeoPoint.Sound)), got.SoundUrl)
 		}
 	}
 }
@@ -526,57 +2659,443 @@ func TestDeleteGeoPoint(t *testing.T) {
 }
 
 func TestMakeAdmin(t *testing.T) {
-	defer c.Db.Exec("UPDATE accounts SET admin = TRUE WHERE id = $1", standardUser.Id)
+	defer func() {
+		c.Db.MustExec("UPDATE accounts SET admin = FALSE, role = $2 WHERE id = $1", standardUser.Id, role.Contributor)
+		c.forgetRoles(standardUser.Id)
+	}()
 
 	tests := []struct {
+		Path       string
 		Id         int
 		JWT        string
 		StatusCode int
+		Admin      bool
 	}{
-		{standardUser.Id, standardToken, http.StatusUnauthorized},
-		{99999, adminToken, http.StatusNotFound},
-		{standardUser.Id, adminToken, http.StatusOK},
+		{"", standardUser.Id, standardToken, http.StatusUnauthorized, false},
+		{"", 99999, adminToken, http.StatusNotFound, false},
+		{"/demote", standardUser.Id, standardToken, http.StatusUnauthorized, false},
+		{"", standardUser.Id, adminToken, http.StatusOK, true},
+		// the rights come from the database, the token of the user does not change
+		{"/demote", adminUser.Id, standardToken, http.StatusOK, false},
+		{"/demote", standardUser.Id, standardToken, http.StatusConflict, true},
+		{"/demote", 99999, standardToken, http.StatusNotFound, false},
+		{"", adminUser.Id, standardToken, http.StatusOK, true},
+		{"/demote", standardUser.Id, adminToken, http.StatusOK, false},
+		{"/demote", standardUser.Id, adminToken, http.StatusOK, false},
+		{"", standardUser.Id, standardToken, http.StatusUnauthorized, false},
 	}
 
 	for _, test := range tests {
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/api/v1/restricted/user/%d", test.Id), nil)
+		req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/api/v1/restricted/user/%d%s", test.Id, test.Path), nil)
 
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.JWT))
 		r.ServeHTTP(w, req)
 		assert.Equal(t, test.StatusCode, w.Code)
 
-		if test.StatusCode == http.StatusOK {
+		if test.StatusCode == http.StatusOK || test.StatusCode == http.StatusConflict {
 			var got user.User
 			if err := c.Db.Get(&got, "SELECT * FROM accounts WHERE id = $1", test.Id); err != nil {
 				t.Errorf("admined user not in database: %s", err)
 			}
-			assert.Equal(t, true, got.Admin)
+			assert.Equal(t, test.Admin, got.Admin)
+			assert.Equal(t, test.Admin, got.Role == role.Admin)
+		}
+	}
+}
+
+func TestRoles(t *testing.T) {
+	defer func() {
+		c.Db.MustExec("UPDATE accounts SET admin = FALSE, role = $2 WHERE id = $1", standardUser.Id, role.Contributor)
+		c.forgetRoles(standardUser.Id)
+	}()
+
+	setRole := func(id int, newRole string, token string) int {
+		body, _ := json.Marshal(role.SetRole{Role: newRole})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/api/v1/restricted/user/%d/role", id), bytes.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	call := func(method string, path string, token string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/api/v1/restricted"+path, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, setRole(standardUser.Id, role.Moderator, standardToken))
+	assert.Equal(t, http.StatusBadRequest, setRole(standardUser.Id, "superuser", adminToken))
+	assert.Equal(t, http.StatusNotFound, setRole(99999, role.Moderator, adminToken))
+	assert.Equal(t, http.StatusOK, setRole(standardUser.Id, role.Moderator, adminToken))
+	// the last admin cannot step down
+	assert.Equal(t, http.StatusConflict, setRole(adminUser.Id, role.Contributor, adminToken))
+
+	tests := []struct {
+		Method     string
+		Path       string
+		StatusCode int
+	}{
+		{http.MethodGet, fmt.Sprintf("/geopoint/%d", unavailableGeoPoint.Id), http.StatusOK},
+		{http.MethodGet, fmt.Sprintf("/geopoint/%d/comments", unavailableGeoPoint.Id), http.StatusOK},
+		{http.MethodGet, "/report", http.StatusOK},
+		{http.MethodGet, "/template", http.StatusUnauthorized},
+		{http.MethodGet, "/zone", http.StatusUnauthorized},
+		{http.MethodGet, "/role", http.StatusUnauthorized},
+		{http.MethodPost, "/assets/check", http.StatusUnauthorized},
+		{http.MethodDelete, fmt.Sprintf("/user/%d/sessions", adminUser.Id), http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.StatusCode, call(test.Method, test.Path, standardToken))
+	}
+	assert.Equal(t, http.StatusUnauthorized, setRole(adminUser.Id, role.Contributor, standardToken))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/restricted/role", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", adminToken))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var roles []role.Role
+	if err := json.Unmarshal(w.Body.Bytes(), &roles); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, len(role.Roles), len(roles))
+
+	assert.Equal(t, http.StatusOK, setRole(standardUser.Id, role.Contributor, adminToken))
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/report", standardToken))
+}
+
+func TestGetTemplates(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/templates", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var got []picture.Template
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Error(err)
+	}
+	for _, template := range got {
+		assert.Equal(t, false, template.Retired)
+		assert.NotEqual(t, retiredTemplate.Name, template.Name)
+	}
+}
+
+func TestGetAllTemplates(t *testing.T) {
+	tests := []struct {
+		JWT        string
+		StatusCode int
+	}{
+		{standardToken, http.StatusUnauthorized},
+		{adminToken, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/restricted/template", nil)
+
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.JWT))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.StatusCode == http.StatusOK {
+			var got []picture.Template
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, true, len(got) > len(templates))
+		}
+	}
+}
+
+func TestCreateTemplate(t *testing.T) {
+	tests := []struct {
+		Name        string
+		PicturePath string
+		JWT         string
+		StatusCode  int
+	}{
+		{"wetland", "../testassets/russie.webp", standardToken, http.StatusUnauthorized},
+		{"wetland", "../testassets/russie.jpg", adminToken, http.StatusBadRequest},
+		{"Wet land", "../testassets/russie.webp", adminToken, http.StatusBadRequest},
+		{"wetland", "../testassets/russie.webp", adminToken, http.StatusOK},
+		{"wetland", "../testassets/russie.webp", adminToken, http.StatusConflict},
+	}
+
+	for _, test := range tests {
+		values := map[string]io.Reader{
+			"name":    strings.NewReader(test.Name),
+			"picture": mustOpen(test.PicturePath),
+		}
+
+		w := httptest.NewRecorder()
+		req, err := buildFormData(values, "/api/v1/restricted/template")
+		if err != nil {
+			t.Error(err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.JWT))
+
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.StatusCode == http.StatusOK {
+			var got picture.Template
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, test.Name, got.Name)
+			file, err := c.store.Open(context.Background(), storage.PictureKey(got.Picture))
+			if err != nil {
+				t.Errorf("template picture was not saved: %s", err)
+			} else {
+				file.Close()
+			}
+			assert.Equal(t, c.store.URL(storage.PictureKey(got.Picture)), got.PictureUrl)
+		}
+	}
+}
+
+func TestRenameTemplate(t *testing.T) {
+	defer c.Db.MustExec("UPDATE templates SET name = $2 WHERE id = $1", templates[0].Id, templates[0].Name)
+
+	tests := []struct {
+		Id         int
+		Name       string
+		JWT        string
+		StatusCode int
+	}{
+		{templates[0].Id, "glade", standardToken, http.StatusUnauthorized},
+		{9999, "glade", adminToken, http.StatusNotFound},
+		{templates[0].Id, "gl", adminToken, http.StatusBadRequest},
+		{templates[0].Id, templates[1].Name, adminToken, http.StatusConflict},
+		{templates[0].Id, "glade", adminToken, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		body, _ := json.Marshal(picture.RenameTemplate{Name: test.Name})
+		req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/api/v1/restricted/template/%d", test.Id), bytes.NewReader(body))
+
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.JWT))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.StatusCode == http.StatusOK {
+			var got picture.Template
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, test.Name, got.Name)
+			assert.Equal(t, templates[0].Picture, got.Picture)
+		}
+	}
+}
+
+func TestRetireTemplate(t *testing.T) {
+	defer c.Db.MustExec("UPDATE templates SET retired = FALSE WHERE id = $1", templates[1].Id)
+
+	tests := []struct {
+		Id         int
+		JWT        string
+		StatusCode int
+	}{
+		{templates[1].Id, standardToken, http.StatusUnauthorized},
+		{9999, adminToken, http.StatusNotFound},
+		{templates[1].Id, adminToken, http.StatusOK},
+		{templates[1].Id, adminToken, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/api/v1/restricted/template/%d/retire", test.Id), nil)
+
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.JWT))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+	}
+
+	var retired bool
+	if err := c.Db.Get(&retired, "SELECT retired FROM templates WHERE id = $1", templates[1].Id); err != nil {
+		t.Errorf("could not get retired template: %s", err)
+	}
+	assert.Equal(t, true, retired)
+}
+
+func TestCheckAssets(t *testing.T) {
+	orphan := storage.PictureKey("orphan.webp")
+	removable := storage.SoundKey("orphan.aac")
+	templatePicture := storage.PictureKey(templates[0].Picture)
+	for _, key := range []string{orphan, removable, templatePicture} {
+		if err := c.store.Save(context.Background(), key, strings.NewReader("orphan"), 6); err != nil {
+			t.Fatalf("could not save %s: %s", key, err)
+		}
+	}
+
+	tests := []struct {
+		Query       string
+		JWT         string
+		StatusCode  int
+		Quarantined []string
+		Removed     []string
+	}{
+		{"", standardToken, http.StatusUnauthorized, nil, nil},
+		{"action=burn", adminToken, http.StatusBadRequest, nil, nil},
+		{"grace=0", adminToken, http.StatusOK, []string{}, []string{}},
+		{"action=quarantine&grace=1000", adminToken, http.StatusOK, []string{}, []string{}},
+		{"action=quarantine&grace=0", adminToken, http.StatusOK, []string{orphan}, []string{}},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/restricted/assets/check?"+test.Query, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", test.JWT))
+
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.StatusCode, w.Code)
+
+		if test.StatusCode == http.StatusOK {
+			var got check.Result
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Error(err)
+			}
+			assert.Equal(t, true, contains(got.Orphans, orphan))
+			assert.Equal(t, false, contains(got.Orphans, templatePicture))
+			missing := check.Missing{GeoId: availableGeoPoint2.Id, Key: storage.SoundKey(availableGeoPoint2.Sound)}
+			found := false
+			for _, m := range got.Missing {
+				found = found || m == missing
+			}
+			assert.Equal(t, true, found)
+			for _, key := range test.Quarantined {
+				assert.Equal(t, true, contains(got.Quarantined, key))
+			}
 		}
 	}
+
+	result, err := c.CheckAssetsConsistency(context.Background(), check.Options{Action: check.Remove})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, true, contains(result.Removed, removable))
+	assert.Equal(t, false, contains(result.Removed, orphan))
+
+	_, err = c.store.Open(context.Background(), removable)
+	assert.Equal(t, true, errors.Is(err, os.ErrNotExist))
+	file, err := c.store.Open(context.Background(), storage.QuarantineKey(orphan))
+	if err != nil {
+		t.Errorf("orphan was not quarantined: %s", err)
+	} else {
+		file.Close()
+	}
+	file, err = c.store.Open(context.Background(), templatePicture)
+	if err != nil {
+		t.Errorf("template picture was removed: %s", err)
+	} else {
+		file.Close()
+	}
+
+	// an asset listed as an orphan but shared since then is counted again before being collected
+	collected, err := c.collectUnreferencedAsset(context.Background(), templatePicture, func(key string) error {
+		t.Errorf("%s was collected while referenced", key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, false, collected)
+}
+
+func newUpload(t *testing.T, path string, kind string, token string) upload.Upload {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum := sha256.Sum256(content)
+
+	w := httptest.NewRecorder()
+	body, _ := json.Marshal(upload.AddUpload{Kind: kind, Size: int64(len(content)), Checksum: hex.EncodeToString(checksum[:])})
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/restricted/upload", bytes.NewReader(body))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
+
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("could not create upload: %s", w.Body.String())
+	}
+
+	var created upload.Upload
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+// failingStore fails to save or move the assets of a folder
+type failingStore struct {
+	storage.Storage
+	failSave string
+	failMove string
+	saved    []string
+}
+
+func (s *failingStore) Save(ctx context.Context, key string, file io.Reader, size int64) error {
+	if s.failSave != "" && strings.Contains(key, s.failSave+"/") {
+		return errors.New("save failed")
+	}
+	s.saved = append(s.saved, key)
+	return s.Storage.Save(ctx, key, file, size)
+}
+
+func (s *failingStore) Move(ctx context.Context, src string, dst string) error {
+	if s.failMove != "" && strings.HasPrefix(dst, s.failMove+"/") {
+		return errors.New("move failed")
+	}
+	return s.Storage.Move(ctx, src, dst)
 }
 
 func (c *Controller) clearDatabase() {
 	var hashAdminPwd, _ = bcrypt.GenerateFromPassword([]byte(adminUser.Password), bcrypt.DefaultCost)
 	var hashAlicePwd, _ = bcrypt.GenerateFromPassword([]byte(standardUser.Password), bcrypt.DefaultCost)
 	tx := c.Db.MustBegin()
-	tx.MustExec("TRUNCATE TABLE accounts RESTART IDENTITY")
-	tx.MustExec("TRUNCATE TABLE geopoints RESTART IDENTITY")
-	tx.MustExec("INSERT INTO accounts (name, created_on, password, admin) VALUES ($1,now(),$2,$3) ON CONFLICT DO NOTHING", adminUser.Name, hashAdminPwd, adminUser.Admin)
-	tx.MustExec("INSERT INTO accounts (name, created_on, password, admin) VALUES ($1,now(),$2,$3) ON CONFLICT DO NOTHING", standardUser.Name, hashAlicePwd, adminUser.Admin)
-	tx.NamedExec("INSERT INTO geopoints (title, user_id, location, amplitudes, picture, sound, created_on, available) VALUES (:title,:user_id,GeomFromEWKB(:location),:amplitudes,:picture,:sound,:created_on,:available)", availableGeoPoint1)
-	tx.NamedExec("INSERT INTO geopoints (title, user_id, location, amplitudes, picture, sound, created_on, available) VALUES (:title,:user_id,GeomFromEWKB(:location),:amplitudes,:picture,:sound,:created_on,:available)", availableGeoPoint2)
-	tx.NamedExec("INSERT INTO geopoints (title, user_id, location, amplitudes, picture, sound, created_on, available) VALUES (:title,:user_id,GeomFromEWKB(:location),:amplitudes,:picture,:sound,:created_on,:available)", unavailableGeoPoint)
+	tx.MustExec("TRUNCATE TABLE accounts RESTART IDENTITY CASCADE")
+	tx.MustExec("TRUNCATE TABLE geopoints, walks RESTART IDENTITY CASCADE")
+	tx.MustExec("TRUNCATE TABLE templates RESTART IDENTITY")
+	tx.MustExec("TRUNCATE TABLE uploads")
+	tx.MustExec("TRUNCATE TABLE idempotency_keys")
+	tx.MustExec("TRUNCATE TABLE privacy_zones RESTART IDENTITY")
+	tx.MustExec("TRUNCATE TABLE localities")
+	tx.MustExec("INSERT INTO accounts (name, created_on, password, admin, role) VALUES ($1,now(),$2,$3,$4) ON CONFLICT DO NOTHING", adminUser.Name, hashAdminPwd, adminUser.Admin, adminUser.Role)
+	tx.MustExec("INSERT INTO accounts (name, created_on, password, admin, role) VALUES ($1,now(),$2,$3,$4) ON CONFLICT DO NOTHING", standardUser.Name, hashAlicePwd, standardUser.Admin, standardUser.Role)
+	tx.NamedExec("INSERT INTO geopoints (title, user_id, location, public_location, amplitudes, picture, sound, created_on, available) VALUES (:title,:user_id,GeomFromEWKB(:location),GeomFromEWKB(:location),:amplitudes,:picture,:sound,:created_on,:available)", availableGeoPoint1)
+	tx.NamedExec("INSERT INTO geopoints (title, user_id, location, public_location, amplitudes, picture, sound, created_on, available) VALUES (:title,:user_id,GeomFromEWKB(:location),GeomFromEWKB(:location),:amplitudes,:picture,:sound,:created_on,:available)", availableGeoPoint2)
+	tx.NamedExec("INSERT INTO geopoints (title, user_id, location, public_location, amplitudes, picture, sound, created_on, available) VALUES (:title,:user_id,GeomFromEWKB(:location),GeomFromEWKB(:location),:amplitudes,:picture,:sound,:created_on,:available)", unavailableGeoPoint)
+	for _, template := range append(templates, retiredTemplate) {
+		tx.MustExec("INSERT INTO templates (name, picture, retired, created_on) VALUES ($1,$2,$3,now())", template.Name, template.Picture, template.Retired)
+	}
 	tx.Commit()
 }
 
 func (c *Controller) createTokens() {
-	adminToken, _ = c.createToken(adminUser.Name, adminUser.Admin)
-	standardToken, _ = c.createToken(standardUser.Name, standardUser.Admin)
+	adminToken = c.sessionToken(adminUser)
+	standardToken = c.sessionToken(standardUser)
+}
+
+// sessionToken logs the user in on a new session and returns its access token
+func (c *Controller) sessionToken(u user.User) string {
+	session := uuid.NewString()
+	c.Db.MustExec(database.PostSession, session, u.Id, "test", "")
+	tokens, err := c.issueTokens(c.Db, u.Id, session)
+	if err != nil {
+		panic(err)
+	}
+	return tokens.Token
 }
 
 func preparePublicDir() {
 	os.RemoveAll("/tmp/public")
+	os.RemoveAll("/tmp/private")
 	os.MkdirAll("/tmp/public/assets/picture", os.ModePerm)
 	os.MkdirAll("/tmp/public/assets/sound", os.ModePerm)
 	os.Create("/tmp/public/assets/geojson.json")
@@ -590,6 +3109,131 @@ func newAmplitudes(length int) []float64 {
 	return ampl
 }
 
+// postGeoPoint creates the geopoint as the standard user
+func postGeoPoint(t *testing.T, addGeo geopoint.AddGeoPoint) *httptest.ResponseRecorder {
+	geoBytes, _ := json.Marshal(addGeo)
+	values := map[string]io.Reader{
+		"sound":    mustOpen("../testassets/merle.aac"),
+		"geopoint": strings.NewReader(string(geoBytes)),
+	}
+	if addGeo.PictureTemplate == "" {
+		values["picture"] = mustOpen("../testassets/russie.webp")
+	}
+
+	w := httptest.NewRecorder()
+	req, err := buildFormData(values, "/api/v1/restricted/geopoint")
+	if err != nil {
+		t.Error(err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", standardToken))
+
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// getGeoPoint gets the geopoint publicly or with the token on the restricted route
+func getGeoPoint(t *testing.T, id int, token string) geopoint.GeoPoint {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/geopoint/%d", id), nil)
+	if token != "" {
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/restricted/geopoint/%d", id), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
+	}
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var geoPoint geopoint.GeoPoint
+	if err := json.Unmarshal(w.Body.Bytes(), &geoPoint); err != nil {
+		t.Error(err)
+	}
+	return geoPoint
+}
+
+// uniqueFile copies the file with random trailing bytes, so that it is not deduplicated
+func uniqueFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suffix := make([]byte, 16)
+	rand.Read(suffix)
+
+	unique, err := ioutil.TempFile("", "unique-*"+filepath.Ext(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unique.Close()
+
+	if _, err := unique.Write(append(content, suffix...)); err != nil {
+		t.Fatal(err)
+	}
+	return unique.Name()
+}
+
+// reorderedFrames writes the aac frames of the file in reverse order, or only the first half of them
+func reorderedFrames(t *testing.T, path string, reverse bool) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var frames [][]byte
+	for len(content) >= 7 && content[0] == 0xff {
+		length := int(content[3]&0x03)<<11 | int(content[4])<<3 | int(content[5])>>5
+		if length < 7 || length > len(content) {
+			break
+		}
+		frames, content = append(frames, content[:length]), content[length:]
+	}
+
+	reordered, err := ioutil.TempFile("", "reordered-*.aac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reordered.Close()
+
+	if !reverse {
+		frames = frames[:len(frames)/2]
+	}
+	for i := range frames {
+		frame := frames[i]
+		if reverse {
+			frame = frames[len(frames)-1-i]
+		}
+		if _, err := reordered.Write(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return reordered.Name()
+}
+
+// geoJsonIds lists the ids of the geopoints on the map
+func geoJsonIds(t *testing.T) []string {
+	bytesGeoJson, err := ioutil.ReadFile(c.geoJsonPath)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var geoJson geoJson
+	if err := json.Unmarshal(bytesGeoJson, &geoJson); err != nil {
+		t.Error(err)
+	}
+	ids := make([]string, 0)
+	for _, feature := range geoJson.Features {
+		ids = append(ids, strconv.Itoa(feature.Properties.Id))
+	}
+	return ids
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func buildFormData(values map[string]io.Reader, url string) (*http.Request, error) {
 	var b bytes.Buffer
 	w := multipart.NewWriter(&b)
@@ -631,17 +3275,18 @@ func mustOpen(f string) *os.File {
 
 func (c *Controller) wrongToken() []string {
 	tokens := make([]string, 0)
+	_, signKey := c.keys.Signer()
 
 	t := jwt.New(jwt.GetSigningMethod("RS256"))
 
 	t.Claims = &user.CustomClaims{
 		RegisteredClaims: &jwt.RegisteredClaims{
+			Subject:   "99999",
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 365)),
 		},
-		UserInfo: user.UserInfo{Name: "random", Admin: true},
 	}
 
-	token, err := t.SignedString(c.signKey)
+	token, err := t.SignedString(signKey)
 	if err != nil {
 		panic(err)
 	}
@@ -649,12 +3294,12 @@ func (c *Controller) wrongToken() []string {
 
 	t.Claims = &user.CustomClaims{
 		RegisteredClaims: &jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(adminUser.Id),
 			ExpiresAt: jwt.NewNumericDate(time.Now()),
 		},
-		UserInfo: user.UserInfo{Name: adminUser.Password, Admin: false},
 	}
 
-	token, err = t.SignedString(c.signKey)
+	token, err = t.SignedString(signKey)
 	if err != nil {
 		panic(err)
 	}
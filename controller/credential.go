@@ -0,0 +1,476 @@
+package controller
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/haran/biophonie-api/controller/user"
+	"github.com/haran/biophonie-api/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// an account cannot have more than maxCredentials device credentials, each of them is compared on login
+	maxCredentials       = 5
+	recoveryCodeLifetime = time.Hour * 24
+	// chosen passwords are at least minPasswordLength characters long, shorter than passphraseLength
+	// they mix at least minCharacterClasses of lower case letters, upper case letters, digits and symbols
+	minPasswordLength   = 10
+	passphraseLength    = 16
+	minCharacterClasses = 3
+	// bcrypt ignores what follows
+	maxPasswordBytes = 72
+)
+
+var errInvalidRecoveryCode = errors.New("recovery code is not valid, please ask an admin for a new one")
+
+// RotatePassword godoc
+// @Summary rotate the password
+// @Description given the current password (or a device credential or the chosen password), replace the password of the account with a new one, returned only once, the sessions and the device credentials are kept
+// @Accept json
+// @Produce json
+// @Tags User
+// @Param password body user.RotatePassword true "current password"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} user.User
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/user/password [post]
+func (c *Controller) RotatePassword(ctx *gin.Context) {
+	var rotatePassword user.RotatePassword
+	if err := ctx.BindJSON(&rotatePassword); err != nil {
+		return
+	}
+
+	var rotator user.User
+	if err := c.Db.Get(&rotator, database.GetUserById, ctx.GetInt("userId")); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get user")
+		ctx.Abort()
+		return
+	}
+
+	if err := c.checkPassword(rotator, rotatePassword.Password); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not compare current password and hash")
+		ctx.Abort()
+		return
+	}
+
+	password, hashedPassword, err := c.newPassword()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	if _, err := c.Db.Exec(database.SetPassword, ctx.GetInt("userId"), hashedPassword); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not set password: %s", err))
+		return
+	}
+
+	c.respondPassword(ctx, ctx.GetInt("userId"), password)
+}
+
+// ChoosePassword godoc
+// @Summary choose a password
+// @Description link a password chosen by the user to the account to log in on the website, replacing the previous one, given the current password or a recovery code, the generated passwords keep working
+// @Accept json
+// @Produce json
+// @Tags User
+// @Param password body user.ChoosePassword true "chosen password, at least 10 characters mixing letters, digits and symbols (or a passphrase of 16 characters) without the user name, with the current password or a recovery code"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} user.Credential
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/user/password [put]
+func (c *Controller) ChoosePassword(ctx *gin.Context) {
+	var choosePassword user.ChoosePassword
+	if err := ctx.BindJSON(&choosePassword); err != nil {
+		return
+	}
+
+	var chooser user.User
+	if err := c.Db.Get(&chooser, database.GetUserById, ctx.GetInt("userId")); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get user")
+		ctx.Abort()
+		return
+	}
+
+	if err := checkStrength(chooser.Name, choosePassword.Password); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(choosePassword.Password), c.bcryptCost)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not hash password: %s", err))
+		return
+	}
+
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not begin choice of password: %s", err))
+		return
+	}
+	defer tx.Rollback()
+
+	// the recovery code is only spent if the password is set
+	if choosePassword.RecoveryCode != "" {
+		var id int
+		if err := tx.Get(&id, database.UseRecoveryCode, chooser.Name, hashToken(choosePassword.RecoveryCode)); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				ctx.AbortWithError(http.StatusUnauthorized, errInvalidRecoveryCode).SetType(gin.ErrorTypePublic)
+				return
+			}
+			ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not use recovery code: %s", err))
+			return
+		}
+	} else if err := c.checkPassword(chooser, choosePassword.CurrentPassword); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not compare current password and hash")
+		ctx.Abort()
+		return
+	}
+
+	var id int
+	if err := tx.Get(&id, database.SetChosenPassword, chooser.Id, hashedPassword); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not set chosen password: %s", err))
+		return
+	}
+
+	var credential user.Credential
+	if err := tx.Get(&credential, database.GetCredential, id, chooser.Id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve credential")
+		ctx.Abort()
+		return
+	}
+	credential.Password = ""
+
+	if err := tx.Commit(); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not commit chosen password: %s", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, credential)
+}
+
+// GetCredentials godoc
+// @Summary list the credentials
+// @Description list the device credentials and the chosen password of the account, without the passwords
+// @Accept json
+// @Produce json
+// @Tags User
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {array} user.Credential
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/credential [get]
+func (c *Controller) GetCredentials(ctx *gin.Context) {
+	credentials := make([]user.Credential, 0)
+	if err := c.Db.Select(&credentials, database.GetCredentials, ctx.GetInt("userId")); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get credentials")
+		ctx.Abort()
+		return
+	}
+	for i := range credentials {
+		credentials[i].Password = ""
+	}
+
+	ctx.JSON(http.StatusOK, credentials)
+}
+
+// AddCredential godoc
+// @Summary add a device credential
+// @Description create another password logging in the account, returned only once, an account has at most 5 device credentials
+// @Accept json
+// @Produce json
+// @Tags User
+// @Param credential body user.AddCredential true "name of the device"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} user.Credential
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/credential [post]
+func (c *Controller) AddCredential(ctx *gin.Context) {
+	var addCredential user.AddCredential
+	if err := ctx.BindJSON(&addCredential); err != nil {
+		return
+	}
+
+	var count int
+	if err := c.Db.Get(&count, database.CountCredentials, ctx.GetInt("userId")); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not count credentials: %s", err))
+		return
+	}
+	if count >= maxCredentials {
+		ctx.AbortWithError(http.StatusConflict, fmt.Errorf("an account cannot have more than %d device credentials", maxCredentials)).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	password, hashedPassword, err := c.newPassword()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	var id int
+	if err := c.Db.Get(&id, database.PostCredential, ctx.GetInt("userId"), addCredential.Device, hashedPassword); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not create credential")
+		ctx.Abort()
+		return
+	}
+
+	var credential user.Credential
+	if err := c.Db.Get(&credential, database.GetCredential, id, ctx.GetInt("userId")); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve created credential")
+		ctx.Abort()
+		return
+	}
+	credential.Password = password
+
+	ctx.JSON(http.StatusOK, credential)
+}
+
+// DeleteCredential godoc
+// @Summary delete a credential
+// @Description the device credential or the chosen password cannot log in anymore, the sessions it started are kept
+// @Accept json
+// @Produce json
+// @Tags User
+// @Param id path int true "credential id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {string} string
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/credential/{id} [delete]
+func (c *Controller) DeleteCredential(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	result, err := c.Db.Exec(database.DeleteCredential, id, ctx.GetInt("userId"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if rowsAffected != 1 {
+		ctx.AbortWithError(http.StatusNotFound, fmt.Errorf("not found")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "credential was deleted"})
+}
+
+// CreateRecoveryCode godoc
+// @Summary create a recovery code
+// @Description issue a code valid for a day with which the user sets a new password, replacing the previous codes, to hand to the user who lost the password
+// @Accept json
+// @Produce json
+// @Tags User
+// @Param id path int true "user id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} user.RecoveryCode
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/user/{id}/recovery [post]
+func (c *Controller) CreateRecoveryCode(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var recovered user.User
+	if err := c.Db.Get(&recovered, database.GetUserById, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get user")
+		ctx.Abort()
+		return
+	}
+
+	secret := make([]byte, 8)
+	if _, err := rand.Read(secret); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not generate recovery code: %s", err))
+		return
+	}
+	code := user.RecoveryCode{Code: hex.EncodeToString(secret)}
+
+	if err := c.Db.Get(&code.ExpiresOn, database.PostRecoveryCode, id, hashToken(code.Code), recoveryCodeLifetime.Seconds()); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not store recovery code: %s", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, code)
+}
+
+// RecoverUser godoc
+// @Summary recover an account
+// @Description spend a recovery code given by an admin to set a new password, returned only once, all the sessions, the device credentials and the chosen password of the user are revoked
+// @Accept json
+// @Produce json
+// @Tags User
+// @Param recover body user.Recover true "name of the user and recovery code"
+// @Success 200 {object} user.User
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /user/recover [post]
+func (c *Controller) RecoverUser(ctx *gin.Context) {
+	var recover user.Recover
+	if err := ctx.BindJSON(&recover); err != nil {
+		return
+	}
+
+	password, hashedPassword, err := c.newPassword()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not begin recovery: %s", err))
+		return
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.Get(&id, database.UseRecoveryCode, recover.Name, hashToken(recover.Code)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.AbortWithError(http.StatusUnauthorized, errInvalidRecoveryCode).SetType(gin.ErrorTypePublic)
+			return
+		}
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not use recovery code: %s", err))
+		return
+	}
+
+	if _, err := tx.Exec(database.SetPassword, id, hashedPassword); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not set password: %s", err))
+		return
+	}
+
+	if _, err := tx.Exec(database.RevokeUserSessions, id); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not revoke sessions: %s", err))
+		return
+	}
+
+	// whoever lost the password may have lost the devices too
+	if _, err := tx.Exec(database.DeleteUserCredentials, id); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not delete credentials: %s", err))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not commit recovery: %s", err))
+		return
+	}
+
+	c.respondPassword(ctx, id, password)
+}
+
+// checkPassword compares the password with the one of the account then with its device credentials
+func (c *Controller) checkPassword(account user.User, password string) error {
+	mismatch := bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(password))
+	if mismatch != bcrypt.ErrMismatchedHashAndPassword {
+		return mismatch
+	}
+
+	var credentials []user.Credential
+	if err := c.Db.Select(&credentials, database.GetCredentials, account.Id); err != nil {
+		return fmt.Errorf("could not get credentials: %s", err)
+	}
+	for _, credential := range credentials {
+		if bcrypt.CompareHashAndPassword([]byte(credential.Password), []byte(password)) == nil {
+			if _, err := c.Db.Exec(database.UseCredential, credential.Id); err != nil {
+				return fmt.Errorf("could not use credential: %s", err)
+			}
+			return nil
+		}
+	}
+	return mismatch
+}
+
+// respondPassword responds with the user and its new password, the only time it is sent
+func (c *Controller) respondPassword(ctx *gin.Context, id int, password string) {
+	var updated user.User
+	if err := c.Db.Get(&updated, database.GetUserById, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve user")
+		ctx.Abort()
+		return
+	}
+	updated.Password = password
+
+	ctx.JSON(http.StatusOK, updated)
+}
+
+// checkStrength rejects the passwords chosen by the user which are too easy to guess
+func checkStrength(name string, password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters long", minPasswordLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password cannot be longer than %d bytes", maxPasswordBytes)
+	}
+	if strings.Contains(strings.ToLower(password), strings.ToLower(name)) {
+		return errors.New("password cannot contain the user name")
+	}
+
+	var lower, upper, digit, symbol int
+	distinct := make(map[rune]bool)
+	for _, r := range password {
+		distinct[r] = true
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	if len(distinct) < minPasswordLength/2 {
+		return errors.New("password repeats too many characters")
+	}
+	if length < passphraseLength && lower+upper+digit+symbol < minCharacterClasses {
+		return fmt.Errorf("password must mix lower case letters, upper case letters, digits and symbols or be at least %d characters long", passphraseLength)
+	}
+	return nil
+}
+
+// newPassword generates a password with its hash
+func (c *Controller) newPassword() (string, []byte, error) {
+	password := uuid.New().String()
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), c.bcryptCost)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not hash password: %s", err)
+	}
+	return password, hashedPassword, nil
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/haran/biophonie-api/database"
+	"github.com/haran/biophonie-api/gazetteer"
+)
+
+// ImportGazetteer replaces the localities with the GeoNames dumps and locates
+// every geopoint again, it returns the number of localities imported
+func (c *Controller) ImportGazetteer(cities, countries, regions io.Reader) (int, error) {
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("could not begin import: %s", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(database.DeleteLocalities); err != nil {
+		return 0, fmt.Errorf("could not delete localities: %s", err)
+	}
+
+	stmt, err := tx.Preparex(database.PostLocality)
+	if err != nil {
+		return 0, fmt.Errorf("could not prepare locality creation: %s", err)
+	}
+	defer stmt.Close()
+
+	count := 0
+	if err := gazetteer.Read(cities, countries, regions, func(l gazetteer.Locality) error {
+		count++
+		_, err := stmt.Exec(l.Id, l.Name, l.Region, l.Country, l.CountryCode, l.Population, l.Timezone, l.Latitude, l.Longitude)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(database.LocateGeoPoints); err != nil {
+		return 0, fmt.Errorf("could not locate geopoints: %s", err)
+	}
+	// the local month and season depend on the timezone of the locality
+	if err := setSolar(tx, database.GetGeoPointsForSolar, nil); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit import: %s", err)
+	}
+	c.refreshGeoJson()
+
+	return count, nil
+}
@@ -1,6 +1,11 @@
 package geopoint
 
 import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
 	"mime/multipart"
 	"time"
 
@@ -9,21 +14,210 @@ import (
 )
 
 type GeoPoint struct {
-	Id         int             `db:"id" json:"id" example:"1"`
-	Title      string          `db:"title" json:"title" example:"Forêt à l'aube"`
-	UserId     int             `db:"user_id" json:"userId" example:"1"`
-	Latitude   float64         `json:"latitude"`
-	Longitude  float64         `json:"longitude"`
-	CreatedOn  time.Time       `db:"created_on" json:"createdOn" example:"2022-05-26T11:17:35.079344Z"`
-	Amplitudes pq.Float64Array `db:"amplitudes" json:"amplitudes" swaggertype:"array,number" example:"0,1,2,3,45,3,2,1"`
-	Picture    string          `db:"picture" json:"picture" example:"https://example.com/picture-1.jpg"`
-	Sound      string          `db:"sound" json:"sound" example:"https://example.com/sound-2.wav"`
-	Available  bool            `db:"available" json:"available" example:"true"`
+	Id              int             `db:"id" json:"id" example:"1"`
+	Title           string          `db:"title" json:"title" example:"Forêt à l'aube"`
+	UserId          int             `db:"user_id" json:"userId" example:"1"`
+	Latitude        float64         `json:"latitude"`
+	Longitude       float64         `json:"longitude"`
+	CreatedOn       time.Time       `db:"created_on" json:"createdOn" example:"2022-05-26T11:17:35.079344Z"`
+	Amplitudes      pq.Float64Array `db:"amplitudes" json:"amplitudes" swaggertype:"array,number" example:"0,1,2,3,45,3,2,1"`
+	Picture         string          `db:"picture" json:"picture" example:"https://example.com/picture-1.jpg"`
+	Sound           string          `db:"sound" json:"sound" example:"https://example.com/sound-2.wav"`
+	Available       bool            `db:"available" json:"available" example:"true"`
+	PictureChecksum string          `db:"picture_checksum" json:"pictureChecksum" example:"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"`
+	PictureSize     int64           `db:"picture_size" json:"pictureSize" example:"30296"`
+	SoundChecksum   string          `db:"sound_checksum" json:"soundChecksum" example:"fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9"`
+	SoundSize       int64           `db:"sound_size" json:"soundSize" example:"473629"`
+	Fingerprint     int64           `db:"sound_fingerprint" json:"-"`
+	DuplicateOf     *int            `db:"duplicate_of" json:"duplicateOf,omitempty" example:"3"`
+	Features        pq.Float64Array `db:"features" json:"-"`
+	Privacy         string          `db:"privacy" json:"privacy" example:"approximate"`
+	Favourites      int             `db:"favourites" json:"favourites" example:"12"`
+	Reported        bool            `db:"reported" json:"reported" example:"false"`
+	PictureUrl      string          `db:"-" json:"pictureUrl" example:"https://example.com/api/v1/assets/picture/picture-1.jpg"`
+	SoundUrl        string          `db:"-" json:"soundUrl" example:"https://example.com/api/v1/assets/sound/sound-2.wav"`
+	Place
+	Solar
+}
+
+// Place is the nearest locality of the gazetteer to the public location of a geopoint
+type Place struct {
+	Locality    string `db:"locality" json:"locality" example:"Chamonix-Mont-Blanc"`
+	Region      string `db:"region" json:"region" example:"Auvergne-Rhône-Alpes"`
+	Country     string `db:"country" json:"country" example:"France"`
+	CountryCode string `db:"country_code" json:"countryCode" example:"FR"`
+	Timezone    string `db:"timezone" json:"timezone" example:"Europe/Paris"`
+}
+
+// Solar places the recording in its day and year, at its public location
+type Solar struct {
+	SunElevation float64 `db:"sun_elevation" json:"sunElevation" example:"-4.2"`
+	Phase        string  `db:"phase" json:"phase" example:"dawn"`
+	Season       string  `db:"season" json:"season" example:"spring"`
+	Hemisphere   string  `db:"hemisphere" json:"hemisphere" example:"north"`
+	Month        int     `db:"month" json:"month" example:"5"`
+}
+
+// SetSound names the sound after the SHA-256 of its content so that identical sounds are stored once
+func (g *GeoPoint) SetSound(checksum string, size int64) {
+	g.Sound = checksum + ".aac"
+	g.SoundChecksum = checksum
+	g.SoundSize = size
+}
+
+// SetPicture names the picture after the SHA-256 of its content so that identical pictures are stored once
+func (g *GeoPoint) SetPicture(checksum string, size int64) {
+	g.Picture = checksum + ".webp"
+	g.PictureChecksum = checksum
+	g.PictureSize = size
+}
+
+// Fingerprint summarizes the envelope of a recording in 64 bits: each bit tells
+// whether the amplitude rises between two consecutive parts of the recording.
+// It does not depend on the gain, so that the same recording uploaded twice has
+// close fingerprints even when it was exported differently.
+func Fingerprint(amplitudes []float64) int64 {
+	if len(amplitudes) == 0 {
+		return 0
+	}
+
+	buckets := envelope(amplitudes, 65)
+
+	var fingerprint uint64
+	for i := 0; i < 64; i++ {
+		if buckets[i+1] > buckets[i] {
+			fingerprint |= 1 << i
+		}
+	}
+	return int64(fingerprint)
+}
+
+// SoundFingerprint is the Fingerprint of the sizes of the frames of an aac (ADTS) sound,
+// which follow the amount of sound over time, so that it does not depend on what the client sends
+func SoundFingerprint(sound io.Reader) (int64, error) {
+	reader := bufio.NewReader(sound)
+	header := make([]byte, adtsHeaderLength)
+	sizes := make([]float64, 0)
+	for {
+		if _, err := io.ReadFull(reader, header); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+
+		// what follows the frames is ignored
+		if header[0] != 0xff || header[1]&0xf0 != 0xf0 {
+			break
+		}
+		length := int(header[3]&0x03)<<11 | int(header[4])<<3 | int(header[5])>>5
+		if length < adtsHeaderLength {
+			break
+		}
+		sizes = append(sizes, float64(length))
+
+		if _, err := reader.Discard(length - adtsHeaderLength); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	return Fingerprint(sizes), nil
+}
+
+const adtsHeaderLength = 7
+
+// FeaturesLength is the number of dimensions of the acoustic features
+const FeaturesLength = 32
+
+// Features embeds the envelope of a recording in a unit vector centered on its
+// mean, so that the dot product of two features is the correlation of the envelopes.
+func Features(amplitudes []float64) []float64 {
+	if len(amplitudes) == 0 {
+		return []float64{}
+	}
+
+	features := envelope(amplitudes, FeaturesLength)
+	var mean float64
+	for _, value := range features {
+		mean += value
+	}
+	mean /= FeaturesLength
+
+	var norm float64
+	for i := range features {
+		features[i] -= mean
+		norm += features[i] * features[i]
+	}
+	norm = math.Sqrt(norm)
+
+	for i := range features {
+		if norm > 0 {
+			features[i] /= norm
+		} else {
+			features[i] = 0
+		}
+	}
+	return features
+}
+
+// envelope averages the absolute amplitudes in length consecutive parts
+func envelope(amplitudes []float64, length int) []float64 {
+	buckets := make([]float64, length)
+	for i := range buckets {
+		start, end := i*len(amplitudes)/length, (i+1)*len(amplitudes)/length
+		if end == start {
+			end = start + 1
+		}
+		for _, amplitude := range amplitudes[start:end] {
+			buckets[i] += math.Abs(amplitude)
+		}
+		buckets[i] /= float64(end - start)
+	}
+	return buckets
 }
 
 type DbGeoPoint struct {
 	*GeoPoint
-	Location postgis.PointS `db:"location" json:"-"`
+	Location       postgis.PointS `db:"location" json:"-"`
+	PublicLocation postgis.PointS `db:"public_location" json:"-"`
+}
+
+const (
+	// Precise geopoints are published where they were recorded
+	Precise = "precise"
+	// Approximate geopoints are published at a random point less than a kilometer away
+	Approximate = "approximate"
+	// Coarse geopoints are published at the center of a cell of a tenth of degree
+	Coarse = "coarse"
+)
+
+const (
+	approximateRadius = 1000.
+	coarseCell        = 0.1
+	metersPerDegree   = 111320.
+)
+
+// PublicLocation generalizes the location of a geopoint according to the privacy level
+func PublicLocation(latitude, longitude float64, privacy string) (float64, float64) {
+	switch privacy {
+	case Approximate:
+		// uniformly distributed in the disk
+		distance := approximateRadius * math.Sqrt(rand.Float64())
+		angle := 2 * math.Pi * rand.Float64()
+		latitude += distance * math.Cos(angle) / metersPerDegree
+		longitude += distance * math.Sin(angle) / (metersPerDegree * math.Max(math.Cos(latitude*math.Pi/180), 0.01))
+	case Coarse:
+		latitude = math.Floor(latitude/coarseCell)*coarseCell + coarseCell/2
+		longitude = math.Floor(longitude/coarseCell)*coarseCell + coarseCell/2
+	}
+
+	latitude = math.Max(math.Min(latitude, 90), -90)
+	if longitude > 180 {
+		longitude -= 360
+	} else if longitude < -180 {
+		longitude += 360
+	}
+	return latitude, longitude
 }
 
 type AddGeoPoint struct {
@@ -33,7 +227,10 @@ type AddGeoPoint struct {
 	Longitude       float64   `json:"longitude" example:"-120.357448" validate:"required,longitude"`
 	Date            time.Time `json:"date" example:"2022-05-26T11:17:35.079344Z" validate:"required,lt"`
 	Amplitudes      []float64 `json:"amplitudes" example:"0,1,2,3,45,3,2,1" validate:"required,min=100,max=1000"`
-	PictureTemplate string    `json:"picture_template" example:"forest" validate:"omitempty,oneof=clearing desert fields garden grassland hedge lake mountains potager rainforest temperateforest"`
+	PictureTemplate string    `json:"picture_template" example:"forest"`
+	Privacy         string    `json:"privacy" example:"approximate" validate:"omitempty,oneof=precise approximate coarse"`
+	SoundChecksum   string    `json:"soundChecksum" example:"fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9" validate:"omitempty,len=64,hexadecimal,lowercase"`
+	PictureChecksum string    `json:"pictureChecksum" example:"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae" validate:"omitempty,len=64,hexadecimal,lowercase"`
 }
 
 type BindGeoPoint struct {
@@ -41,11 +238,51 @@ type BindGeoPoint struct {
 	Picture *multipart.FileHeader `form:"picture" binding:"omitempty"`
 }
 
+type UploadedGeoPoint struct {
+	GeoPoint AddGeoPoint `json:"geopoint" binding:"required"`
+	Sound    string      `json:"sound" example:"9b768967-d491-4baa-a812-24ea8a9c274d" binding:"required,uuid"`
+	Picture  string      `json:"picture" example:"57aba9df-969f-4871-a095-e916d06ba38b" binding:"omitempty,uuid"`
+}
+
 type ClosestGeoPoint struct {
 	Latitude   float64       `uri:"latitude" example:"18.16255" binding:"required,latitude"`
 	Longitude  float64       `uri:"longitude" example:"40.35735" binding:"required,longitude"`
 	SRID       *int32        `form:"srid" example:"4326" binding:"omitempty"`
 	IdExcluded pq.Int32Array `form:"not[]" example:"1,2,3,4" binding:"lt=10"`
+	Country    string        `form:"country" example:"FR" binding:"omitempty,len=2,uppercase"`
+	Phase      string        `form:"phase" example:"dawn" binding:"omitempty,oneof=night dawn day dusk"`
+}
+
+type SearchGeoPoints struct {
+	Phase   string          `form:"phase" example:"dawn" binding:"omitempty,oneof=night dawn day dusk"`
+	Season  string          `form:"season" example:"spring" binding:"omitempty,oneof=winter spring summer autumn"`
+	Month   int             `form:"month" example:"5" binding:"omitempty,min=1,max=12"`
+	Country string          `form:"country" example:"FR" binding:"omitempty,len=2,uppercase"`
+	Bbox    pq.Float64Array `form:"bbox" example:"-10.5,35,30,60" binding:"omitempty,len=4"`
+	Limit   int             `form:"limit" example:"100" binding:"min=1,max=1000"`
+}
+
+type FoundGeoPoint struct {
+	Id        int       `json:"id" db:"id" example:"18"`
+	Title     string    `json:"title" db:"title" example:"Forêt à l'aube"`
+	Latitude  float64   `json:"latitude" db:"latitude" example:"45.92"`
+	Longitude float64   `json:"longitude" db:"longitude" example:"6.87"`
+	CreatedOn time.Time `json:"createdOn" db:"created_on" example:"2022-05-26T11:17:35.079344Z"`
+	Phase     string    `json:"phase" db:"phase" example:"dawn"`
+	Locality  string    `json:"locality" db:"locality" example:"Chamonix-Mont-Blanc"`
+	Country   string    `json:"country" db:"country" example:"France"`
+}
+
+type SimilarGeoPoints struct {
+	Distance *float64 `form:"distance" example:"50000" binding:"omitempty,gt=0"`
+	Limit    int      `form:"limit" example:"10" binding:"min=1,max=50"`
+}
+
+type SimilarGeoPoint struct {
+	Id         int     `json:"id" db:"id" example:"18"`
+	Title      string  `json:"title" db:"title" example:"Forêt à l'aube"`
+	Similarity float64 `json:"similarity" db:"similarity" example:"0.87"`
+	Distance   float64 `json:"distance" db:"distance" example:"1543.2"`
 }
 
 type ClosestGeoId struct {
@@ -53,8 +290,14 @@ type ClosestGeoId struct {
 }
 
 type Assets struct {
-	Picture string `json:"picture" db:"picture" example:"forest"`
-	Sound   string `json:"sound" db:"sound" example:"forest"`
+	Picture         string `json:"picture" db:"picture" example:"forest"`
+	Sound           string `json:"sound" db:"sound" example:"forest"`
+	PictureUrl      string `json:"pictureUrl" db:"-" example:"https://example.com/api/v1/assets/picture/forest.webp"`
+	SoundUrl        string `json:"soundUrl" db:"-" example:"https://example.com/api/v1/assets/sound/forest.aac"`
+	PictureChecksum string `json:"pictureChecksum" db:"picture_checksum" example:"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"`
+	PictureSize     int64  `json:"pictureSize" db:"picture_size" example:"30296"`
+	SoundChecksum   string `json:"soundChecksum" db:"sound_checksum" example:"fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9"`
+	SoundSize       int64  `json:"soundSize" db:"sound_size" example:"473629"`
 }
 
 const WGS84 = 4326
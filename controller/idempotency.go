@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/haran/biophonie-api/database"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodySize   = 100000000 // 100 MB, as the multipart forms of the router
+	// a claimed key without response is taken over after idempotencyLease, the request which claimed it crashed
+	idempotencyLease = 5 * time.Minute
+)
+
+// responseRecorder keeps a copy of the body written to the client
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+// Idempotent replays the response of a previous request of the user with the same Idempotency-Key header,
+// so that retried creations do not insert duplicates. Requests without the header are not affected.
+// A key reused on another route or with another body is refused.
+func (c *Controller) Idempotent(ctx *gin.Context) {
+	key := ctx.GetHeader("Idempotency-Key")
+	if key == "" {
+		ctx.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("Idempotency-Key header is too long")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	// the body is written to a file while it is hashed, for the handler to read it again
+	body, err := os.CreateTemp("", "idempotent-*")
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not create request file: %s", err))
+		return
+	}
+	defer os.Remove(body.Name())
+	defer body.Close()
+
+	requestBody := io.TeeReader(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxIdempotentBodySize), body)
+	requestHash, err := hashRequest(ctx.ContentType(), ctx.GetHeader("Content-Type"), requestBody)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not rewind request file: %s", err))
+		return
+	}
+	ctx.Request.Body = ioutil.NopCloser(body)
+	route := ctx.Request.Method + " " + ctx.FullPath()
+
+	userId := ctx.GetInt("userId")
+	if _, err := c.Db.Exec(database.DeleteExpiredIdempotencyKeys, userId); err != nil {
+		log.Println("could not delete expired idempotency keys: ", err)
+	}
+
+	claim := uuid.NewString()
+	result, err := c.Db.Exec(database.ClaimIdempotencyKey, userId, key, route, requestHash, claim, idempotencyLease.Seconds())
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if claimed != 1 {
+		c.replay(ctx, userId, key, route, requestHash)
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: ctx.Writer}
+	ctx.Writer = recorder
+	ctx.Next()
+
+	if ctx.IsAborted() || recorder.Status() != http.StatusOK {
+		// let the client retry with the same key
+		if _, err := c.Db.Exec(database.ReleaseIdempotencyKey, userId, key, claim); err != nil {
+			log.Println("could not release idempotency key: ", err)
+		}
+		return
+	}
+
+	if _, err := c.Db.Exec(database.SaveIdempotentResponse, userId, key, claim, recorder.Status(), recorder.body.Bytes()); err != nil {
+		log.Println("could not save idempotent response: ", err)
+	}
+}
+
+func (c *Controller) replay(ctx *gin.Context, userId int, key string, route string, requestHash string) {
+	var previous struct {
+		Route       string        `db:"route"`
+		RequestHash string        `db:"request_hash"`
+		Status      sql.NullInt32 `db:"status"`
+		Response    []byte        `db:"response"`
+	}
+	if err := c.Db.Get(&previous, database.GetIdempotentResponse, userId, key); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get idempotent response")
+		ctx.Abort()
+		return
+	}
+
+	if previous.Route != route || previous.RequestHash != requestHash {
+		ctx.AbortWithError(http.StatusUnprocessableEntity, errors.New("Idempotency-Key was already used for another request")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if !previous.Status.Valid {
+		ctx.AbortWithError(http.StatusConflict, errors.New("a request with this Idempotency-Key is being processed")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	ctx.Header("Idempotent-Replayed", "true")
+	ctx.Data(int(previous.Status.Int32), gin.MIMEJSON+"; charset=utf-8", previous.Response)
+	ctx.Abort()
+}
+
+// hashRequest identifies the content of the request, the parts of a multipart form are hashed
+// without their boundary, which the clients usually change when retrying. The body is read to its end.
+func hashRequest(contentType string, header string, body io.Reader) (string, error) {
+	hash := sha256.New()
+	if contentType != gin.MIMEMultipartPOSTForm {
+		if _, err := io.Copy(hash, body); err != nil {
+			return "", fmt.Errorf("could not read request: %s", err)
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	_, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "", fmt.Errorf("could not parse content type: %s", err)
+	}
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("could not read form: %s", err)
+		}
+
+		content := sha256.New()
+		if _, err := io.Copy(content, part); err != nil {
+			return "", fmt.Errorf("could not read form: %s", err)
+		}
+		fmt.Fprintf(hash, "%q %q %x\n", part.FormName(), part.FileName(), content.Sum(nil))
+	}
+	if _, err := io.Copy(ioutil.Discard, body); err != nil {
+		return "", fmt.Errorf("could not read request: %s", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,317 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/haran/biophonie-api/controller/user"
+	"github.com/haran/biophonie-api/database"
+	"github.com/haran/biophonie-api/oidc"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	// a login must be completed at the identity provider within oidcLoginLifetime
+	oidcLoginLifetime = 10 * time.Minute
+	// bounds of the names of the accounts (see user.AddUser)
+	minNameLength = 3
+	maxNameLength = 20
+	// number of suffixes tried when the name given by the identity provider is taken
+	maxNameAttempts = 10
+	defaultName     = "member"
+	// number of times the account of a first login is created again when a concurrent login took its name
+	maxAccountAttempts = 3
+	// the cookie binds the state of the login to the browser which started it
+	oidcStateCookie = "oidc_state"
+)
+
+var (
+	errInvalidOidcLogin = errors.New("login expired or was already completed, please log in again")
+	errForeignOidcLogin = errors.New("login was started in another browser, please log in again")
+)
+
+// GetOidcProviders godoc
+// @Summary list the identity providers
+// @Description list the names of the identity providers of the partner organisations
+// @Accept json
+// @Produce json
+// @Tags Authentication
+// @Success 200 {array} string
+// @Router /user/oidc [get]
+func (c *Controller) GetOidcProviders(ctx *gin.Context) {
+	names := make([]string, 0, len(c.oidc))
+	for name := range c.oidc {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ctx.JSON(http.StatusOK, names)
+}
+
+// OidcLogin godoc
+// @Summary log in with an identity provider
+// @Description redirect to the identity provider of a partner organisation, which redirects back to the callback once the user logged in, a cookie binds the login to the browser
+// @Tags Authentication
+// @Param provider path string true "name of the identity provider"
+// @Success 302 {string} string "location of the login page of the provider"
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Failure 502 {object} controller.ErrMsg
+// @Router /user/oidc/{provider}/login [get]
+func (c *Controller) OidcLogin(ctx *gin.Context) {
+	provider, ok := c.oidcProvider(ctx)
+	if !ok {
+		return
+	}
+
+	state, err := randomHex(32)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	verifier, err := randomHex(32)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	location, err := provider.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadGateway, fmt.Errorf("identity provider is unavailable: %s", err)).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if _, err := c.Db.Exec(database.PostOidcLogin, state, provider.Name, nonce, verifier, oidcLoginLifetime.Seconds()); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not store login: %s", err))
+		return
+	}
+
+	setStateCookie(ctx, provider, hashToken(state), int(oidcLoginLifetime.Seconds()))
+
+	ctx.Redirect(http.StatusFound, location)
+}
+
+// OidcCallback godoc
+// @Summary complete the login with an identity provider
+// @Description exchange the code given by the identity provider for an access token and a refresh token, the account is created on the first login with the name given by the provider (made unique)
+// @Accept json
+// @Produce json
+// @Tags Authentication
+// @Param provider path string true "name of the identity provider"
+// @Param code query string true "authorization code"
+// @Param state query string true "state of the login"
+// @Success 200 {object} user.AccessToken
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Failure 502 {object} controller.ErrMsg
+// @Router /user/oidc/{provider}/callback [get]
+func (c *Controller) OidcCallback(ctx *gin.Context) {
+	provider, ok := c.oidcProvider(ctx)
+	if !ok {
+		return
+	}
+
+	if refusal := ctx.Query("error"); refusal != "" {
+		ctx.AbortWithError(http.StatusUnauthorized, fmt.Errorf("identity provider refused the login: %s", refusal)).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var callback user.OidcCallback
+	if err := ctx.BindQuery(&callback); err != nil {
+		return
+	}
+
+	// without the cookie, an attacker could send the callback of their own login to a victim,
+	// who would then record their sounds in the account of the attacker
+	cookie, err := ctx.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(hashToken(callback.State))) != 1 {
+		ctx.AbortWithError(http.StatusUnauthorized, errForeignOidcLogin).SetType(gin.ErrorTypePublic)
+		return
+	}
+	setStateCookie(ctx, provider, "", -1)
+
+	var login struct {
+		Nonce    string `db:"nonce"`
+		Verifier string `db:"verifier"`
+	}
+	if err := c.Db.Get(&login, database.UseOidcLogin, callback.State, provider.Name, oidcLoginLifetime.Seconds()); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.AbortWithError(http.StatusUnauthorized, errInvalidOidcLogin).SetType(gin.ErrorTypePublic)
+			return
+		}
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not get login: %s", err))
+		return
+	}
+
+	claims, err := provider.Exchange(callback.Code, login.Verifier, login.Nonce)
+	if errors.Is(err, oidc.ErrVerification) {
+		ctx.AbortWithError(http.StatusUnauthorized, err).SetType(gin.ErrorTypePublic)
+		return
+	} else if err != nil {
+		ctx.AbortWithError(http.StatusBadGateway, fmt.Errorf("identity provider is unavailable: %s", err)).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	issuer, err := provider.IssuerId()
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadGateway, fmt.Errorf("identity provider is unavailable: %s", err)).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	userId, err := c.oidcAccount(issuer, claims)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	tokens, err := c.startSession(ctx, userId)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// oidcProvider aborts unless the provider of the path is configured
+func (c *Controller) oidcProvider(ctx *gin.Context) (*oidc.Provider, bool) {
+	provider, ok := c.oidc[ctx.Param("provider")]
+	if !ok {
+		ctx.AbortWithError(http.StatusNotFound, fmt.Errorf("unknown identity provider %q", ctx.Param("provider"))).SetType(gin.ErrorTypePublic)
+		return nil, false
+	}
+	return provider, true
+}
+
+// setStateCookie keeps the hash of the state in the browser, lax so that it survives the redirection
+// of the provider from its own site
+func setStateCookie(ctx *gin.Context, provider *oidc.Provider, value string, maxAge int) {
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcStateCookie, value, maxAge, "/", "", strings.HasPrefix(provider.RedirectUrl, "https://"), true)
+}
+
+// oidcAccount returns the account of the subject of the issuer, created on its first login
+func (c *Controller) oidcAccount(issuer string, claims *oidc.Claims) (int, error) {
+	// a concurrent login may take the free name or create the identity before we commit
+	for attempt := 1; ; attempt++ {
+		id, err := c.lookupOidcAccount(issuer, claims)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation" && attempt < maxAccountAttempts {
+			continue
+		}
+		return id, err
+	}
+}
+
+// lookupOidcAccount returns the account of the subject, or creates it in a transaction
+func (c *Controller) lookupOidcAccount(issuer string, claims *oidc.Claims) (int, error) {
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("could not begin identity lookup: %s", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.Get(&id, database.UseIdentity, issuer, claims.Subject); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("could not get identity: %s", err)
+		}
+
+		name, err := uniqueName(tx, claims)
+		if err != nil {
+			return 0, err
+		}
+		// the generated password is never returned, the user can rotate it to log in without the provider
+		_, hashedPassword, err := c.newPassword()
+		if err != nil {
+			return 0, err
+		}
+		if err := tx.Get(&id, database.PostUser, name, hashedPassword); err != nil {
+			return 0, fmt.Errorf("could not create user: %w", err)
+		}
+		if _, err := tx.Exec(database.PostIdentity, id, issuer, claims.Subject); err != nil {
+			return 0, fmt.Errorf("could not create identity: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit identity: %s", err)
+	}
+	return id, nil
+}
+
+// uniqueName derives a free account name from the claims, adding a random suffix when it is taken
+func uniqueName(db sqlx.Queryer, claims *oidc.Claims) (string, error) {
+	base := defaultName
+	for _, candidate := range []string{claims.PreferredUsername, claims.Name, strings.SplitN(claims.Email, "@", 2)[0]} {
+		if name := sanitizeName(candidate); utf8.RuneCountInString(name) >= minNameLength {
+			base = name
+			break
+		}
+	}
+
+	for i := 0; i < maxNameAttempts; i++ {
+		name := base
+		if i > 0 {
+			suffix, err := randomHex(2)
+			if err != nil {
+				return "", err
+			}
+			runes := []rune(base)
+			if len(runes) > maxNameLength-len(suffix) {
+				runes = runes[:maxNameLength-len(suffix)]
+			}
+			name = string(runes) + suffix
+		}
+
+		var taken bool
+		if err := sqlx.Get(db, &taken, database.IsNameTaken, name); err != nil {
+			return "", fmt.Errorf("could not check name: %s", err)
+		}
+		if !taken {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("could not find a free name from %q", base)
+}
+
+// sanitizeName keeps the letters, digits, dots, dashes and underscores of the name, up to maxNameLength
+func sanitizeName(name string) string {
+	var kept []rune
+	for _, r := range strings.ReplaceAll(strings.TrimSpace(name), " ", "-") {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_' {
+			kept = append(kept, r)
+		}
+		if len(kept) == maxNameLength {
+			break
+		}
+	}
+	return string(kept)
+}
+
+func randomHex(n int) (string, error) {
+	secret := make([]byte, n)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("could not generate random value: %s", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
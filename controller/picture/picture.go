@@ -0,0 +1,24 @@
+package picture
+
+import (
+	"mime/multipart"
+	"time"
+)
+
+type Template struct {
+	Id         int       `db:"id" json:"id" example:"1"`
+	Name       string    `db:"name" json:"name" example:"forest"`
+	Picture    string    `db:"picture" json:"picture" example:"forest.webp"`
+	Retired    bool      `db:"retired" json:"retired" example:"false"`
+	CreatedOn  time.Time `db:"created_on" json:"createdOn" example:"2022-05-26T11:17:35.079344Z"`
+	PictureUrl string    `db:"-" json:"pictureUrl" example:"https://example.com/api/v1/assets/picture/forest.webp"`
+}
+
+type AddTemplate struct {
+	Name    string                `form:"name" example:"forest" binding:"required,min=3,max=30,alphanum,lowercase"`
+	Picture *multipart.FileHeader `form:"picture" binding:"required"`
+}
+
+type RenameTemplate struct {
+	Name string `json:"name" example:"forest" binding:"required,min=3,max=30,alphanum,lowercase"`
+}
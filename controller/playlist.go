@@ -0,0 +1,480 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/haran/biophonie-api/controller/playlist"
+	"github.com/haran/biophonie-api/database"
+	"github.com/lib/pq"
+)
+
+var errGeoPointNotEnabled = errors.New("geopoint does not exist or is not enabled")
+
+// GetFavourites godoc
+// @Summary list the favourite geopoints
+// @Description list the enabled geopoints bookmarked by the user, the most recent first
+// @Accept json
+// @Produce json
+// @Tags Playlist
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} playlist.Favourites
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/favourite [get]
+func (c *Controller) GetFavourites(ctx *gin.Context) {
+	var favourites playlist.Favourites
+	if err := c.Db.Get(&favourites, database.GetFavourites, ctx.GetInt("userId")); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get favourites")
+		ctx.Abort()
+		return
+	}
+
+	ctx.JSON(http.StatusOK, favourites)
+}
+
+// AddFavourite godoc
+// @Summary bookmark a geopoint
+// @Description add the enabled geopoint to the favourites of the user, bookmarking it twice has no effect
+// @Accept json
+// @Produce json
+// @Tags Playlist
+// @Param id path int true "geopoint id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {string} string
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/favourite/{id} [put]
+func (c *Controller) AddFavourite(ctx *gin.Context) {
+	geoId, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if !c.isEnabled(ctx, geoId) {
+		return
+	}
+
+	if _, err := c.Db.Exec(database.PostFavourite, ctx.GetInt("userId"), geoId); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "geopoint was added to favourites"})
+}
+
+// RemoveFavourite godoc
+// @Summary remove a bookmark
+// @Description remove the geopoint from the favourites of the user
+// @Accept json
+// @Produce json
+// @Tags Playlist
+// @Param id path int true "geopoint id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {string} string
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/favourite/{id} [delete]
+func (c *Controller) RemoveFavourite(ctx *gin.Context) {
+	geoId, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	result, err := c.Db.Exec(database.DeleteFavourite, ctx.GetInt("userId"), geoId)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if rowsAffected != 1 {
+		ctx.AbortWithError(http.StatusNotFound, fmt.Errorf("not found")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "geopoint was removed from favourites"})
+}
+
+// GetPlaylists godoc
+// @Summary list the playlists
+// @Description list the playlists of the user with their enabled geopoints in order
+// @Accept json
+// @Produce json
+// @Tags Playlist
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {array} playlist.Playlist
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/playlist [get]
+func (c *Controller) GetPlaylists(ctx *gin.Context) {
+	playlists := make([]playlist.Playlist, 0)
+	if err := c.Db.Select(&playlists, database.GetPlaylists, ctx.GetInt("userId")); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get playlists")
+		ctx.Abort()
+		return
+	}
+
+	ctx.JSON(http.StatusOK, playlists)
+}
+
+// GetPlaylist godoc
+// @Summary get a playlist
+// @Description retrieve a playlist of the user with its enabled geopoints in order
+// @Accept json
+// @Produce json
+// @Tags Playlist
+// @Param id path int true "playlist id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} playlist.Playlist
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 403 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/playlist/{id} [get]
+func (c *Controller) GetPlaylist(ctx *gin.Context) {
+	id, ok := c.ownPlaylist(ctx)
+	if !ok {
+		return
+	}
+
+	c.respondPlaylist(ctx, id)
+}
+
+// CreatePlaylist godoc
+// @Summary create a playlist
+// @Description create a named playlist of enabled geopoints, in the order of the list
+// @Accept json
+// @Produce json
+// @Tags Playlist
+// @Param playlist body playlist.AddPlaylist true "name and geopoints"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} playlist.Playlist
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/playlist [post]
+func (c *Controller) CreatePlaylist(ctx *gin.Context) {
+	var addPlaylist playlist.AddPlaylist
+	if err := ctx.BindJSON(&addPlaylist); err != nil {
+		return
+	}
+
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not begin playlist creation: %s", err))
+		return
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.Get(&id, database.PostPlaylist, ctx.GetInt("userId"), addPlaylist.Name); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not create playlist")
+		ctx.Abort()
+		return
+	}
+
+	for _, geoId := range addPlaylist.GeoPoints {
+		result, err := tx.Exec(database.AppendToPlaylist, id, geoId)
+		if err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not add geopoint to playlist: %s", err))
+			return
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected != 1 {
+			ctx.AbortWithError(http.StatusBadRequest, errGeoPointNotEnabled).SetType(gin.ErrorTypePublic)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not commit playlist creation: %s", err))
+		return
+	}
+
+	c.respondPlaylist(ctx, uint64(id))
+}
+
+// RenamePlaylist godoc
+// @Summary rename a playlist
+// @Description rename a playlist of the user
+// @Accept json
+// @Produce json
+// @Tags Playlist
+// @Param id path int true "playlist id"
+// @Param playlist body playlist.RenamePlaylist true "new name"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} playlist.Playlist
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 403 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/playlist/{id} [patch]
+func (c *Controller) RenamePlaylist(ctx *gin.Context) {
+	var rename playlist.RenamePlaylist
+	if err := ctx.BindJSON(&rename); err != nil {
+		return
+	}
+
+	id, ok := c.ownPlaylist(ctx)
+	if !ok {
+		return
+	}
+
+	if _, err := c.Db.Exec(database.RenamePlaylist, id, rename.Name); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not rename playlist")
+		ctx.Abort()
+		return
+	}
+
+	c.respondPlaylist(ctx, id)
+}
+
+// DeletePlaylist godoc
+// @Summary delete a playlist
+// @Description delete a playlist of the user, its geopoints are kept
+// @Accept json
+// @Produce json
+// @Tags Playlist
+// @Param id path int true "playlist id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {string} string
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 403 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/playlist/{id} [delete]
+func (c *Controller) DeletePlaylist(ctx *gin.Context) {
+	id, ok := c.ownPlaylist(ctx)
+	if !ok {
+		return
+	}
+
+	if _, err := c.Db.Exec(database.DeletePlaylist, id); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "playlist was deleted"})
+}
+
+// AddToPlaylist godoc
+// @Summary add a geopoint to a playlist
+// @Description append the enabled geopoint at the end of a playlist of the user
+// @Accept json
+// @Produce json
+// @Tags Playlist
+// @Param id path int true "playlist id"
+// @Param geoId path int true "geopoint id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} playlist.Playlist
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 403 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/playlist/{id}/geopoint/{geoId} [put]
+func (c *Controller) AddToPlaylist(ctx *gin.Context) {
+	geoId, err := strconv.ParseUint(ctx.Param("geoId"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	id, ok := c.ownPlaylist(ctx)
+	if !ok {
+		return
+	}
+
+	if !c.isEnabled(ctx, geoId) {
+		return
+	}
+
+	if _, err := c.Db.Exec(database.AppendToPlaylist, id, geoId); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not add geopoint to playlist")
+		ctx.Abort()
+		return
+	}
+
+	c.respondPlaylist(ctx, id)
+}
+
+// RemoveFromPlaylist godoc
+// @Summary remove a geopoint from a playlist
+// @Description remove the geopoint from a playlist of the user
+// @Accept json
+// @Produce json
+// @Tags Playlist
+// @Param id path int true "playlist id"
+// @Param geoId path int true "geopoint id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} playlist.Playlist
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 403 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/playlist/{id}/geopoint/{geoId} [delete]
+func (c *Controller) RemoveFromPlaylist(ctx *gin.Context) {
+	geoId, err := strconv.ParseUint(ctx.Param("geoId"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	id, ok := c.ownPlaylist(ctx)
+	if !ok {
+		return
+	}
+
+	result, err := c.Db.Exec(database.RemoveFromPlaylist, id, geoId)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if rowsAffected != 1 {
+		ctx.AbortWithError(http.StatusNotFound, fmt.Errorf("geopoint is not in playlist")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	c.respondPlaylist(ctx, id)
+}
+
+// OrderPlaylist godoc
+// @Summary reorder a playlist
+// @Description set the order of the geopoints of a playlist of the user, the list must contain all of them
+// @Accept json
+// @Produce json
+// @Tags Playlist
+// @Param id path int true "playlist id"
+// @Param order body playlist.OrderPlaylist true "geopoints in the new order"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} playlist.Playlist
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 403 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/playlist/{id}/order [put]
+func (c *Controller) OrderPlaylist(ctx *gin.Context) {
+	var order playlist.OrderPlaylist
+	if err := ctx.BindJSON(&order); err != nil {
+		return
+	}
+
+	id, ok := c.ownPlaylist(ctx)
+	if !ok {
+		return
+	}
+
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not begin playlist order: %s", err))
+		return
+	}
+	defer tx.Rollback()
+
+	var current []int64
+	if err := tx.Select(&current, database.GetPlaylistGeoPoints, id); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not get geopoints of playlist: %s", err))
+		return
+	}
+
+	inPlaylist := make(map[int64]bool)
+	for _, geoId := range current {
+		inPlaylist[geoId] = true
+	}
+	for _, geoId := range order.GeoPoints {
+		if !inPlaylist[geoId] {
+			break
+		}
+		delete(inPlaylist, geoId)
+	}
+	if len(order.GeoPoints) != len(current) || len(inPlaylist) != 0 {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("order must contain each geopoint of the playlist once")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if _, err := tx.Exec(database.OrderPlaylist, id, pq.Int64Array(order.GeoPoints)); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not order playlist: %s", err))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not commit playlist order: %s", err))
+		return
+	}
+
+	c.respondPlaylist(ctx, id)
+}
+
+// ownPlaylist parses the id of the playlist and aborts unless it belongs to the user
+func (c *Controller) ownPlaylist(ctx *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return 0, false
+	}
+
+	var ownerId int
+	if err := c.Db.Get(&ownerId, database.GetPlaylistOwner, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get playlist owner")
+		ctx.Abort()
+		return 0, false
+	}
+
+	if ownerId != ctx.GetInt("userId") {
+		ctx.AbortWithError(http.StatusForbidden, errors.New("playlist belongs to another user")).SetType(gin.ErrorTypePublic)
+		return 0, false
+	}
+	return id, true
+}
+
+// isEnabled aborts unless the geopoint exists and is enabled
+func (c *Controller) isEnabled(ctx *gin.Context, geoId uint64) bool {
+	var enabled int
+	if err := c.Db.Get(&enabled, database.CountEnabledGeoPoints, pq.Int64Array{int64(geoId)}); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not check geopoint: %s", err))
+		return false
+	}
+	if enabled != 1 {
+		ctx.AbortWithError(http.StatusNotFound, errGeoPointNotEnabled).SetType(gin.ErrorTypePublic)
+		return false
+	}
+	return true
+}
+
+func (c *Controller) respondPlaylist(ctx *gin.Context, id uint64) {
+	var p playlist.Playlist
+	if err := c.Db.Get(&p, database.GetPlaylist, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve playlist")
+		ctx.Abort()
+		return
+	}
+
+	ctx.JSON(http.StatusOK, p)
+}
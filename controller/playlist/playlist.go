@@ -0,0 +1,32 @@
+package playlist
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Favourites struct {
+	GeoPoints pq.Int64Array `db:"geopoints" json:"geoPoints" swaggertype:"array,integer" example:"4,2,9"`
+}
+
+type Playlist struct {
+	Id        int           `db:"id" json:"id" example:"1"`
+	UserId    int           `db:"user_id" json:"userId" example:"1"`
+	Name      string        `db:"name" json:"name" example:"Birds at dawn"`
+	CreatedOn time.Time     `db:"created_on" json:"createdOn" example:"2022-05-26T11:17:35.079344Z"`
+	GeoPoints pq.Int64Array `db:"geopoints" json:"geoPoints" swaggertype:"array,integer" example:"4,2,9"`
+}
+
+type AddPlaylist struct {
+	Name      string  `json:"name" example:"Birds at dawn" binding:"required,min=1,max=50"`
+	GeoPoints []int64 `json:"geoPoints" example:"4,2,9" binding:"max=500,unique"`
+}
+
+type RenamePlaylist struct {
+	Name string `json:"name" example:"Birds at dawn" binding:"required,min=1,max=50"`
+}
+
+type OrderPlaylist struct {
+	GeoPoints []int64 `json:"geoPoints" example:"9,4,2" binding:"required,max=500,unique"`
+}
@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/haran/biophonie-api/controller/report"
+	"github.com/haran/biophonie-api/database"
+)
+
+const (
+	// an ip cannot send more than reportsRate anonymous reports during reportsPeriod
+	reportsRate   = 5
+	reportsPeriod = time.Hour
+	// the reports of younger accounts do not count towards hiding a geopoint
+	reporterMinAge = 24 * time.Hour
+)
+
+// ReportGeoPoint godoc
+// @Summary report a geopoint
+// @Description report an abusive geopoint, anonymously or authenticated (an ip can send 5 anonymous reports per hour), the geopoint leaves the map once enough independent reports accumulate (counted by ip, accounts younger than a day do not count)
+// @Accept json
+// @Produce json
+// @Tags Report
+// @Param id path int true "geopoint id"
+// @Param report body report.AddReport true "reason and details"
+// @Param Authorization header string false "Authentication header"
+// @Success 200 {object} report.Report
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 429 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /geopoint/{id}/report [post]
+func (c *Controller) ReportGeoPoint(ctx *gin.Context) {
+	geoId, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var addReport report.AddReport
+	if err := ctx.BindJSON(&addReport); err != nil {
+		return
+	}
+
+	if !c.isEnabled(ctx, geoId) {
+		return
+	}
+
+	id := int(geoId)
+	r, ok := c.postReport(ctx, &id, nil, addReport)
+	if !ok {
+		return
+	}
+
+	if err := c.updateReported(id); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, r)
+}
+
+// ReportUser godoc
+// @Summary report a user
+// @Description report an abusive user, anonymously or authenticated (an ip can send 5 anonymous reports per hour)
+// @Accept json
+// @Produce json
+// @Tags Report
+// @Param name path string true "user name"
+// @Param report body report.AddReport true "reason and details"
+// @Param Authorization header string false "Authentication header"
+// @Success 200 {object} report.Report
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 429 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /user/{name}/report [post]
+func (c *Controller) ReportUser(ctx *gin.Context) {
+	var addReport report.AddReport
+	if err := ctx.BindJSON(&addReport); err != nil {
+		return
+	}
+
+	var accountId int
+	if err := c.Db.Get(&accountId, database.GetAccountId, ctx.Param("name")); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get reported user")
+		ctx.Abort()
+		return
+	}
+
+	r, ok := c.postReport(ctx, nil, &accountId, addReport)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, r)
+}
+
+// GetReports godoc
+// @Summary get the report queue
+// @Description list the reports with the status, the oldest first
+// @Accept json
+// @Produce json
+// @Tags Report
+// @Param status query string false "status of the reports (pending by default)" Enums(pending, resolved, dismissed)
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {array} report.Report
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/report [get]
+func (c *Controller) GetReports(ctx *gin.Context) {
+	queue := report.Queue{Status: report.Pending}
+	if err := ctx.BindQuery(&queue); err != nil {
+		return
+	}
+
+	reports := make([]report.Report, 0)
+	if err := c.Db.Select(&reports, database.GetReports, queue.Status); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get reports")
+		ctx.Abort()
+		return
+	}
+
+	ctx.JSON(http.StatusOK, reports)
+}
+
+// ResolveReport godoc
+// @Summary resolve a report
+// @Description uphold a pending report, a reported geopoint stays hidden from the map
+// @Accept json
+// @Produce json
+// @Tags Report
+// @Param id path int true "report id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} report.Report
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/report/{id}/resolve [patch]
+func (c *Controller) ResolveReport(ctx *gin.Context) {
+	c.handleReport(ctx, report.Resolved)
+}
+
+// DismissReport godoc
+// @Summary dismiss a report
+// @Description reject a pending report, a reported geopoint comes back on the map when the remaining reports are not enough to hide it
+// @Accept json
+// @Produce json
+// @Tags Report
+// @Param id path int true "report id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} report.Report
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/report/{id}/dismiss [patch]
+func (c *Controller) DismissReport(ctx *gin.Context) {
+	c.handleReport(ctx, report.Dismissed)
+}
+
+// postReport saves the report of the geopoint or of the account, anonymous reports are rate limited by ip
+func (c *Controller) postReport(ctx *gin.Context, geoId *int, accountId *int, addReport report.AddReport) (report.Report, bool) {
+	var reporterId *int
+	if userId, ok := ctx.Get("userId"); ok {
+		id := userId.(int)
+		reporterId = &id
+	} else {
+		var recent int
+		if err := c.Db.Get(&recent, database.CountRecentReports, ctx.ClientIP(), reportsPeriod.Seconds()); err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not count recent reports: %s", err))
+			return report.Report{}, false
+		}
+		if recent >= reportsRate {
+			ctx.AbortWithError(http.StatusTooManyRequests, errors.New("too many reports, please try again later or log in")).SetType(gin.ErrorTypePublic)
+			return report.Report{}, false
+		}
+	}
+
+	var id int
+	if err := c.Db.Get(&id, database.PostReport, geoId, accountId, reporterId, ctx.ClientIP(), addReport.Reason, addReport.Details); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not create report")
+		ctx.Abort()
+		return report.Report{}, false
+	}
+
+	var r report.Report
+	if err := c.Db.Get(&r, database.GetReport, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve report")
+		ctx.Abort()
+		return report.Report{}, false
+	}
+	return r, true
+}
+
+// handleReport closes the pending report with the status and updates the visibility of the reported geopoint
+func (c *Controller) handleReport(ctx *gin.Context, status string) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var r report.Report
+	if err := c.Db.Get(&r, database.GetReport, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get report")
+		ctx.Abort()
+		return
+	}
+
+	if r.Status != report.Pending {
+		ctx.AbortWithError(http.StatusConflict, fmt.Errorf("report was already %s", r.Status)).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if _, err := c.Db.Exec(database.HandleReport, id, status, ctx.GetInt("userId")); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	if r.GeoId != nil {
+		if err := c.updateReported(*r.GeoId); err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if err := c.Db.Get(&r, database.GetReport, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve report")
+		ctx.Abort()
+		return
+	}
+
+	ctx.JSON(http.StatusOK, r)
+}
+
+// updateReported hides or shows the geopoint according to its reports and refreshes the map when it changed
+func (c *Controller) updateReported(geoId int) error {
+	result, err := c.Db.Exec(database.UpdateReported, geoId, c.reportsThreshold, reporterMinAge.Seconds())
+	if err != nil {
+		return fmt.Errorf("could not update reported geopoint: %s", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not update reported geopoint: %s", err)
+	}
+	if rowsAffected != 0 {
+		c.refreshGeoJson()
+	}
+	return nil
+}
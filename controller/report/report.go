@@ -0,0 +1,33 @@
+package report
+
+import "time"
+
+const (
+	Pending   = "pending"
+	Resolved  = "resolved"
+	Dismissed = "dismissed"
+)
+
+// Report flags a geopoint or a user, the reporter is empty when the report was anonymous
+type Report struct {
+	Id         int        `db:"id" json:"id" example:"1"`
+	GeoId      *int       `db:"geopoint_id" json:"geoId,omitempty" example:"3"`
+	AccountId  *int       `db:"account_id" json:"accountId,omitempty" example:"5"`
+	ReporterId *int       `db:"reporter_id" json:"reporterId,omitempty" example:"2"`
+	Ip         string     `db:"ip" json:"-"`
+	Reason     string     `db:"reason" json:"reason" example:"privacy"`
+	Details    string     `db:"details" json:"details" example:"I can hear my neighbours talking"`
+	Status     string     `db:"status" json:"status" example:"pending"`
+	CreatedOn  time.Time  `db:"created_on" json:"createdOn" example:"2022-05-26T11:17:35.079344Z"`
+	HandledOn  *time.Time `db:"handled_on" json:"handledOn,omitempty" example:"2022-05-27T09:02:11.079344Z"`
+	HandledBy  *int       `db:"handled_by" json:"handledBy,omitempty" example:"1"`
+}
+
+type AddReport struct {
+	Reason  string `json:"reason" example:"privacy" binding:"required,oneof=spam offensive privacy copyright other"`
+	Details string `json:"details" example:"I can hear my neighbours talking" binding:"max=500"`
+}
+
+type Queue struct {
+	Status string `form:"status" example:"pending" binding:"oneof=pending resolved dismissed"`
+}
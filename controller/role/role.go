@@ -0,0 +1,51 @@
+package role
+
+const (
+	Contributor = "contributor"
+	Moderator   = "moderator"
+	Admin       = "admin"
+)
+
+// permissions checked by Controller.AuthorizePermission
+const (
+	ModerateGeoPoints = "geopoints:moderate"
+	ModerateComments  = "comments:moderate"
+	ModerateWalks     = "walks:moderate"
+	HandleReports     = "reports:handle"
+	ManageUsers       = "users:manage"
+	ManageTemplates   = "templates:manage"
+	ManageZones       = "zones:manage"
+	CheckAssets       = "assets:check"
+	ManageApiKeys     = "apikeys:manage"
+)
+
+// Roles are ordered from the least to the most privileged
+var Roles = []Role{
+	{Name: Contributor, Permissions: []string{}},
+	{Name: Moderator, Permissions: []string{ModerateGeoPoints, ModerateComments, ModerateWalks, HandleReports}},
+	{Name: Admin, Permissions: []string{ModerateGeoPoints, ModerateComments, ModerateWalks, HandleReports, ManageUsers, ManageTemplates, ManageZones, CheckAssets, ManageApiKeys}},
+}
+
+type Role struct {
+	Name        string   `json:"name" example:"moderator"`
+	Permissions []string `json:"permissions" example:"geopoints:moderate,comments:moderate"`
+}
+
+type SetRole struct {
+	Role string `json:"role" example:"moderator" binding:"required,oneof=contributor moderator admin"`
+}
+
+// Can tells whether the role has the permission, unknown roles have none
+func Can(name string, permission string) bool {
+	for _, role := range Roles {
+		if role.Name != name {
+			continue
+		}
+		for _, p := range role.Permissions {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
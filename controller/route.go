@@ -1,27 +1,38 @@
 package controller
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/cridenour/go-postgis"
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
-	"github.com/google/uuid"
 	"github.com/h2non/filetype/matchers"
 	"github.com/haran/biophonie-api/controller/geopoint"
+	"github.com/haran/biophonie-api/controller/role"
 	"github.com/haran/biophonie-api/controller/user"
 	"github.com/haran/biophonie-api/database"
 	"github.com/haran/biophonie-api/httputil"
+	"github.com/haran/biophonie-api/solar"
+	"github.com/haran/biophonie-api/storage"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// a name cannot fail to log in more than loginFailuresPerName times during loginFailuresPeriod,
+	// an ip, which may be shared, loginFailuresPerIp times
+	loginFailuresPerName = 10
+	loginFailuresPerIp   = 100
+	loginFailuresPeriod  = 15 * time.Minute
+)
+
 // PostUser godoc
 // @Summary create user
-// @Description create a user in the database
+// @Description create a user in the database with a generated password, returned only once, and optionally a password chosen by the user
 // @Accept json
 // @Produce json
 // @Tags User
@@ -37,35 +48,59 @@ func (c *Controller) PostUser(ctx *gin.Context) {
 		return
 	}
 
-	// generate password and hash it
-	password := uuid.New().String()
-	hashedToken, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	var chosenHash []byte
+	if addUser.Password != "" {
+		if err := checkStrength(addUser.Name, addUser.Password); err != nil {
+			ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+			return
+		}
+		var err error
+		if chosenHash, err = bcrypt.GenerateFromPassword([]byte(addUser.Password), c.bcryptCost); err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not hash chosen password: %s", err))
+			return
+		}
+	}
+
+	password, hashedToken, err := c.newPassword()
 	if err != nil {
-		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not hash password: %s", err))
+		ctx.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
 
-	stmt, err := c.Db.Preparex(database.PostUser)
+	tx, err := c.Db.Beginx()
 	if err != nil {
-		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not prepare user creation: %s", err))
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not begin user creation: %s", err))
 		return
 	}
+	defer tx.Rollback()
 
 	var id int
-	if err := stmt.Get(&id, addUser.Name, hashedToken); err != nil {
+	if err := tx.Get(&id, database.PostUser, addUser.Name, hashedToken); err != nil {
 		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not create user")
 		ctx.Abort()
 		return
 	}
 
+	if chosenHash != nil {
+		if _, err := tx.Exec(database.SetChosenPassword, id, chosenHash); err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not set chosen password: %s", err))
+			return
+		}
+	}
+
 	var user user.User
-	if err := c.Db.Get(&user, database.GetUserById, id); err != nil {
+	if err := tx.Get(&user, database.GetUserById, id); err != nil {
 		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve created user")
 		ctx.Abort()
 		return
 	}
 	user.Password = password
 
+	if err := tx.Commit(); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not commit user creation: %s", err))
+		return
+	}
+
 	ctx.JSON(http.StatusOK, user)
 }
 
@@ -140,19 +175,26 @@ func (c *Controller) GetGeoPoint(ctx *gin.Context) {
 		return
 	}
 
-	if !geopoint.Available && !ctx.GetBool("admin") {
+	if !geopoint.Available && !can(ctx, role.ModerateGeoPoints) {
 		ctx.AbortWithError(http.StatusForbidden, errors.New("geopoint is not enabled yet")).SetType(gin.ErrorTypePublic)
 		return
 	}
-	geopoint.Latitude = geopoint.Location.Y
-	geopoint.Longitude = geopoint.Location.X
+	// only moderators see where the geopoint was precisely recorded
+	if can(ctx, role.ModerateGeoPoints) {
+		geopoint.Latitude = geopoint.Location.Y
+		geopoint.Longitude = geopoint.Location.X
+	} else {
+		geopoint.Latitude = geopoint.PublicLocation.Y
+		geopoint.Longitude = geopoint.PublicLocation.X
+	}
+	c.setAssetUrls(geopoint.GeoPoint)
 
 	ctx.JSON(http.StatusOK, geopoint)
 }
 
 // GetAssets godoc
 // @Summary get the picture and sound filenames
-// @Description located in assets/
+// @Description located in assets/, with their SHA-256 to verify the downloads (empty for pictures of templates)
 // @Accept json
 // @Produce json
 // @Tags Geopoint
@@ -176,12 +218,21 @@ func (c *Controller) GetAssets(ctx *gin.Context) {
 		return
 	}
 
-	if !point.Available && !ctx.GetBool("admin") {
+	if !point.Available && !can(ctx, role.ModerateGeoPoints) {
 		ctx.AbortWithError(http.StatusForbidden, errors.New("geopoint is not enabled yet")).SetType(gin.ErrorTypePublic)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, geopoint.Assets{Picture: point.Picture, Sound: point.Sound})
+	ctx.JSON(http.StatusOK, geopoint.Assets{
+		Picture:         point.Picture,
+		Sound:           point.Sound,
+		PictureUrl:      c.store.URL(storage.PictureKey(point.Picture)),
+		SoundUrl:        c.store.URL(storage.SoundKey(point.Sound)),
+		PictureChecksum: point.PictureChecksum,
+		PictureSize:     point.PictureSize,
+		SoundChecksum:   point.SoundChecksum,
+		SoundSize:       point.SoundSize,
+	})
 }
 
 // GetClosestGeoPoint godoc
@@ -194,6 +245,8 @@ func (c *Controller) GetAssets(ctx *gin.Context) {
 // @Param longitude path float64 true "longitude"
 // @Param srid query int32 false "srid to project"
 // @Param not[] query []int32 false "optional ids to exclude from search"
+// @Param country query string false "optional ISO code of the country of the geopoint"
+// @Param phase query string false "optional phase of the day of the recording" Enums(night, dawn, day, dusk)
 // @Success 200 {object} geopoint.ClosestGeoId
 // @Failure 400 {object} controller.ErrMsg
 // @Failure 403 {object} controller.ErrMsg
@@ -215,7 +268,7 @@ func (c *Controller) GetClosestGeoPoint(ctx *gin.Context) {
 	}
 
 	var geoId geopoint.ClosestGeoId
-	if err := c.Db.Get(&geoId, database.GetClosestGeoId, target, closestTo.IdExcluded); err != nil {
+	if err := c.Db.Get(&geoId, database.GetClosestGeoId, target, closestTo.IdExcluded, closestTo.Country, closestTo.Phase); err != nil {
 		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get closest geopoint")
 		ctx.Abort()
 		return
@@ -276,14 +329,16 @@ func (c *Controller) DeleteGeoPoint(ctx *gin.Context) {
 
 // AuthorizeUser godoc
 // @Summary create a token
-// @Description create a token
+// @Description create a short-lived access token and a refresh token starting a new session, with the password of the account or of a device credential, a name can fail 10 times per 15 minutes
 // @Accept json
 // @Produce json
 // @Tags Authentication
 // @Param user body user.AuthUser true "authentication user"
-// @Success 200 {string} user.AccessToken "token to use for authentication"
+// @Success 200 {object} user.AccessToken "token to use for authentication and refresh token"
 // @Failure 400 {object} controller.ErrMsg
 // @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 429 {object} controller.ErrMsg
 // @Failure 500 {object} controller.ErrMsg
 // @Router /user/authorize [post]
 func (c *Controller) AuthorizeUser(ctx *gin.Context) {
@@ -292,32 +347,46 @@ func (c *Controller) AuthorizeUser(ctx *gin.Context) {
 		return
 	}
 
-	var authorizedUser user.User
-	if err := c.Db.Get(&authorizedUser, database.GetUserByName, authUser.Name); err != nil {
-		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get password")
-		ctx.Abort()
+	var throttled bool
+	if err := c.Db.Get(&throttled, database.IsLoginThrottled, authUser.Name, ctx.ClientIP(), loginFailuresPerName, loginFailuresPerIp, loginFailuresPeriod.Seconds()); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not count login failures: %s", err))
+		return
+	}
+	if throttled {
+		ctx.AbortWithError(http.StatusTooManyRequests, errors.New("too many failed logins, please try again later")).SetType(gin.ErrorTypePublic)
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(authorizedUser.Password), []byte(authUser.Password)); err != nil {
-		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not compare password and hash")
+	var authorizedUser user.User
+	err := c.Db.Get(&authorizedUser, database.GetUserByName, authUser.Name)
+	if err == nil {
+		err = c.checkPassword(authorizedUser, authUser.Password)
+	}
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		if _, err := c.Db.Exec(database.PostLoginFailure, authUser.Name, ctx.ClientIP(), loginFailuresPeriod.Seconds()); err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not record login failure: %s", err))
+			return
+		}
+	}
+	if err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not check password")
 		ctx.Abort()
 		return
 	}
 
-	token, err := c.createToken(authorizedUser.Name, authorizedUser.Admin)
+	tokens, err := c.startSession(ctx, authorizedUser.Id)
 	if err != nil {
-		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not sign token: %s", err))
+		ctx.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
 
 	ctx.Header("Content-Type", "application/json")
-	ctx.JSON(http.StatusOK, user.AccessToken{Token: token})
+	ctx.JSON(http.StatusOK, tokens)
 }
 
 // MakeAdmin godoc
 // @Summary make a user admin
-// @Description make a user admin
+// @Description make a user admin, effective on the current tokens
 // @Accept json
 // @Produce plain
 // @Tags Authentication
@@ -330,34 +399,141 @@ func (c *Controller) AuthorizeUser(ctx *gin.Context) {
 // @Failure 500 {object} controller.ErrMsg
 // @Router /restricted/user/{id} [patch]
 func (c *Controller) MakeAdmin(ctx *gin.Context) {
+	if id, ok := c.assignRole(ctx, role.Admin); ok {
+		c.forgetRoles(id)
+		ctx.JSON(http.StatusOK, gin.H{"message": "user is now admin"})
+	}
+}
+
+// DemoteAdmin godoc
+// @Summary demote an admin
+// @Description make an admin a contributor, effective on the current tokens, the last admin cannot be demoted
+// @Accept json
+// @Produce plain
+// @Tags Authentication
+// @Param id path int true "user id"
+// @Success 200 {string} string "user is not admin anymore"
+// @Param Authorization header string true "Authentication header"
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/user/{id}/demote [patch]
+func (c *Controller) DemoteAdmin(ctx *gin.Context) {
 	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
 	if err != nil {
 		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
 		return
 	}
 
-	result, err := c.Db.Exec(database.MakeAdmin, id)
+	var demoted user.User
+	if err := c.Db.Get(&demoted, database.GetUserById, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get user")
+		ctx.Abort()
+		return
+	}
+
+	if demoted.Role == role.Admin {
+		if _, ok := c.assignRole(ctx, role.Contributor); !ok {
+			return
+		}
+	}
+	c.forgetRoles(int(id))
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "user is not admin anymore"})
+}
+
+// SetRole godoc
+// @Summary set the role of a user
+// @Description contributors create geopoints, moderators moderate them with their comments, walks and reports, admins also manage the users and the settings
+// @Accept json
+// @Produce json
+// @Tags Authentication
+// @Param id path int true "user id"
+// @Param role body role.SetRole true "new role"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} user.User
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/user/{id}/role [patch]
+func (c *Controller) SetRole(ctx *gin.Context) {
+	var setRole role.SetRole
+	if err := ctx.BindJSON(&setRole); err != nil {
+		return
+	}
+
+	id, ok := c.assignRole(ctx, setRole.Role)
+	if !ok {
+		return
+	}
+	c.forgetRoles(id)
+
+	var updated user.User
+	if err := c.Db.Get(&updated, database.GetUserById, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve user")
+		ctx.Abort()
+		return
+	}
+	updated.Password = ""
+
+	ctx.JSON(http.StatusOK, updated)
+}
+
+// GetRoles godoc
+// @Summary list the roles
+// @Description list the roles with their permissions, from the least to the most privileged
+// @Accept json
+// @Produce json
+// @Tags Authentication
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {array} role.Role
+// @Failure 401 {object} controller.ErrMsg
+// @Router /restricted/role [get]
+func (c *Controller) GetRoles(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, role.Roles)
+}
+
+// assignRole gives the role to the user of the path, the last admin keeps its role
+func (c *Controller) assignRole(ctx *gin.Context, newRole string) (int, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return 0, false
+	}
+
+	var assigned user.User
+	if err := c.Db.Get(&assigned, database.GetUserById, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get user")
+		ctx.Abort()
+		return 0, false
+	}
+
+	result, err := c.Db.Exec(database.SetRole, id, newRole)
 	if err != nil {
 		ctx.AbortWithError(http.StatusInternalServerError, err)
-		return
+		return 0, false
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		ctx.AbortWithError(http.StatusInternalServerError, err)
-		return
+		return 0, false
 	}
 	if rowsAffected != 1 {
-		ctx.AbortWithError(http.StatusNotFound, fmt.Errorf("not found")).SetType(gin.ErrorTypePublic)
-		return
+		ctx.AbortWithError(http.StatusConflict, errors.New("the last admin cannot lose its role")).SetType(gin.ErrorTypePublic)
+		return 0, false
 	}
-
-	ctx.JSON(http.StatusOK, gin.H{"message": "user is now admin"})
+	return int(id), true
 }
 
 // BindGeoPoint godoc
 // @Summary create a geopoint
-// @Description create the geopoint in the database and save the sound and picture file (see testgeopoint dir)
+// @Description create the geopoint in the database and save the sound and picture file (see testgeopoint dir),
+// @Description duplicateOf is the id of the original geopoint when the sound was probably already uploaded
 // @Accept mpfd
 // @Produce json
 // @Tags Geopoint
@@ -365,8 +541,11 @@ func (c *Controller) MakeAdmin(ctx *gin.Context) {
 // @Param sound formData file true "geopoint sound in aac"
 // @Param picture formData file false "geopoint picture in webp"
 // @Param Authorization header string true "Authentication header"
+// @Param Idempotency-Key header string false "unique key of the creation, a retry with the same key returns the first geopoint"
 // @Success 200 {object} geopoint.GeoPoint
 // @Failure 404 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 422 {object} controller.ErrMsg
 // @Failure 500 {object} controller.ErrMsg
 // @Router /restricted/geopoint [post]
 func (c *Controller) BindGeoPoint(ctx *gin.Context) {
@@ -388,30 +567,81 @@ func (c *Controller) BindGeoPoint(ctx *gin.Context) {
 		return
 	}
 
-	if err := validator.New().Struct(addGeo); err != nil {
+	if err := c.validate.Struct(addGeo); err != nil {
 		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	soundName := uuid.NewString() + ".aac"
-	pictureName := uuid.NewString() + ".webp"
 	if !httputil.CheckFileContentType(bindGeo.Sound, matchers.Aac) {
 		ctx.AbortWithError(http.StatusBadRequest, errors.New("sound was not aac file")).SetType(gin.ErrorTypePublic)
 		return
 	}
 
+	if addGeo.PictureTemplate == "" && !httputil.CheckFileContentType(bindGeo.Picture, matchers.Webp) {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("image was not webp file")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	geoPoint, err := c.newGeoPoint(ctx, addGeo)
+	if errors.Is(err, errUnknownTemplate) {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	} else if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not get picture template: %s", err))
+		return
+	}
+
+	soundChecksum, err := fileChecksum(bindGeo.Sound)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not hash sound: %s", err))
+		return
+	}
+	if addGeo.SoundChecksum != "" && addGeo.SoundChecksum != soundChecksum {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("checksum of sound does not match")).SetType(gin.ErrorTypePublic)
+		return
+	}
+	geoPoint.SetSound(soundChecksum, bindGeo.Sound.Size)
+	assets := []asset{fileAsset(storage.SoundKey(geoPoint.Sound), bindGeo.Sound)}
+	if geoPoint.Fingerprint, err = soundFingerprint(assets[0]); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not fingerprint sound: %s", err))
+		return
+	}
+
 	if addGeo.PictureTemplate == "" {
-		if !httputil.CheckFileContentType(bindGeo.Picture, matchers.Webp) {
-			ctx.AbortWithError(http.StatusBadRequest, errors.New("image was not webp file")).SetType(gin.ErrorTypePublic)
+		pictureChecksum, err := fileChecksum(bindGeo.Picture)
+		if err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not hash picture: %s", err))
 			return
 		}
-	} else {
-		pictureName = addGeo.PictureTemplate + ".webp"
+		if addGeo.PictureChecksum != "" && addGeo.PictureChecksum != pictureChecksum {
+			ctx.AbortWithError(http.StatusBadRequest, errors.New("checksum of picture does not match")).SetType(gin.ErrorTypePublic)
+			return
+		}
+		geoPoint.SetPicture(pictureChecksum, bindGeo.Picture.Size)
+		assets = append(assets, fileAsset(storage.PictureKey(geoPoint.Picture), bindGeo.Picture))
+	}
+
+	ctx.Set("assets", assets)
+	ctx.Set("geoPoint", geoPoint)
+}
+
+// newGeoPoint builds a validated geopoint, using the picture of its template if any.
+// The other assets are named after their content by the caller.
+func (c *Controller) newGeoPoint(ctx *gin.Context, addGeo geopoint.AddGeoPoint) (geopoint.GeoPoint, error) {
+	var pictureName string
+	if addGeo.PictureTemplate != "" {
+		var err error
+		if pictureName, err = c.templatePicture(addGeo.PictureTemplate); err != nil {
+			return geopoint.GeoPoint{}, err
+		}
 	}
 
 	addGeo.UserId, _ = ctx.MustGet("userId").(int)
+	if addGeo.Privacy == "" {
+		addGeo.Privacy = geopoint.Precise
+	}
 
-	geoPoint := geopoint.GeoPoint{
+	return geopoint.GeoPoint{
 		Title:      addGeo.Title,
 		UserId:     addGeo.UserId,
 		Latitude:   addGeo.Latitude,
@@ -419,41 +649,97 @@ func (c *Controller) BindGeoPoint(ctx *gin.Context) {
 		CreatedOn:  addGeo.Date,
 		Amplitudes: addGeo.Amplitudes,
 		Picture:    pictureName,
-		Sound:      soundName,
-	}
-
-	ctx.Set("bindGeo", bindGeo)
-	ctx.Set("geoPoint", geoPoint)
+		Features:   geopoint.Features(addGeo.Amplitudes),
+		Privacy:    addGeo.Privacy,
+	}, nil
 }
 
+// maxFingerprintDistance is the number of differing bits under which two recordings are considered the same
+const maxFingerprintDistance = 6
+
 func (c *Controller) CreateGeoPoint(ctx *gin.Context) {
-	bindGeo, _ := ctx.MustGet("bindGeo").(geopoint.BindGeoPoint)
+	assets, _ := ctx.MustGet("assets").([]asset)
 	geoPoint, _ := ctx.MustGet("geoPoint").(geopoint.GeoPoint)
 
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not begin geopoint creation: %s", err))
+		return
+	}
+	defer tx.Rollback()
+
+	// the assets are staged first so that neither a row without files nor files without row are left on failure
+	staged, err := c.stageAssets(ctx, tx, assets)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// a probable duplicate is still created, the uploader is warned and the moderators decide
+	var originalId int
+	if err := tx.Get(&originalId, database.GetOriginalGeoPoint, geoPoint.SoundChecksum, geoPoint.Fingerprint, maxFingerprintDistance); err == nil {
+		geoPoint.DuplicateOf = &originalId
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		c.removeAssets(ctx, stagingKeys(staged))
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not look for duplicates: %s", err))
+		return
+	}
+
 	dbGeoPoint := geopoint.DbGeoPoint{GeoPoint: &geoPoint, Location: postgis.PointS{SRID: geopoint.WGS84, X: geoPoint.Longitude, Y: geoPoint.Latitude}}
-	stmt, err := c.Db.PrepareNamed(database.PostGeoPoint)
+
+	// the location is always generalized in the privacy zones
+	var inPrivacyZone bool
+	if err := tx.Get(&inPrivacyZone, database.InPrivacyZone, dbGeoPoint.Location); err != nil {
+		c.removeAssets(ctx, stagingKeys(staged))
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not look for privacy zones: %s", err))
+		return
+	}
+	privacy := geoPoint.Privacy
+	if inPrivacyZone {
+		privacy = geopoint.Coarse
+	}
+	latitude, longitude := geopoint.PublicLocation(geoPoint.Latitude, geoPoint.Longitude, privacy)
+	dbGeoPoint.PublicLocation = postgis.PointS{SRID: geopoint.WGS84, X: longitude, Y: latitude}
+
+	// no place is set while the gazetteer is not imported
+	if err := tx.Get(&geoPoint.Place, database.GetNearestLocality, dbGeoPoint.PublicLocation); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.removeAssets(ctx, stagingKeys(staged))
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not locate geopoint: %s", err))
+		return
+	}
+	// the sun is placed at the public location, its elevation would otherwise tell the precise one
+	if geoPoint.Timezone == "" {
+		geoPoint.Timezone = solar.Timezone(longitude)
+	}
+	geoPoint.Solar = solarContext(geoPoint.CreatedOn, latitude, longitude, geoPoint.Timezone)
+
+	stmt, err := tx.PrepareNamed(database.PostGeoPoint)
 	if err != nil {
+		c.removeAssets(ctx, stagingKeys(staged))
 		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not prepare geopoint creation: %s", err))
 		return
 	}
 
 	if err := stmt.Get(&geoPoint.Id, dbGeoPoint); err != nil {
+		c.removeAssets(ctx, stagingKeys(staged))
 		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not create geopoint")
 		ctx.Abort()
 		return
 	}
 
-	if bindGeo.Picture != nil {
-		if err := ctx.SaveUploadedFile(bindGeo.Picture, fmt.Sprintf("%s/picture/%s", c.assetsFolder, geoPoint.Picture)); err != nil {
-			ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not save uploaded picture: %s", err))
-			return
-		}
+	if err := c.publishAssets(ctx, staged); err != nil {
+		tx.Rollback()
+		c.removeUnreferencedAssets(ctx, staged)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
 	}
 
-	if err := ctx.SaveUploadedFile(bindGeo.Sound, fmt.Sprintf("%s/sound/%s", c.assetsFolder, geoPoint.Sound)); err != nil {
-		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not save uploaded sound: %s", err))
+	if err := tx.Commit(); err != nil {
+		c.removeUnreferencedAssets(ctx, staged)
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not commit geopoint creation: %s", err))
 		return
 	}
+	c.setAssetUrls(&geoPoint)
 
 	ctx.JSON(http.StatusOK, geoPoint)
 }
@@ -3,6 +3,7 @@ package controller
 import (
 	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
+	"github.com/haran/biophonie-api/controller/role"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/swaggo/gin-swagger/swaggerFiles"
 )
@@ -23,28 +24,116 @@ func SetupRouter(c *Controller) *gin.Engine {
 			users.GET("/:name", c.GetUser)
 			users.POST("", c.PostUser)
 			users.POST("/authorize", c.AuthorizeUser)
+			users.POST("/token/refresh", c.RefreshToken)
+			users.POST("/logout", c.Logout)
+			users.POST("/recover", c.RecoverUser)
+			users.GET("/oidc", c.GetOidcProviders)
+			users.GET("/oidc/:provider/login", c.OidcLogin)
+			users.GET("/oidc/:provider/callback", c.OidcCallback)
+			users.POST("/:name/report", c.AuthorizeOptional, c.ReportUser)
 		}
 		geopoints := v1.Group("/geopoint")
 		{
 			geopoints.GET("/:id", c.GetGeoPoint)
+			geopoints.GET("/search", c.SearchGeoPoints)
 			geopoints.GET("/closest/to/:latitude/:longitude", c.GetClosestGeoPoint)
 			geopoints.GET("/:id/assets", c.GetAssets)
+			geopoints.GET("/:id/similar", c.GetSimilarGeoPoints)
+			geopoints.GET("/:id/comments", c.GetComments)
+			geopoints.POST("/:id/report", c.AuthorizeOptional, c.ReportGeoPoint)
+		}
+		v1.GET("/templates", c.GetTemplates)
+		walks := v1.Group("/walk")
+		{
+			walks.GET("", c.GetWalks)
+			walks.GET("/:id", c.GetWalk)
+			walks.GET("/:id/geojson", c.GetWalkGeoJson)
 		}
 		restricted := v1.Group("/restricted", c.Authorize)
 		{
-			restricted.POST("/geopoint", c.BindGeoPoint, c.CreateGeoPoint)
+			restricted.POST("/geopoint", c.Idempotent, c.BindGeoPoint, c.CreateGeoPoint)
+			restricted.POST("/geopoint/upload", c.Idempotent, c.ClearUploads, c.BindUploadedGeoPoint, c.CreateGeoPoint)
+			restricted.POST("/upload", c.CreateUpload)
+			restricted.GET("/upload/:id", c.GetUpload)
+			restricted.PATCH("/upload/:id", c.PatchUpload)
+			restricted.POST("/walk", c.CreateWalk)
+			restricted.PUT("/walk/:id", c.UpdateWalk)
+			restricted.DELETE("/walk/:id", c.DeleteWalk)
+			restricted.GET("/favourite", c.GetFavourites)
+			restricted.PUT("/favourite/:id", c.AddFavourite)
+			restricted.DELETE("/favourite/:id", c.RemoveFavourite)
+			restricted.GET("/playlist", c.GetPlaylists)
+			restricted.POST("/playlist", c.CreatePlaylist)
+			restricted.GET("/playlist/:id", c.GetPlaylist)
+			restricted.PATCH("/playlist/:id", c.RenamePlaylist)
+			restricted.DELETE("/playlist/:id", c.DeletePlaylist)
+			restricted.PUT("/playlist/:id/order", c.OrderPlaylist)
+			restricted.PUT("/playlist/:id/geopoint/:geoId", c.AddToPlaylist)
+			restricted.DELETE("/playlist/:id/geopoint/:geoId", c.RemoveFromPlaylist)
+			restricted.POST("/geopoint/:id/comment", c.PostComment)
+			restricted.PATCH("/comment/:id", c.EditComment)
+			restricted.DELETE("/comment/:id", c.DeleteComment)
+			restricted.POST("/user/password", c.RotatePassword)
+			restricted.PUT("/user/password", c.ChoosePassword)
+			restricted.GET("/credential", c.GetCredentials)
+			restricted.POST("/credential", c.AddCredential)
+			restricted.DELETE("/credential/:id", c.DeleteCredential)
+			restricted.GET("/session", c.GetSessions)
+			restricted.DELETE("/session", c.RevokeSessions)
+			restricted.DELETE("/session/:id", c.RevokeSession)
 			restricted.GET("/ping", c.AuthPong)
-			toAdmins := restricted.Group("", c.AuthorizeAdmin)
+			toGeoPointModerators := restricted.Group("", c.AuthorizePermission(role.ModerateGeoPoints))
+			{
+				toGeoPointModerators.PATCH("/geopoint/:id/enable", c.EnableGeoPoint, c.AppendGeoJson)
+				toGeoPointModerators.GET("/geopoint/:id", c.GetGeoPoint)
+				toGeoPointModerators.DELETE("/geopoint/:id", c.DeleteGeoPoint, c.ClearGeoPoint)
+			}
+			toCommentModerators := restricted.Group("", c.AuthorizePermission(role.ModerateComments))
+			{
+				toCommentModerators.GET("/geopoint/:id/comments", c.GetComments)
+				toCommentModerators.PATCH("/comment/:id/hide", c.HideComment)
+			}
+			toReportHandlers := restricted.Group("/report", c.AuthorizePermission(role.HandleReports))
+			{
+				toReportHandlers.GET("", c.GetReports)
+				toReportHandlers.PATCH("/:id/resolve", c.ResolveReport)
+				toReportHandlers.PATCH("/:id/dismiss", c.DismissReport)
+			}
+			toUserManagers := restricted.Group("", c.AuthorizePermission(role.ManageUsers))
 			{
-				toAdmins.PATCH("/geopoint/:id/enable", c.EnableGeoPoint, c.AppendGeoJson)
-				toAdmins.PATCH("/user/:id", c.MakeAdmin)
-				toAdmins.GET("/geopoint/:id", c.GetGeoPoint)
-				toAdmins.DELETE("/geopoint/:id", c.DeleteGeoPoint, c.ClearGeoPoint)
+				toUserManagers.GET("/role", c.GetRoles)
+				toUserManagers.PATCH("/user/:id", c.MakeAdmin)
+				toUserManagers.PATCH("/user/:id/demote", c.DemoteAdmin)
+				toUserManagers.PATCH("/user/:id/role", c.SetRole)
+				toUserManagers.DELETE("/user/:id/sessions", c.RevokeUserSessions)
+				toUserManagers.POST("/user/:id/recovery", c.CreateRecoveryCode)
+			}
+			toTemplateManagers := restricted.Group("/template", c.AuthorizePermission(role.ManageTemplates))
+			{
+				toTemplateManagers.GET("", c.GetAllTemplates)
+				toTemplateManagers.POST("", c.CreateTemplate)
+				toTemplateManagers.PATCH("/:id", c.RenameTemplate)
+				toTemplateManagers.PATCH("/:id/retire", c.RetireTemplate)
+			}
+			toZoneManagers := restricted.Group("/zone", c.AuthorizePermission(role.ManageZones))
+			{
+				toZoneManagers.GET("", c.GetPrivacyZones)
+				toZoneManagers.POST("", c.CreatePrivacyZone)
+				toZoneManagers.DELETE("/:id", c.DeletePrivacyZone)
+			}
+			restricted.POST("/assets/check", c.AuthorizePermission(role.CheckAssets), c.CheckAssets)
+			toApiKeyManagers := restricted.Group("/apikey", c.AuthorizePermission(role.ManageApiKeys))
+			{
+				toApiKeyManagers.GET("", c.GetApiKeys)
+				toApiKeyManagers.POST("", c.CreateApiKey)
+				toApiKeyManagers.DELETE("/:id", c.RevokeApiKey)
 			}
 		}
 		v1.GET("/ping", c.Pong)
 	}
 
+	r.GET("/.well-known/jwks.json", c.GetJwks)
+
 	// r.UseH2C = true // try to use http2 maybe with next version of gin-gonic
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	return r
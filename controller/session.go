@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/haran/biophonie-api/controller/user"
+	"github.com/haran/biophonie-api/database"
+)
+
+// GetSessions godoc
+// @Summary list the sessions
+// @Description list the devices where the user is logged in, the most recently used first
+// @Accept json
+// @Produce json
+// @Tags Authentication
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {array} user.Session
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/session [get]
+func (c *Controller) GetSessions(ctx *gin.Context) {
+	sessions := make([]user.Session, 0)
+	if err := c.Db.Select(&sessions, database.GetSessions, ctx.GetInt("userId"), refreshTokenLifetime.Seconds()); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get sessions")
+		ctx.Abort()
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Id == ctx.GetString("sessionId")
+	}
+
+	ctx.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession godoc
+// @Summary revoke a session
+// @Description log the user out of a device, its access and refresh tokens are revoked at once
+// @Accept json
+// @Produce json
+// @Tags Authentication
+// @Param id path string true "session id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {string} string
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/session/{id} [delete]
+func (c *Controller) RevokeSession(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var session user.Session
+	if err := c.Db.Get(&session, database.GetSession, id, ctx.GetInt("userId")); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get session")
+		ctx.Abort()
+		return
+	}
+
+	if _, err := c.Db.Exec(database.RevokeSession, id, ctx.GetInt("userId")); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "session was revoked"})
+}
+
+// RevokeSessions godoc
+// @Summary revoke all the sessions
+// @Description log the user out of all the devices, including the current one
+// @Accept json
+// @Produce json
+// @Tags Authentication
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {string} string
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/session [delete]
+func (c *Controller) RevokeSessions(ctx *gin.Context) {
+	if _, err := c.Db.Exec(database.RevokeUserSessions, ctx.GetInt("userId")); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "sessions were revoked"})
+}
+
+// RevokeUserSessions godoc
+// @Summary revoke the tokens of a user
+// @Description log a user out of all the devices, for instance after a lost phone or a demotion
+// @Accept json
+// @Produce json
+// @Tags Authentication
+// @Param id path int true "user id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {string} string
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/user/{id}/sessions [delete]
+func (c *Controller) RevokeUserSessions(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var revokedUser user.User
+	if err := c.Db.Get(&revokedUser, database.GetUserById, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get user")
+		ctx.Abort()
+		return
+	}
+
+	if _, err := c.Db.Exec(database.RevokeUserSessions, id); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "sessions of the user were revoked"})
+}
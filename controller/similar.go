@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/haran/biophonie-api/controller/geopoint"
+	"github.com/haran/biophonie-api/database"
+	"github.com/haran/biophonie-api/storage"
+	"github.com/lib/pq"
+)
+
+const defaultSimilarLimit = 10
+
+// GetSimilarGeoPoints godoc
+// @Summary get the geopoints which sound like a geopoint
+// @Description list the enabled geopoints ordered by the similarity of their recording with the one of the geopoint (from -1 to 1), optionally within a distance in meters
+// @Accept json
+// @Produce json
+// @Tags Geopoint
+// @Param id path int true "geopoint id"
+// @Param distance query number false "maximum distance in meters"
+// @Param limit query int false "maximum number of geopoints (10 by default)"
+// @Success 200 {array} geopoint.SimilarGeoPoint
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 403 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /geopoint/{id}/similar [get]
+func (c *Controller) GetSimilarGeoPoints(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	similarTo := geopoint.SimilarGeoPoints{Limit: defaultSimilarLimit}
+	if err := ctx.BindQuery(&similarTo); err != nil {
+		return
+	}
+
+	var target geopoint.DbGeoPoint
+	if err := c.Db.Get(&target, database.GetGeoPoint, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get geopoint")
+		ctx.Abort()
+		return
+	}
+
+	if !target.Available {
+		ctx.AbortWithError(http.StatusForbidden, errors.New("geopoint is not enabled yet")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	similar := make([]geopoint.SimilarGeoPoint, 0)
+	if err := c.Db.Select(&similar, database.GetSimilarGeoPoints, id, similarTo.Distance, similarTo.Limit); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get similar geopoints")
+		ctx.Abort()
+		return
+	}
+
+	ctx.JSON(http.StatusOK, similar)
+}
+
+// computeFeatures fills the acoustic features of the geopoints created before they existed
+func (c *Controller) computeFeatures() error {
+	var geoPoints []struct {
+		Id         int             `db:"id"`
+		Amplitudes pq.Float64Array `db:"amplitudes"`
+	}
+	if err := c.Db.Select(&geoPoints, database.GetGeoPointsWithoutFeatures); err != nil {
+		return fmt.Errorf("could not get geopoints without features: %s", err)
+	}
+
+	for _, geoPoint := range geoPoints {
+		features := pq.Float64Array(geopoint.Features(geoPoint.Amplitudes))
+		if _, err := c.Db.Exec(database.SetGeoPointFeatures, geoPoint.Id, features); err != nil {
+			return fmt.Errorf("could not set features of geopoint %d: %s", geoPoint.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// computeFingerprints fills the fingerprints of the geopoints created before they were computed from the sound,
+// a sound which cannot be read is skipped until the next start
+func (c *Controller) computeFingerprints() error {
+	var geoPoints []struct {
+		Id    int    `db:"id"`
+		Sound string `db:"sound"`
+	}
+	if err := c.Db.Select(&geoPoints, database.GetGeoPointsWithoutFingerprint); err != nil {
+		return fmt.Errorf("could not get geopoints without fingerprint: %s", err)
+	}
+
+	ctx := context.Background()
+	for _, geoPoint := range geoPoints {
+		fingerprint, err := soundFingerprint(asset{open: func() (io.ReadCloser, error) {
+			return c.store.Open(ctx, storage.SoundKey(geoPoint.Sound))
+		}})
+		if err != nil {
+			log.Printf("could not fingerprint sound of geopoint %d: %s", geoPoint.Id, err)
+			continue
+		}
+		if _, err := c.Db.Exec(database.SetGeoPointFingerprint, geoPoint.Id, fingerprint); err != nil {
+			return fmt.Errorf("could not set fingerprint of geopoint %d: %s", geoPoint.Id, err)
+		}
+	}
+
+	return nil
+}
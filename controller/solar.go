@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+	_ "time/tzdata" // the servers do not always have the timezones
+
+	"github.com/cridenour/go-postgis"
+	"github.com/gin-gonic/gin"
+	"github.com/haran/biophonie-api/controller/geopoint"
+	"github.com/haran/biophonie-api/database"
+	"github.com/haran/biophonie-api/solar"
+	"github.com/jmoiron/sqlx"
+)
+
+const defaultSearchLimit = 100
+
+// SearchGeoPoints godoc
+// @Summary search the geopoints
+// @Description list the enabled geopoints recorded at a phase of the day, season, local month, in a country or a bounding box, the most recent first
+// @Accept json
+// @Produce json
+// @Tags Geopoint
+// @Param phase query string false "phase of the day" Enums(night, dawn, day, dusk)
+// @Param season query string false "season in the hemisphere of the recording" Enums(winter, spring, summer, autumn)
+// @Param month query int false "local month of the recording"
+// @Param country query string false "ISO code of the country"
+// @Param bbox query []number false "west, south, east and north bounds in degrees"
+// @Param limit query int false "maximum number of geopoints (100 by default)"
+// @Success 200 {array} geopoint.FoundGeoPoint
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /geopoint/search [get]
+func (c *Controller) SearchGeoPoints(ctx *gin.Context) {
+	search := geopoint.SearchGeoPoints{Limit: defaultSearchLimit}
+	if err := ctx.BindQuery(&search); err != nil {
+		return
+	}
+
+	found := make([]geopoint.FoundGeoPoint, 0)
+	if err := c.Db.Select(&found, database.SearchGeoPoints, search.Phase, search.Season, search.Month, search.Country, search.Bbox, search.Limit); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not search geopoints")
+		ctx.Abort()
+		return
+	}
+
+	ctx.JSON(http.StatusOK, found)
+}
+
+// solarContext computes the position of the sun when the recording was made and its local month
+func solarContext(date time.Time, latitude, longitude float64, timezone string) geopoint.Solar {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	month := date.In(location).Month()
+	elevation, morning := solar.Position(date, latitude, longitude)
+
+	return geopoint.Solar{
+		SunElevation: elevation,
+		Phase:        solar.Phase(elevation, morning),
+		Season:       solar.Season(month, latitude),
+		Hemisphere:   solar.Hemisphere(latitude),
+		Month:        int(month),
+	}
+}
+
+// computeSolar fills the solar context of the geopoints created before it existed
+func (c *Controller) computeSolar() error {
+	return setSolar(c.Db, database.GetGeoPointsWithoutSolar)
+}
+
+// setSolar computes the solar context of the geopoints of the query at their public location, again when
+// they were located again
+func setSolar(db sqlx.Ext, query string, args ...interface{}) error {
+	var geoPoints []struct {
+		Id        int            `db:"id"`
+		CreatedOn time.Time      `db:"created_on"`
+		Location  postgis.PointS `db:"public_location"`
+		Timezone  string         `db:"timezone"`
+	}
+	if err := sqlx.Select(db, &geoPoints, query, args...); err != nil {
+		return fmt.Errorf("could not get geopoints to place in their day: %s", err)
+	}
+
+	for _, geoPoint := range geoPoints {
+		if geoPoint.Timezone == "" {
+			geoPoint.Timezone = solar.Timezone(geoPoint.Location.X)
+		}
+		context := solarContext(geoPoint.CreatedOn, geoPoint.Location.Y, geoPoint.Location.X, geoPoint.Timezone)
+		if _, err := db.Exec(database.SetGeoPointSolar, geoPoint.Id, geoPoint.Timezone, context.SunElevation, context.Phase, context.Season, context.Hemisphere, context.Month); err != nil {
+			return fmt.Errorf("could not set solar context of geopoint %d: %s", geoPoint.Id, err)
+		}
+	}
+
+	return nil
+}
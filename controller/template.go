@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/h2non/filetype/matchers"
+	"github.com/haran/biophonie-api/controller/picture"
+	"github.com/haran/biophonie-api/database"
+	"github.com/haran/biophonie-api/httputil"
+	"github.com/haran/biophonie-api/storage"
+)
+
+var errUnknownTemplate = errors.New("picture template does not exist or was retired")
+
+// GetTemplates godoc
+// @Summary list the picture templates
+// @Description list the picture templates which can be used instead of uploading a picture
+// @Accept json
+// @Produce json
+// @Tags Template
+// @Success 200 {array} picture.Template
+// @Failure 500 {object} controller.ErrMsg
+// @Router /templates [get]
+func (c *Controller) GetTemplates(ctx *gin.Context) {
+	templates := make([]picture.Template, 0)
+	if err := c.Db.Select(&templates, database.GetTemplates); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get templates")
+		ctx.Abort()
+		return
+	}
+
+	for i := range templates {
+		templates[i].PictureUrl = c.store.URL(storage.PictureKey(templates[i].Picture))
+	}
+
+	ctx.JSON(http.StatusOK, templates)
+}
+
+// GetAllTemplates godoc
+// @Summary list all the picture templates
+// @Description list the picture templates, including the retired ones
+// @Accept json
+// @Produce json
+// @Tags Template
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {array} picture.Template
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/template [get]
+func (c *Controller) GetAllTemplates(ctx *gin.Context) {
+	templates := make([]picture.Template, 0)
+	if err := c.Db.Select(&templates, database.GetAllTemplates); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get all templates")
+		ctx.Abort()
+		return
+	}
+
+	for i := range templates {
+		templates[i].PictureUrl = c.store.URL(storage.PictureKey(templates[i].Picture))
+	}
+
+	ctx.JSON(http.StatusOK, templates)
+}
+
+// CreateTemplate godoc
+// @Summary create a picture template
+// @Description save the picture and add it to the picture templates
+// @Accept mpfd
+// @Produce json
+// @Tags Template
+// @Param name formData string true "template name"
+// @Param picture formData file true "template picture in webp"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} picture.Template
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/template [post]
+func (c *Controller) CreateTemplate(ctx *gin.Context) {
+	var addTemplate picture.AddTemplate
+	if err := ctx.Bind(&addTemplate); err != nil {
+		return
+	}
+
+	if !httputil.CheckFileContentType(addTemplate.Picture, matchers.Webp) {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("image was not webp file")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	pictureName := uuid.NewString() + ".webp"
+	if err := c.saveAsset(ctx, fileAsset(storage.PictureKey(pictureName), addTemplate.Picture)); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not save uploaded template: %s", err))
+		return
+	}
+
+	var id int
+	if err := c.Db.Get(&id, database.PostTemplate, addTemplate.Name, pictureName); err != nil {
+		if err := c.store.Remove(ctx, storage.PictureKey(pictureName)); err != nil {
+			log.Println("could not rm template picture: ", err)
+		}
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not create template")
+		ctx.Abort()
+		return
+	}
+
+	var template picture.Template
+	if err := c.Db.Get(&template, database.GetTemplateById, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve created template")
+		ctx.Abort()
+		return
+	}
+
+	template.PictureUrl = c.store.URL(storage.PictureKey(template.Picture))
+
+	ctx.JSON(http.StatusOK, template)
+}
+
+// RenameTemplate godoc
+// @Summary rename a picture template
+// @Description rename a picture template, the geopoints using it keep their picture
+// @Accept json
+// @Produce json
+// @Tags Template
+// @Param id path int true "template id"
+// @Param template body picture.RenameTemplate true "new name"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} picture.Template
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/template/{id} [patch]
+func (c *Controller) RenameTemplate(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var rename picture.RenameTemplate
+	if err := ctx.BindJSON(&rename); err != nil {
+		return
+	}
+
+	result, err := c.Db.Exec(database.RenameTemplate, id, rename.Name)
+	if err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not rename template")
+		ctx.Abort()
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if rowsAffected != 1 {
+		ctx.AbortWithError(http.StatusNotFound, fmt.Errorf("not found")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var template picture.Template
+	if err := c.Db.Get(&template, database.GetTemplateById, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve renamed template")
+		ctx.Abort()
+		return
+	}
+
+	template.PictureUrl = c.store.URL(storage.PictureKey(template.Picture))
+
+	ctx.JSON(http.StatusOK, template)
+}
+
+// RetireTemplate godoc
+// @Summary retire a picture template
+// @Description the template cannot be used by new geopoints anymore but its picture is kept for the existing ones
+// @Accept json
+// @Produce json
+// @Tags Template
+// @Param id path int true "template id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {string} string
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/template/{id}/retire [patch]
+func (c *Controller) RetireTemplate(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	result, err := c.Db.Exec(database.RetireTemplate, id)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if rowsAffected != 1 {
+		ctx.AbortWithError(http.StatusNotFound, fmt.Errorf("not found or already retired")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "template was retired"})
+}
+
+// templatePicture returns the picture of the template, errUnknownTemplate when it does not exist or is retired
+func (c *Controller) templatePicture(name string) (string, error) {
+	var pictureName string
+	if err := c.Db.Get(&pictureName, database.GetTemplatePicture, name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("%w: %q", errUnknownTemplate, name)
+		}
+		return "", err
+	}
+	return pictureName, nil
+}
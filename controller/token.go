@@ -0,0 +1,216 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/haran/biophonie-api/controller/user"
+	"github.com/haran/biophonie-api/database"
+	"github.com/jmoiron/sqlx"
+)
+
+// the device of a session is its User-Agent
+const maxDeviceLength = 200
+
+var errInvalidRefreshToken = errors.New("refresh token is not valid, please log in again")
+
+// RefreshToken godoc
+// @Summary refresh the access token
+// @Description exchange a refresh token for a new access token and a new refresh token, reusing a refresh token revokes its session
+// @Accept json
+// @Produce json
+// @Tags Authentication
+// @Param refresh body user.Refresh true "refresh token"
+// @Success 200 {object} user.AccessToken
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /user/token/refresh [post]
+func (c *Controller) RefreshToken(ctx *gin.Context) {
+	var refresh user.Refresh
+	if err := ctx.BindJSON(&refresh); err != nil {
+		return
+	}
+
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not begin refresh: %s", err))
+		return
+	}
+	defer tx.Rollback()
+
+	var stored user.RefreshToken
+	if err := tx.Get(&stored, database.GetRefreshToken, hashToken(refresh.RefreshToken)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.AbortWithError(http.StatusUnauthorized, errInvalidRefreshToken).SetType(gin.ErrorTypePublic)
+			return
+		}
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not get refresh token: %s", err))
+		return
+	}
+
+	if stored.Revoked || time.Now().After(stored.ExpiresOn) {
+		ctx.AbortWithError(http.StatusUnauthorized, errInvalidRefreshToken).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	// a refresh token used twice was probably stolen, nobody in the session can be trusted anymore
+	if stored.UsedOn != nil {
+		if _, err := tx.Exec(database.RevokeSession, stored.Family, stored.UserId); err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not revoke refresh tokens: %s", err))
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not commit revocation: %s", err))
+			return
+		}
+		ctx.AbortWithError(http.StatusUnauthorized, errors.New("refresh token was already used, the session is revoked")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if _, err := tx.Exec(database.UseRefreshToken, stored.Id); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not use refresh token: %s", err))
+		return
+	}
+
+	if _, err := tx.Exec(database.TouchSession, stored.Family, ctx.ClientIP()); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not update session: %s", err))
+		return
+	}
+
+	tokens, err := c.issueTokens(tx, stored.UserId, stored.Family)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not commit refresh: %s", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// Logout godoc
+// @Summary log out
+// @Description revoke the session of the refresh token with all its access and refresh tokens
+// @Accept json
+// @Produce json
+// @Tags Authentication
+// @Param refresh body user.Refresh true "refresh token"
+// @Success 200 {string} string
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /user/logout [post]
+func (c *Controller) Logout(ctx *gin.Context) {
+	var refresh user.Refresh
+	if err := ctx.BindJSON(&refresh); err != nil {
+		return
+	}
+
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not begin logout: %s", err))
+		return
+	}
+	defer tx.Rollback()
+
+	var stored user.RefreshToken
+	if err := tx.Get(&stored, database.GetRefreshToken, hashToken(refresh.RefreshToken)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.AbortWithError(http.StatusUnauthorized, errInvalidRefreshToken).SetType(gin.ErrorTypePublic)
+			return
+		}
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not get refresh token: %s", err))
+		return
+	}
+
+	if _, err := tx.Exec(database.RevokeSession, stored.Family, stored.UserId); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not revoke session: %s", err))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not commit logout: %s", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "user was logged out"})
+}
+
+// startSession logs the user in on the device of the request
+func (c *Controller) startSession(ctx *gin.Context, userId int) (user.AccessToken, error) {
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		return user.AccessToken{}, fmt.Errorf("could not begin session: %s", err)
+	}
+	defer tx.Rollback()
+
+	device := ctx.GetHeader("User-Agent")
+	if len(device) > maxDeviceLength {
+		device = strings.ToValidUTF8(device[:maxDeviceLength], "")
+	}
+
+	session := uuid.NewString()
+	if _, err := tx.Exec(database.PostSession, session, userId, device, ctx.ClientIP()); err != nil {
+		return user.AccessToken{}, fmt.Errorf("could not create session: %s", err)
+	}
+
+	tokens, err := c.issueTokens(tx, userId, session)
+	if err != nil {
+		return user.AccessToken{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return user.AccessToken{}, fmt.Errorf("could not commit session: %s", err)
+	}
+	return tokens, nil
+}
+
+// issueTokens signs an access token of the session and stores a new refresh token in its family
+func (c *Controller) issueTokens(db sqlx.Execer, userId int, session string) (user.AccessToken, error) {
+	token, jti, err := c.createToken(userId, session)
+	if err != nil {
+		return user.AccessToken{}, fmt.Errorf("could not sign token: %s", err)
+	}
+
+	if _, err := db.Exec(database.DeleteExpiredTokens); err != nil {
+		return user.AccessToken{}, fmt.Errorf("could not delete expired tokens: %s", err)
+	}
+	if _, err := db.Exec(database.PostAccessToken, jti, userId, session, accessTokenLifetime.Seconds()); err != nil {
+		return user.AccessToken{}, fmt.Errorf("could not store access token: %s", err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return user.AccessToken{}, fmt.Errorf("could not generate refresh token: %s", err)
+	}
+	refreshToken := hex.EncodeToString(secret)
+
+	if _, err := db.Exec(database.PostRefreshToken, userId, session, hashToken(refreshToken), refreshTokenLifetime.Seconds()); err != nil {
+		return user.AccessToken{}, fmt.Errorf("could not store refresh token: %s", err)
+	}
+
+	return user.AccessToken{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(accessTokenLifetime.Seconds()),
+	}, nil
+}
+
+// hashToken is the only form of the refresh tokens kept in the database
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,415 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/h2non/filetype/matchers"
+	"github.com/haran/biophonie-api/controller/geopoint"
+	"github.com/haran/biophonie-api/controller/upload"
+	"github.com/haran/biophonie-api/database"
+	"github.com/haran/biophonie-api/httputil"
+	"github.com/haran/biophonie-api/storage"
+)
+
+const maxChunkSize = 10000000 // 10 MB
+
+// expected format of the uploads by kind
+var uploadFormats = map[string]struct {
+	name    string
+	matcher matchers.Matcher
+}{
+	upload.Sound:   {"aac", matchers.Aac},
+	upload.Picture: {"webp", matchers.Webp},
+}
+
+// CreateUpload godoc
+// @Summary start a resumable upload
+// @Description start the upload of a sound or a picture which can be sent in several chunks, the session expires after a day
+// @Accept json
+// @Produce json
+// @Tags Upload
+// @Param upload body upload.AddUpload true "file to upload"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} upload.Upload
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/upload [post]
+func (c *Controller) CreateUpload(ctx *gin.Context) {
+	var addUpload upload.AddUpload
+	if err := ctx.BindJSON(&addUpload); err != nil {
+		return
+	}
+
+	userId := ctx.GetInt("userId")
+	c.clearExpiredUploads(ctx, userId)
+
+	var created upload.Upload
+	if err := c.Db.Get(&created, database.PostUpload, uuid.NewString(), userId, addUpload.Kind, addUpload.Size, addUpload.Checksum); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not create upload")
+		ctx.Abort()
+		return
+	}
+
+	ctx.Header("Upload-Offset", strconv.FormatInt(created.Offset, 10))
+	ctx.JSON(http.StatusOK, created)
+}
+
+// GetUpload godoc
+// @Summary get a resumable upload
+// @Description get the offset from which the upload must be resumed
+// @Accept json
+// @Produce json
+// @Tags Upload
+// @Param id path string true "upload id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} upload.Upload
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/upload/{id} [get]
+func (c *Controller) GetUpload(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var got upload.Upload
+	if err := c.Db.Get(&got, database.GetUpload, id, ctx.GetInt("userId")); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get upload")
+		ctx.Abort()
+		return
+	}
+
+	ctx.Header("Upload-Offset", strconv.FormatInt(got.Offset, 10))
+	ctx.JSON(http.StatusOK, got)
+}
+
+// PatchUpload godoc
+// @Summary send a chunk of a resumable upload
+// @Description append the body to the upload, the Upload-Offset header must be the current offset of the upload
+// @Accept octet-stream
+// @Produce json
+// @Tags Upload
+// @Param id path string true "upload id"
+// @Param Upload-Offset header int true "offset of the chunk"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} upload.Upload
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 411 {object} controller.ErrMsg
+// @Failure 413 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/upload/{id} [patch]
+func (c *Controller) PatchUpload(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	offset, err := strconv.ParseInt(ctx.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("Upload-Offset header is not valid")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	length := ctx.Request.ContentLength
+	if length <= 0 {
+		ctx.AbortWithError(http.StatusLengthRequired, errors.New("chunk length is required")).SetType(gin.ErrorTypePublic)
+		return
+	}
+	if length > maxChunkSize {
+		ctx.AbortWithError(http.StatusRequestEntityTooLarge, fmt.Errorf("chunk cannot be larger than %d bytes", maxChunkSize)).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var current upload.Upload
+	if err := c.Db.Get(&current, database.GetUpload, id, ctx.GetInt("userId")); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get upload for chunk")
+		ctx.Abort()
+		return
+	}
+
+	ctx.Header("Upload-Offset", strconv.FormatInt(current.Offset, 10))
+	if offset != current.Offset {
+		ctx.AbortWithError(http.StatusConflict, errors.New("offset does not match the upload")).SetType(gin.ErrorTypePublic)
+		return
+	}
+	if offset+length > current.Size {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("chunk exceeds the upload size")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	chunk := uuid.NewString()
+	key := storage.ChunkKey(id, chunk)
+	body := &bodyReader{reader: &io.LimitedReader{R: http.MaxBytesReader(ctx.Writer, ctx.Request.Body, length), N: length}}
+	if err := c.store.Save(ctx, key, body, length); err != nil && body.err == nil {
+		c.removeChunk(ctx, key)
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not save chunk: %s", err))
+		return
+	}
+	if body.err != nil || body.read != length {
+		c.removeChunk(ctx, key)
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("chunk was not fully received")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var updated upload.Upload
+	if err := c.Db.Get(&updated, database.AppendChunk, id, offset, length, chunk); err != nil {
+		// another chunk was appended in the meantime
+		c.removeChunk(ctx, key)
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not append chunk")
+		ctx.Abort()
+		return
+	}
+
+	ctx.Header("Upload-Offset", strconv.FormatInt(updated.Offset, 10))
+	ctx.JSON(http.StatusOK, updated)
+}
+
+// BindUploadedGeoPoint godoc
+// @Summary create a geopoint from resumable uploads
+// @Description create the geopoint once its sound and picture were fully uploaded and verified
+// @Accept json
+// @Produce json
+// @Tags Geopoint
+// @Param geopoint body geopoint.UploadedGeoPoint true "geopoint infos and upload ids"
+// @Param Authorization header string true "Authentication header"
+// @Param Idempotency-Key header string false "unique key of the creation, a retry with the same key returns the first geopoint"
+// @Success 200 {object} geopoint.GeoPoint
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 409 {object} controller.ErrMsg
+// @Failure 422 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/geopoint/upload [post]
+func (c *Controller) BindUploadedGeoPoint(ctx *gin.Context) {
+	var uploaded geopoint.UploadedGeoPoint
+	if err := ctx.BindJSON(&uploaded); err != nil {
+		return
+	}
+
+	if err := c.validate.Struct(uploaded.GeoPoint); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	if uploaded.GeoPoint.PictureTemplate == "" && uploaded.Picture == "" {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("picture or picture template is required")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	sound, ok := c.getCompleteUpload(ctx, uploaded.Sound, upload.Sound)
+	if !ok {
+		return
+	}
+	uploads := []upload.Upload{sound}
+
+	if uploaded.GeoPoint.PictureTemplate == "" {
+		picture, ok := c.getCompleteUpload(ctx, uploaded.Picture, upload.Picture)
+		if !ok {
+			return
+		}
+		uploads = append(uploads, picture)
+	}
+
+	geoPoint, err := c.newGeoPoint(ctx, uploaded.GeoPoint)
+	if errors.Is(err, errUnknownTemplate) {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	} else if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not get picture template: %s", err))
+		return
+	}
+
+	assets := make([]asset, 0, len(uploads))
+	for _, u := range uploads {
+		var key string
+		if u.Kind == upload.Picture {
+			geoPoint.SetPicture(u.Checksum, u.Size)
+			key = storage.PictureKey(geoPoint.Picture)
+		} else {
+			geoPoint.SetSound(u.Checksum, u.Size)
+			key = storage.SoundKey(geoPoint.Sound)
+		}
+		assets = append(assets, c.uploadAsset(ctx, key, u))
+	}
+	if geoPoint.Fingerprint, err = soundFingerprint(assets[0]); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not fingerprint sound: %s", err))
+		return
+	}
+
+	ctx.Set("uploads", uploads)
+	ctx.Set("assets", assets)
+	ctx.Set("geoPoint", geoPoint)
+}
+
+// ClearUploads removes the uploads once they were saved as the assets of a geopoint
+func (c *Controller) ClearUploads(ctx *gin.Context) {
+	ctx.Next()
+	if ctx.IsAborted() {
+		return
+	}
+
+	uploads, _ := ctx.Get("uploads")
+	toClear, _ := uploads.([]upload.Upload)
+	for _, u := range toClear {
+		c.removeUpload(ctx, u)
+	}
+}
+
+// getCompleteUpload retrieves a fully received upload of the user and verifies its content type and checksum
+func (c *Controller) getCompleteUpload(ctx *gin.Context, id string, kind string) (upload.Upload, bool) {
+	var got upload.Upload
+	if err := c.Db.Get(&got, database.GetUpload, id, ctx.GetInt("userId")); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get upload of geopoint")
+		ctx.Abort()
+		return got, false
+	}
+
+	if got.Kind != kind {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("upload %s is not a %s", id, kind)).SetType(gin.ErrorTypePublic)
+		return got, false
+	}
+
+	if !got.Complete() {
+		ctx.AbortWithError(http.StatusConflict, fmt.Errorf("upload %s is not complete", id)).SetType(gin.ErrorTypePublic)
+		return got, false
+	}
+
+	file := c.openUpload(ctx, got)
+	defer file.Close()
+
+	hash := sha256.New()
+	tee := io.TeeReader(file, hash)
+	if format := uploadFormats[kind]; !httputil.CheckContentType(tee, format.matcher) {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("%s was not %s file", kind, format.name)).SetType(gin.ErrorTypePublic)
+		return got, false
+	}
+	if _, err := io.Copy(hash, file); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not read upload: %s", err))
+		return got, false
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != got.Checksum {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("checksum of upload %s does not match", id)).SetType(gin.ErrorTypePublic)
+		return got, false
+	}
+
+	return got, true
+}
+
+func (c *Controller) uploadAsset(ctx context.Context, key string, u upload.Upload) asset {
+	return asset{
+		key:  key,
+		size: u.Size,
+		open: func() (io.ReadCloser, error) { return c.openUpload(ctx, u), nil },
+	}
+}
+
+// openUpload reads the chunks of the upload one after the other
+func (c *Controller) openUpload(ctx context.Context, u upload.Upload) io.ReadCloser {
+	keys := make([]string, len(u.Chunks))
+	for i, chunk := range u.Chunks {
+		keys[i] = storage.ChunkKey(u.Id, chunk)
+	}
+	return &chunkReader{ctx: ctx, store: c.store, keys: keys}
+}
+
+func (c *Controller) removeUpload(ctx context.Context, u upload.Upload) {
+	for _, chunk := range u.Chunks {
+		c.removeChunk(ctx, storage.ChunkKey(u.Id, chunk))
+	}
+	if _, err := c.Db.Exec(database.DeleteUpload, u.Id); err != nil {
+		log.Println("could not delete upload: ", err)
+	}
+}
+
+func (c *Controller) removeChunk(ctx context.Context, key string) {
+	if err := c.store.Remove(ctx, key); err != nil {
+		log.Println("could not rm chunk: ", err)
+	}
+}
+
+func (c *Controller) clearExpiredUploads(ctx context.Context, userId int) {
+	var expired []upload.Upload
+	if err := c.Db.Select(&expired, database.GetExpiredUploads, userId); err != nil {
+		log.Println("could not get expired uploads: ", err)
+		return
+	}
+	for _, u := range expired {
+		c.removeUpload(ctx, u)
+	}
+}
+
+// bodyReader counts the bytes received from the client and keeps its error apart from the ones of the storage
+type bodyReader struct {
+	reader io.Reader
+	read   int64
+	err    error
+}
+
+func (r *bodyReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+type chunkReader struct {
+	ctx   context.Context
+	store storage.Storage
+	keys  []string
+	chunk io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.chunk == nil {
+			if len(r.keys) == 0 {
+				return 0, io.EOF
+			}
+			chunk, err := r.store.Open(r.ctx, r.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			r.chunk, r.keys = chunk, r.keys[1:]
+		}
+
+		n, err := r.chunk.Read(p)
+		if err == io.EOF {
+			r.chunk.Close()
+			r.chunk = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.chunk == nil {
+		return nil
+	}
+	return r.chunk.Close()
+}
@@ -0,0 +1,34 @@
+package upload
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	Sound   = "sound"
+	Picture = "picture"
+)
+
+type Upload struct {
+	Id        string         `db:"id" json:"id" example:"9b768967-d491-4baa-a812-24ea8a9c274d"`
+	UserId    int            `db:"user_id" json:"userId" example:"1"`
+	Kind      string         `db:"kind" json:"kind" example:"sound"`
+	Size      int64          `db:"size" json:"size" example:"2048000"`
+	Checksum  string         `db:"checksum" json:"checksum" example:"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"`
+	Offset    int64          `db:"received" json:"offset" example:"1024000"`
+	Chunks    pq.StringArray `db:"chunks" json:"-"`
+	CreatedOn time.Time      `db:"created_on" json:"createdOn" example:"2022-05-26T11:17:35.079344Z"`
+}
+
+type AddUpload struct {
+	Kind     string `json:"kind" example:"sound" binding:"required,oneof=sound picture"`
+	Size     int64  `json:"size" example:"2048000" binding:"required,min=1,max=100000000"`
+	Checksum string `json:"checksum" example:"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae" binding:"required,len=64,hexadecimal,lowercase"`
+}
+
+// Complete is true once every byte of the file was received
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Size
+}
@@ -1,18 +1,42 @@
 package user
 
-import "github.com/golang-jwt/jwt/v4"
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
 
 type AddUser struct {
 	Name string `json:"name" example:"bob" binding:"required,min=3,max=20"`
+	// Password is chosen by the user to log in on the website, in addition to the generated one
+	Password string `json:"password,omitempty" example:"correct horse battery staple" binding:"omitempty,max=72"`
 }
 
 type AccessToken struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken" example:"1f0c5e7b6d3e4a8f9b2c7d1e0a4b6c8d2e9f1a3b5c7d9e0f2a4b6c8d0e1f3a5b"`
+	ExpiresIn    int    `json:"expiresIn" example:"900"`
+}
+
+type Refresh struct {
+	RefreshToken string `json:"refreshToken" example:"1f0c5e7b6d3e4a8f9b2c7d1e0a4b6c8d2e9f1a3b5c7d9e0f2a4b6c8d0e1f3a5b" binding:"required,len=64,hexadecimal"`
+}
+
+// RefreshToken is stored hashed, every refresh replaces it with a new token of the same family
+type RefreshToken struct {
+	Id        int        `db:"id"`
+	UserId    int        `db:"user_id"`
+	Family    string     `db:"family"`
+	Token     string     `db:"token"`
+	CreatedOn time.Time  `db:"created_on"`
+	ExpiresOn time.Time  `db:"expires_on"`
+	UsedOn    *time.Time `db:"used_on"`
+	Revoked   bool       `db:"revoked"`
 }
 
 type AuthUser struct {
 	Name     string `json:"name" example:"bob" binding:"required,min=3,max=20"`
-	Password string `json:"password" example:"9b768967-d491-4baa-a812-24ea8a9c274d" binding:"required,uuid"`
+	Password string `json:"password" example:"9b768967-d491-4baa-a812-24ea8a9c274d" binding:"required,max=72"`
 }
 
 type User struct {
@@ -21,15 +45,78 @@ type User struct {
 	Password  string `db:"password" json:"password" example:"9b768967-d491-4baa-a812-24ea8a9c274d"`
 	CreatedOn string `db:"created_on" json:"createdOn" example:"2022-05-26T11:17:35.079344Z"`
 	Admin     bool   `db:"admin" json:"admin" example:"false"`
+	Role      string `db:"role" json:"role" example:"contributor"`
 }
 
-// Define some custom types were going to use within our tokens
-type UserInfo struct {
-	Name  string
-	Admin bool
+// kinds of credentials
+const (
+	// DeviceCredential is a password generated for a device
+	DeviceCredential = "device"
+	// ChosenCredential is the password chosen by the user, an account has at most one
+	ChosenCredential = "chosen"
+)
+
+// Credential is another password of the account, for a device which cannot share the password of the account
+// or chosen by the user
+type Credential struct {
+	Id         int        `db:"id" json:"id" example:"3"`
+	UserId     int        `db:"user_id" json:"-"`
+	Kind       string     `db:"kind" json:"kind" example:"device"`
+	Device     string     `db:"device" json:"device" example:"tablet"`
+	Password   string     `db:"password" json:"password,omitempty" example:"0d4f2a9e-6b1c-4f3e-8a7d-2c5b9e1f0a3d"`
+	CreatedOn  time.Time  `db:"created_on" json:"createdOn" example:"2022-05-26T11:17:35.079344Z"`
+	LastUsedOn *time.Time `db:"last_used_on" json:"lastUsedOn" example:"2022-06-02T08:40:12.079344Z"`
 }
 
+type AddCredential struct {
+	Device string `json:"device" example:"tablet" binding:"required,max=200"`
+}
+
+// RotatePassword proves that the user knows the current password, a device credential or the chosen password
+type RotatePassword struct {
+	Password string `json:"password" example:"9b768967-d491-4baa-a812-24ea8a9c274d" binding:"required,max=72"`
+}
+
+// ChoosePassword needs the current password, a device credential or the chosen password, or else a recovery code
+// given by an admin, so that a forgotten session cannot take over the account
+type ChoosePassword struct {
+	Password        string `json:"password" example:"correct horse battery staple" binding:"required,max=72"`
+	CurrentPassword string `json:"currentPassword,omitempty" example:"9b768967-d491-4baa-a812-24ea8a9c274d" binding:"required_without=RecoveryCode,max=72"`
+	RecoveryCode    string `json:"recoveryCode,omitempty" example:"8f3a2b1c9d0e4f5a" binding:"omitempty,len=16,hexadecimal"`
+}
+
+// RecoveryCode lets the user set a new password once, until it expires
+type RecoveryCode struct {
+	Code      string    `json:"code" example:"8f3a2b1c9d0e4f5a"`
+	ExpiresOn time.Time `json:"expiresOn" example:"2022-05-27T11:17:35.079344Z"`
+}
+
+type Recover struct {
+	Name string `json:"name" example:"bob" binding:"required,min=3,max=20"`
+	Code string `json:"code" example:"8f3a2b1c9d0e4f5a" binding:"required,len=16,hexadecimal"`
+}
+
+// OidcCallback is the redirection of the identity provider after the user logged in
+type OidcCallback struct {
+	Code  string `form:"code" binding:"required"`
+	State string `form:"state" binding:"required,len=64,hexadecimal"`
+}
+
+// CustomClaims identify the token with the jti of RegisteredClaims and the session it was issued for,
+// the subject is the id of the user whose roles are read from the database
 type CustomClaims struct {
 	*jwt.RegisteredClaims
-	UserInfo
+	Session string `json:"sid,omitempty"`
+}
+
+// Session is a login on a device, kept alive by refreshing its tokens
+type Session struct {
+	Id         string    `db:"id" json:"id" example:"b5b3c9a4-4d1e-4c3a-9f7e-0c1d2e3f4a5b"`
+	UserId     int       `db:"user_id" json:"-"`
+	Device     string    `db:"device" json:"device" example:"biophonie/1.4 (Android 13)"`
+	Ip         string    `db:"ip" json:"ip" example:"203.0.113.7"`
+	CreatedOn  time.Time `db:"created_on" json:"createdOn" example:"2022-05-26T11:17:35.079344Z"`
+	LastUsedOn time.Time `db:"last_used_on" json:"lastUsedOn" example:"2022-06-02T08:40:12.079344Z"`
+	Revoked    bool      `db:"revoked" json:"-"`
+	Current    bool      `db:"-" json:"current" example:"true"`
 }
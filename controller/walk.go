@@ -0,0 +1,273 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/haran/biophonie-api/controller/role"
+	"github.com/haran/biophonie-api/controller/walk"
+	"github.com/haran/biophonie-api/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var errGeoPointsNotEnabled = errors.New("geopoints of the walk must exist and be enabled")
+
+// GetWalks godoc
+// @Summary list the sound walks
+// @Description list the walks, the most recent first, with their enabled geopoints in order and the length of the path in meters
+// @Accept json
+// @Produce json
+// @Tags Walk
+// @Success 200 {array} walk.Walk
+// @Failure 500 {object} controller.ErrMsg
+// @Router /walk [get]
+func (c *Controller) GetWalks(ctx *gin.Context) {
+	walks := make([]walk.Walk, 0)
+	if err := c.Db.Select(&walks, database.GetWalks); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get walks")
+		ctx.Abort()
+		return
+	}
+
+	ctx.JSON(http.StatusOK, walks)
+}
+
+// GetWalk godoc
+// @Summary get a sound walk
+// @Description retrieve the walk with its enabled geopoints in order and the length of the path in meters
+// @Accept json
+// @Produce json
+// @Tags Walk
+// @Param id path int true "walk id"
+// @Success 200 {object} walk.Walk
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /walk/{id} [get]
+func (c *Controller) GetWalk(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var w walk.Walk
+	if err := c.Db.Get(&w, database.GetWalk, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get walk")
+		ctx.Abort()
+		return
+	}
+
+	ctx.JSON(http.StatusOK, w)
+}
+
+// GetWalkGeoJson godoc
+// @Summary get a sound walk in GeoJSON
+// @Description a LineString along the walk, when it has at least two enabled geopoints, followed by a Point for each of them, in order
+// @Accept json
+// @Produce json
+// @Tags Walk
+// @Param id path int true "walk id"
+// @Success 200 {object} walk.FeatureCollection
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /walk/{id}/geojson [get]
+func (c *Controller) GetWalkGeoJson(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var w walk.Walk
+	if err := c.Db.Get(&w, database.GetWalk, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get walk")
+		ctx.Abort()
+		return
+	}
+
+	stops := make([]walk.Stop, 0)
+	if err := c.Db.Select(&stops, database.GetWalkStops, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get stops of walk")
+		ctx.Abort()
+		return
+	}
+
+	ctx.JSON(http.StatusOK, walk.GeoJson(w, stops))
+}
+
+// CreateWalk godoc
+// @Summary create a sound walk
+// @Description create a walk along enabled geopoints, in the order of the list
+// @Accept json
+// @Produce json
+// @Tags Walk
+// @Param walk body walk.AddWalk true "title, description and geopoints"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} walk.Walk
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/walk [post]
+func (c *Controller) CreateWalk(ctx *gin.Context) {
+	var addWalk walk.AddWalk
+	if err := ctx.BindJSON(&addWalk); err != nil {
+		return
+	}
+
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not begin walk creation: %s", err))
+		return
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.Get(&id, database.PostWalk, addWalk.Title, addWalk.Description, ctx.GetInt("userId")); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not create walk")
+		ctx.Abort()
+		return
+	}
+
+	c.saveWalk(ctx, tx, id, addWalk.GeoPoints)
+}
+
+// UpdateWalk godoc
+// @Summary update a sound walk
+// @Description replace the title, description and geopoints of the walk, restricted to its owner and the moderators
+// @Accept json
+// @Produce json
+// @Tags Walk
+// @Param id path int true "walk id"
+// @Param walk body walk.AddWalk true "title, description and geopoints"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} walk.Walk
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 403 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/walk/{id} [put]
+func (c *Controller) UpdateWalk(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	var addWalk walk.AddWalk
+	if err := ctx.BindJSON(&addWalk); err != nil {
+		return
+	}
+
+	if !c.canEditWalk(ctx, id) {
+		return
+	}
+
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not begin walk update: %s", err))
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(database.UpdateWalk, id, addWalk.Title, addWalk.Description); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not update walk")
+		ctx.Abort()
+		return
+	}
+
+	if _, err := tx.Exec(database.DeleteWalkGeoPoints, id); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not clear geopoints of walk: %s", err))
+		return
+	}
+
+	c.saveWalk(ctx, tx, int(id), addWalk.GeoPoints)
+}
+
+// DeleteWalk godoc
+// @Summary delete a sound walk
+// @Description delete the walk, its geopoints are kept, restricted to its owner and the moderators
+// @Accept json
+// @Produce json
+// @Tags Walk
+// @Param id path int true "walk id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {string} string
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 403 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/walk/{id} [delete]
+func (c *Controller) DeleteWalk(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if !c.canEditWalk(ctx, id) {
+		return
+	}
+
+	if _, err := c.Db.Exec(database.DeleteWalk, id); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "walk was deleted"})
+}
+
+// canEditWalk aborts unless the walk belongs to the user or the user is a moderator
+func (c *Controller) canEditWalk(ctx *gin.Context, id uint64) bool {
+	var ownerId int
+	if err := c.Db.Get(&ownerId, database.GetWalkOwner, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get walk owner")
+		ctx.Abort()
+		return false
+	}
+
+	if ownerId != ctx.GetInt("userId") && !can(ctx, role.ModerateWalks) {
+		ctx.AbortWithError(http.StatusForbidden, errors.New("walk belongs to another user")).SetType(gin.ErrorTypePublic)
+		return false
+	}
+	return true
+}
+
+// saveWalk sets the geopoints of the walk, commits and responds with the walk
+func (c *Controller) saveWalk(ctx *gin.Context, tx *sqlx.Tx, id int, geoPoints []int64) {
+	var enabled int
+	if err := tx.Get(&enabled, database.CountEnabledGeoPoints, pq.Int64Array(geoPoints)); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not count geopoints of walk: %s", err))
+		return
+	}
+	if enabled != len(geoPoints) {
+		ctx.AbortWithError(http.StatusBadRequest, errGeoPointsNotEnabled).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	if _, err := tx.Exec(database.SetWalkGeoPoints, id, pq.Int64Array(geoPoints)); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not set geopoints of walk: %s", err))
+		return
+	}
+
+	var w walk.Walk
+	if err := tx.Get(&w, database.GetWalk, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve walk")
+		ctx.Abort()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not commit walk: %s", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, w)
+}
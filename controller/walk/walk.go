@@ -0,0 +1,75 @@
+package walk
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Walk struct {
+	Id          int           `db:"id" json:"id" example:"1"`
+	Title       string        `db:"title" json:"title" example:"Along the river"`
+	Description string        `db:"description" json:"description" example:"From the bridge to the heronry, at dawn"`
+	UserId      int           `db:"user_id" json:"userId" example:"1"`
+	CreatedOn   time.Time     `db:"created_on" json:"createdOn" example:"2022-05-26T11:17:35.079344Z"`
+	GeoPoints   pq.Int64Array `db:"geopoints" json:"geoPoints" swaggertype:"array,integer" example:"4,2,9"`
+	Length      float64       `db:"length" json:"length" example:"1543.2"`
+}
+
+type AddWalk struct {
+	Title       string  `json:"title" example:"Along the river" binding:"required,min=3,max=50"`
+	Description string  `json:"description" example:"From the bridge to the heronry, at dawn" binding:"max=1000"`
+	GeoPoints   []int64 `json:"geoPoints" example:"4,2,9" binding:"required,min=2,max=100,unique"`
+}
+
+// Stop is a geopoint of the walk at its public location
+type Stop struct {
+	Position  int     `db:"position"`
+	Id        int     `db:"id"`
+	Title     string  `db:"title"`
+	Latitude  float64 `db:"latitude"`
+	Longitude float64 `db:"longitude"`
+}
+
+type FeatureCollection struct {
+	Type     string    `json:"type" example:"FeatureCollection"`
+	Features []Feature `json:"features"`
+}
+
+type Feature struct {
+	Type       string                 `json:"type" example:"Feature"`
+	Geometry   Geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type Geometry struct {
+	Type        string      `json:"type" example:"LineString"`
+	Coordinates interface{} `json:"coordinates" swaggertype:"array,number"`
+}
+
+// GeoJson is the path of the walk followed by its stops, without the path below two stops
+func GeoJson(w Walk, stops []Stop) FeatureCollection {
+	path := make([][2]float64, 0, len(stops))
+	features := make([]Feature, 0, len(stops)+1)
+	for _, stop := range stops {
+		path = append(path, [2]float64{stop.Longitude, stop.Latitude})
+	}
+	// a LineString needs two positions, a walk left with a single enabled stop only has its Point
+	if len(path) >= 2 {
+		features = append(features, Feature{
+			Type:       "Feature",
+			Geometry:   Geometry{Type: "LineString", Coordinates: path},
+			Properties: map[string]interface{}{"id": w.Id, "title": w.Title, "length": w.Length},
+		})
+	}
+
+	for i, stop := range stops {
+		features = append(features, Feature{
+			Type:       "Feature",
+			Geometry:   Geometry{Type: "Point", Coordinates: path[i]},
+			Properties: map[string]interface{}{"id": stop.Id, "name": stop.Title, "position": stop.Position},
+		})
+	}
+
+	return FeatureCollection{Type: "FeatureCollection", Features: features}
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/cridenour/go-postgis"
+	"github.com/gin-gonic/gin"
+	"github.com/haran/biophonie-api/controller/geopoint"
+	"github.com/haran/biophonie-api/controller/zone"
+	"github.com/haran/biophonie-api/database"
+)
+
+// GetPrivacyZones godoc
+// @Summary list the privacy zones
+// @Description list the areas in which the public location of the geopoints is always coarse
+// @Accept json
+// @Produce json
+// @Tags Privacy
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {array} zone.Zone
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/zone [get]
+func (c *Controller) GetPrivacyZones(ctx *gin.Context) {
+	zones := make([]zone.Zone, 0)
+	if err := c.Db.Select(&zones, database.GetPrivacyZones); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not get privacy zones")
+		ctx.Abort()
+		return
+	}
+
+	ctx.JSON(http.StatusOK, zones)
+}
+
+// CreatePrivacyZone godoc
+// @Summary create a privacy zone
+// @Description the public location of the geopoints in the polygon, already recorded or not, becomes coarse
+// @Accept json
+// @Produce json
+// @Tags Privacy
+// @Param zone body zone.AddZone true "name and GeoJSON polygon"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {object} zone.Zone
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/zone [post]
+func (c *Controller) CreatePrivacyZone(ctx *gin.Context) {
+	var addZone zone.AddZone
+	if err := ctx.BindJSON(&addZone); err != nil {
+		return
+	}
+
+	if !addZone.Area.Valid() {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("area was not a closed polygon of longitudes and latitudes")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	area, err := json.Marshal(addZone.Area)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	tx, err := c.Db.Beginx()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not begin privacy zone creation: %s", err))
+		return
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.Get(&id, database.PostPrivacyZone, addZone.Name, string(area)); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not create privacy zone")
+		ctx.Abort()
+		return
+	}
+
+	var inZone []geopoint.DbGeoPoint
+	if err := tx.Select(&inZone, database.GetGeoPointsInPrivacyZone, id); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not get geopoints in privacy zone: %s", err))
+		return
+	}
+	for _, geoPoint := range inZone {
+		latitude, longitude := geopoint.PublicLocation(geoPoint.Location.Y, geoPoint.Location.X, geopoint.Coarse)
+		if _, err := tx.Exec(database.SetPublicLocation, geoPoint.Id, postgis.PointS{SRID: geopoint.WGS84, X: longitude, Y: latitude}); err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not generalize geopoint %d: %s", geoPoint.Id, err))
+			return
+		}
+		// the locality of the precise location would still reveal it
+		if _, err := tx.Exec(database.LocateGeoPoint, geoPoint.Id); err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not locate geopoint %d: %s", geoPoint.Id, err))
+			return
+		}
+		if err := setSolar(tx, database.GetGeoPointsForSolar, geoPoint.Id); err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	var created zone.Zone
+	if err := tx.Get(&created, database.GetPrivacyZone, id); err != nil {
+		ctx.Error(err).SetType(gin.ErrorTypeAny).SetMeta("-> could not retrieve created privacy zone")
+		ctx.Abort()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("could not commit privacy zone creation: %s", err))
+		return
+	}
+	c.refreshGeoJson()
+
+	ctx.JSON(http.StatusOK, created)
+}
+
+// DeletePrivacyZone godoc
+// @Summary delete a privacy zone
+// @Description the geopoints recorded in the zone keep their coarse public location
+// @Accept json
+// @Produce json
+// @Tags Privacy
+// @Param id path int true "zone id"
+// @Param Authorization header string true "Authentication header"
+// @Success 200 {string} string
+// @Failure 400 {object} controller.ErrMsg
+// @Failure 401 {object} controller.ErrMsg
+// @Failure 404 {object} controller.ErrMsg
+// @Failure 500 {object} controller.ErrMsg
+// @Router /restricted/zone/{id} [delete]
+func (c *Controller) DeletePrivacyZone(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	result, err := c.Db.Exec(database.DeletePrivacyZone, id)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if rowsAffected != 1 {
+		ctx.AbortWithError(http.StatusNotFound, fmt.Errorf("not found")).SetType(gin.ErrorTypePublic)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "privacy zone was deleted"})
+}
@@ -0,0 +1,39 @@
+package zone
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Zone struct {
+	Id        int             `db:"id" json:"id" example:"1"`
+	Name      string          `db:"name" json:"name" example:"Heronry of the lake"`
+	Area      json.RawMessage `db:"area" json:"area" swaggertype:"object"`
+	CreatedOn time.Time       `db:"created_on" json:"createdOn" example:"2022-05-26T11:17:35.079344Z"`
+}
+
+type AddZone struct {
+	Name string  `json:"name" example:"Heronry of the lake" binding:"required,min=3,max=50"`
+	Area Polygon `json:"area" binding:"required"`
+}
+
+// Polygon is a GeoJSON polygon, the first ring is the exterior and the others are holes
+type Polygon struct {
+	Type        string         `json:"type" example:"Polygon" binding:"required,eq=Polygon"`
+	Coordinates [][][2]float64 `json:"coordinates" swaggertype:"array,number" binding:"required,min=1,dive,min=4"`
+}
+
+// Valid checks that the rings are closed and made of longitudes and latitudes
+func (p Polygon) Valid() bool {
+	for _, ring := range p.Coordinates {
+		if ring[0] != ring[len(ring)-1] {
+			return false
+		}
+		for _, point := range ring {
+			if point[0] < -180 || point[0] > 180 || point[1] < -90 || point[1] > 90 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -9,10 +9,6 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-/*const addIndexing = `--sql
-CREATE INDEX idx_geopoints_geom ON geopoints USING gist ((location));
-`*/ //creates a gist index to help location research (to use ?)
-
 const adminKey = "admin.key"
 
 func InitDb() (*sqlx.DB, error) {
@@ -29,7 +25,9 @@ func InitDb() (*sqlx.DB, error) {
 
 	adminHash, _ := bcrypt.GenerateFromPassword(adminPassword, bcrypt.DefaultCost)
 	db.MustExec(initTables)
+	db.MustExec(migrateTables)
 	db.MustExec(createAdmin, "admin", adminHash)
+	db.MustExec(seedTemplates)
 
 	return db, nil
 }
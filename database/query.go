@@ -7,8 +7,96 @@ const (
 			name VARCHAR ( 20 ) UNIQUE NOT NULL,
 			password VARCHAR ( 60 ) UNIQUE NOT NULL,
 			admin BOOLEAN NOT NULL DEFAULT FALSE,
+			created_on TIMESTAMP NOT NULL,
+			role VARCHAR ( 20 ) NOT NULL DEFAULT 'contributor'
+		);
+		CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id serial PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES accounts ON DELETE CASCADE,
+			family UUID NOT NULL,
+			token CHAR ( 64 ) UNIQUE NOT NULL,
+			created_on TIMESTAMP NOT NULL,
+			expires_on TIMESTAMP NOT NULL,
+			used_on TIMESTAMP,
+			revoked BOOLEAN NOT NULL DEFAULT FALSE
+		);
+		CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens (family);
+		CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires ON refresh_tokens (expires_on);
+		CREATE TABLE IF NOT EXISTS sessions (
+			id UUID PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES accounts ON DELETE CASCADE,
+			device VARCHAR ( 200 ) NOT NULL DEFAULT '',
+			ip VARCHAR ( 45 ) NOT NULL DEFAULT '',
+			created_on TIMESTAMP NOT NULL,
+			last_used_on TIMESTAMP NOT NULL,
+			revoked BOOLEAN NOT NULL DEFAULT FALSE
+		);
+		CREATE TABLE IF NOT EXISTS access_tokens (
+			jti UUID PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES accounts ON DELETE CASCADE,
+			session_id UUID NOT NULL,
+			expires_on TIMESTAMP NOT NULL,
+			revoked BOOLEAN NOT NULL DEFAULT FALSE
+		);
+		CREATE INDEX IF NOT EXISTS idx_access_tokens_session ON access_tokens (session_id);
+		CREATE INDEX IF NOT EXISTS idx_access_tokens_expires ON access_tokens (expires_on);
+		CREATE TABLE IF NOT EXISTS credentials (
+			id serial PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES accounts ON DELETE CASCADE,
+			device VARCHAR ( 200 ) NOT NULL,
+			password VARCHAR ( 60 ) NOT NULL,
+			created_on TIMESTAMP NOT NULL,
+			last_used_on TIMESTAMP,
+			kind VARCHAR ( 10 ) NOT NULL DEFAULT 'device'
+		);
+		CREATE INDEX IF NOT EXISTS idx_credentials_user ON credentials (user_id);
+		CREATE TABLE IF NOT EXISTS identities (
+			id serial PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES accounts ON DELETE CASCADE,
+			issuer VARCHAR ( 200 ) NOT NULL,
+			subject VARCHAR ( 255 ) NOT NULL,
+			created_on TIMESTAMP NOT NULL,
+			last_used_on TIMESTAMP NOT NULL,
+			UNIQUE ( issuer, subject )
+		);
+		CREATE TABLE IF NOT EXISTS login_failures (
+			id serial PRIMARY KEY,
+			name VARCHAR ( 20 ) NOT NULL,
+			ip VARCHAR ( 45 ) NOT NULL,
 			created_on TIMESTAMP NOT NULL
 		);
+		CREATE INDEX IF NOT EXISTS idx_login_failures_name ON login_failures (name, created_on);
+		CREATE INDEX IF NOT EXISTS idx_login_failures_ip ON login_failures (ip, created_on);
+		CREATE TABLE IF NOT EXISTS oidc_logins (
+			state CHAR ( 64 ) PRIMARY KEY,
+			provider VARCHAR ( 50 ) NOT NULL,
+			nonce CHAR ( 32 ) NOT NULL,
+			verifier CHAR ( 64 ) NOT NULL,
+			created_on TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id serial PRIMARY KEY,
+			name VARCHAR ( 50 ) NOT NULL,
+			user_id INTEGER NOT NULL REFERENCES accounts ON DELETE CASCADE,
+			scope VARCHAR ( 12 ) NOT NULL,
+			key CHAR ( 64 ) UNIQUE NOT NULL,
+			prefix CHAR ( 8 ) NOT NULL,
+			rate_limit INTEGER NOT NULL,
+			created_by INTEGER REFERENCES accounts ON DELETE SET NULL,
+			created_on TIMESTAMP NOT NULL,
+			last_used_on TIMESTAMP,
+			revoked BOOLEAN NOT NULL DEFAULT FALSE,
+			window_start TIMESTAMP NOT NULL DEFAULT now(),
+			window_count INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS recovery_codes (
+			id serial PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES accounts ON DELETE CASCADE,
+			code CHAR ( 64 ) UNIQUE NOT NULL,
+			created_on TIMESTAMP NOT NULL,
+			expires_on TIMESTAMP NOT NULL,
+			used_on TIMESTAMP
+		);
 		CREATE TABLE IF NOT EXISTS geopoints (
 			id serial PRIMARY KEY,
 			title VARCHAR ( 30 ) NOT NULL,
@@ -16,15 +104,181 @@ const (
 			location geography ( POINT , 4326 ),
 			created_on TIMESTAMP NOT NULL,
 			amplitudes FLOAT [],
-			picture VARCHAR ( 42 ) NOT NULL,
-			sound VARCHAR ( 42 ) NOT NULL,
-			available BOOLEAN NOT NULL DEFAULT FALSE
+			picture VARCHAR ( 72 ) NOT NULL,
+			sound VARCHAR ( 72 ) NOT NULL,
+			available BOOLEAN NOT NULL DEFAULT FALSE,
+			picture_checksum VARCHAR ( 64 ) NOT NULL DEFAULT '',
+			picture_size BIGINT NOT NULL DEFAULT 0,
+			sound_checksum VARCHAR ( 64 ) NOT NULL DEFAULT '',
+			sound_size BIGINT NOT NULL DEFAULT 0,
+			sound_fingerprint BIGINT NOT NULL DEFAULT 0,
+			duplicate_of INTEGER,
+			features FLOAT [] NOT NULL DEFAULT '{}',
+			privacy VARCHAR ( 12 ) NOT NULL DEFAULT 'precise',
+			public_location geography ( POINT , 4326 ),
+			locality VARCHAR ( 200 ) NOT NULL DEFAULT '',
+			region VARCHAR ( 200 ) NOT NULL DEFAULT '',
+			country VARCHAR ( 200 ) NOT NULL DEFAULT '',
+			country_code VARCHAR ( 2 ) NOT NULL DEFAULT '',
+			timezone VARCHAR ( 40 ) NOT NULL DEFAULT '',
+			sun_elevation FLOAT NOT NULL DEFAULT 0,
+			phase VARCHAR ( 5 ) NOT NULL DEFAULT '',
+			season VARCHAR ( 6 ) NOT NULL DEFAULT '',
+			hemisphere VARCHAR ( 5 ) NOT NULL DEFAULT '',
+			month SMALLINT NOT NULL DEFAULT 0,
+			reported BOOLEAN NOT NULL DEFAULT FALSE
+		);
+		CREATE INDEX IF NOT EXISTS idx_geopoints_geom ON geopoints USING gist ((location));
+		CREATE TABLE IF NOT EXISTS privacy_zones (
+			id serial PRIMARY KEY,
+			name VARCHAR ( 50 ) NOT NULL,
+			area geography ( POLYGON , 4326 ) NOT NULL,
+			created_on TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS localities (
+			id INTEGER PRIMARY KEY,
+			name VARCHAR ( 200 ) NOT NULL,
+			region VARCHAR ( 200 ) NOT NULL,
+			country VARCHAR ( 200 ) NOT NULL,
+			country_code VARCHAR ( 2 ) NOT NULL,
+			population BIGINT NOT NULL,
+			timezone VARCHAR ( 40 ) NOT NULL DEFAULT '',
+			location geography ( POINT , 4326 ) NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_localities_geom ON localities USING gist ((location));
+		CREATE TABLE IF NOT EXISTS walks (
+			id serial PRIMARY KEY,
+			title VARCHAR ( 50 ) NOT NULL,
+			description VARCHAR ( 1000 ) NOT NULL DEFAULT '',
+			user_id INTEGER NOT NULL,
+			created_on TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS walk_geopoints (
+			walk_id INTEGER NOT NULL REFERENCES walks ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			geopoint_id INTEGER NOT NULL REFERENCES geopoints ON DELETE CASCADE,
+			PRIMARY KEY (walk_id, position)
+		);
+		CREATE TABLE IF NOT EXISTS favourites (
+			user_id INTEGER NOT NULL REFERENCES accounts ON DELETE CASCADE,
+			geopoint_id INTEGER NOT NULL REFERENCES geopoints ON DELETE CASCADE,
+			created_on TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, geopoint_id)
+		);
+		CREATE TABLE IF NOT EXISTS playlists (
+			id serial PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES accounts ON DELETE CASCADE,
+			name VARCHAR ( 50 ) NOT NULL,
+			created_on TIMESTAMP NOT NULL,
+			UNIQUE (user_id, name)
+		);
+		CREATE TABLE IF NOT EXISTS playlist_geopoints (
+			playlist_id INTEGER NOT NULL REFERENCES playlists ON DELETE CASCADE,
+			geopoint_id INTEGER NOT NULL REFERENCES geopoints ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			PRIMARY KEY (playlist_id, geopoint_id)
+		);
+		CREATE TABLE IF NOT EXISTS comments (
+			id serial PRIMARY KEY,
+			geopoint_id INTEGER NOT NULL REFERENCES geopoints ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES accounts ON DELETE CASCADE,
+			parent_id INTEGER REFERENCES comments ON DELETE CASCADE,
+			content VARCHAR ( 1000 ) NOT NULL,
+			hidden BOOLEAN NOT NULL DEFAULT FALSE,
+			created_on TIMESTAMP NOT NULL,
+			edited_on TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_comments_geopoint ON comments (geopoint_id, id);
+		CREATE TABLE IF NOT EXISTS reports (
+			id serial PRIMARY KEY,
+			geopoint_id INTEGER REFERENCES geopoints ON DELETE CASCADE,
+			account_id INTEGER REFERENCES accounts ON DELETE CASCADE,
+			reporter_id INTEGER REFERENCES accounts ON DELETE SET NULL,
+			ip VARCHAR ( 45 ) NOT NULL,
+			reason VARCHAR ( 10 ) NOT NULL,
+			details VARCHAR ( 500 ) NOT NULL DEFAULT '',
+			status VARCHAR ( 9 ) NOT NULL DEFAULT 'pending',
+			created_on TIMESTAMP NOT NULL,
+			handled_on TIMESTAMP,
+			handled_by INTEGER REFERENCES accounts ON DELETE SET NULL
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_reporter ON reports (COALESCE(geopoint_id, 0), COALESCE(account_id, 0), COALESCE(reporter_id::text, ip)) WHERE status = 'pending';
+		CREATE TABLE IF NOT EXISTS templates (
+			id serial PRIMARY KEY,
+			name VARCHAR ( 30 ) UNIQUE NOT NULL,
+			picture VARCHAR ( 42 ) UNIQUE NOT NULL,
+			retired BOOLEAN NOT NULL DEFAULT FALSE,
+			created_on TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS uploads (
+			id UUID PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			kind VARCHAR ( 10 ) NOT NULL,
+			size BIGINT NOT NULL,
+			checksum CHAR ( 64 ) NOT NULL,
+			received BIGINT NOT NULL DEFAULT 0,
+			chunks TEXT [] NOT NULL DEFAULT '{}',
+			created_on TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+			user_id INTEGER NOT NULL,
+			key VARCHAR ( 255 ) NOT NULL,
+			route VARCHAR ( 255 ) NOT NULL,
+			request_hash CHAR ( 64 ) NOT NULL,
+			claim UUID,
+			status INTEGER,
+			response JSONB,
+			created_on TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, key)
 		);
 	`
 
+	// migrateTables brings the tables created by previous versions up to date
+	migrateTables = `--sql
+		ALTER TABLE geopoints
+			ALTER COLUMN picture TYPE VARCHAR ( 72 ),
+			ALTER COLUMN sound TYPE VARCHAR ( 72 ),
+			ADD COLUMN IF NOT EXISTS picture_checksum VARCHAR ( 64 ) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS picture_size BIGINT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS sound_checksum VARCHAR ( 64 ) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS sound_size BIGINT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS sound_fingerprint BIGINT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS duplicate_of INTEGER,
+			ADD COLUMN IF NOT EXISTS features FLOAT [] NOT NULL DEFAULT '{}',
+			ADD COLUMN IF NOT EXISTS privacy VARCHAR ( 12 ) NOT NULL DEFAULT 'precise',
+			ADD COLUMN IF NOT EXISTS public_location geography ( POINT , 4326 ),
+			ADD COLUMN IF NOT EXISTS locality VARCHAR ( 200 ) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS region VARCHAR ( 200 ) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS country VARCHAR ( 200 ) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS country_code VARCHAR ( 2 ) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS timezone VARCHAR ( 40 ) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS sun_elevation FLOAT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS phase VARCHAR ( 5 ) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS season VARCHAR ( 6 ) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS hemisphere VARCHAR ( 5 ) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS month SMALLINT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS reported BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE localities
+			ADD COLUMN IF NOT EXISTS timezone VARCHAR ( 40 ) NOT NULL DEFAULT '';
+		ALTER TABLE accounts
+			ADD COLUMN IF NOT EXISTS role VARCHAR ( 20 ) NOT NULL DEFAULT 'contributor';
+		UPDATE accounts SET role = 'admin' WHERE admin = TRUE AND role = 'contributor';
+		ALTER TABLE credentials
+			ADD COLUMN IF NOT EXISTS kind VARCHAR ( 10 ) NOT NULL DEFAULT 'device';
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_credentials_chosen ON credentials (user_id) WHERE kind = 'chosen';
+		UPDATE geopoints SET public_location = location WHERE public_location IS NULL;
+	`
+
+	seedTemplates = `--sql
+		INSERT INTO templates (name, picture, created_on)
+		SELECT name, name || '.webp', now()
+		FROM UNNEST(ARRAY['clearing','desert','fields','garden','grassland','hedge','lake','mountains','potager','rainforest','temperateforest']) AS t(name)
+		ON CONFLICT DO NOTHING
+	`
+
 	createAdmin = `--sql
-		INSERT INTO accounts (name, created_on, password, admin) 
-		VALUES ($1,now(),$2,'t') 
+		INSERT INTO accounts (name, created_on, password, admin, role) 
+		VALUES ($1,now(),$2,'t','admin') 
 		ON CONFLICT DO NOTHING
 	`
 
@@ -32,18 +286,259 @@ const (
 		WITH excluded(id) AS ( SELECT UNNEST($2::int[])) 
 		SELECT geo.id FROM geopoints geo 
 		WHERE NOT EXISTS(SELECT 1 FROM excluded e WHERE geo.id = e.id) AND available = TRUE
-		ORDER BY geo.location <-> GeomFromEWKB($1)
+			AND ($3 = '' OR geo.country_code = $3)
+			AND ($4 = '' OR geo.phase = $4)
+		ORDER BY geo.public_location <-> GeomFromEWKB($1)
 		LIMIT 1;
 	`
 
+	// GetSimilarGeoPoints orders the enabled geopoints by the dot product of their features
+	// with the ones of geopoint $1, optionally within $2 meters
+	GetSimilarGeoPoints = `--sql
+		SELECT geo.id, geo.title,
+			(SELECT SUM(a * b) FROM UNNEST(geo.features, target.features) AS f(a, b)) AS similarity,
+			ST_Distance(geo.public_location, target.public_location) AS distance
+		FROM geopoints geo, geopoints target
+		WHERE target.id = $1 AND geo.id <> target.id AND geo.available = TRUE
+			AND cardinality(geo.features) = cardinality(target.features)
+			AND ($2::float IS NULL OR ST_DWithin(geo.public_location, target.public_location, $2))
+		ORDER BY similarity DESC, geo.id
+		LIMIT $3
+	`
+
+	GetGeoPointsWithoutFeatures = `--sql
+		SELECT id, amplitudes FROM geopoints WHERE cardinality(features) = 0 AND cardinality(amplitudes) > 0
+	`
+
+	SetGeoPointFeatures = `--sql
+		UPDATE geopoints SET features = $2 WHERE id = $1
+	`
+
+	GetGeoPointsWithoutFingerprint = `--sql
+		SELECT id, sound FROM geopoints WHERE sound_fingerprint = 0
+	`
+
+	SetGeoPointFingerprint = `--sql
+		UPDATE geopoints SET sound_fingerprint = $2 WHERE id = $1
+	`
+
 	GetGeoPoint = `--sql
-		SELECT * FROM geopoints WHERE id = $1
+		SELECT *, (SELECT COUNT(*) FROM favourites WHERE geopoint_id = $1) AS favourites FROM geopoints WHERE id = $1
 	`
 
 	GetUserByName = `--sql
 		SELECT * FROM accounts WHERE name = $1
 	`
 
+	// PostRefreshToken stores the hash $3 of a refresh token of family $2 valid for $4 seconds
+	PostRefreshToken = `--sql
+		INSERT INTO refresh_tokens (user_id, family, token, created_on, expires_on)
+		VALUES ($1, $2, $3, now(), now() + $4 * interval '1 second')
+	`
+
+	GetRefreshToken = `--sql
+		SELECT * FROM refresh_tokens WHERE token = $1 FOR UPDATE
+	`
+
+	UseRefreshToken = `--sql
+		UPDATE refresh_tokens SET used_on = now() WHERE id = $1
+	`
+
+	PostSession = `--sql
+		INSERT INTO sessions (id, user_id, device, ip, created_on, last_used_on)
+		VALUES ($1, $2, $3, $4, now(), now())
+	`
+
+	TouchSession = `--sql
+		UPDATE sessions SET last_used_on = now(), ip = $2 WHERE id = $1
+	`
+
+	GetSession = `--sql
+		SELECT * FROM sessions WHERE id = $1 AND user_id = $2
+	`
+
+	// GetSessions lists the sessions of user $1 which were not revoked and refreshed during the last $2 seconds
+	GetSessions = `--sql
+		SELECT * FROM sessions
+		WHERE user_id = $1 AND revoked = FALSE AND last_used_on > now() - $2 * interval '1 second'
+		ORDER BY last_used_on DESC
+	`
+
+	// RevokeSession revokes session $1 of user $2 with its refresh and access tokens
+	RevokeSession = `--sql
+		WITH s AS (
+			UPDATE sessions SET revoked = TRUE WHERE id = $1 AND user_id = $2 RETURNING id
+		), r AS (
+			UPDATE refresh_tokens SET revoked = TRUE WHERE family IN (SELECT id FROM s)
+		)
+		UPDATE access_tokens SET revoked = TRUE WHERE session_id IN (SELECT id FROM s)
+	`
+
+	// RevokeUserSessions revokes all the sessions of user $1 with their refresh and access tokens
+	RevokeUserSessions = `--sql
+		WITH s AS (
+			UPDATE sessions SET revoked = TRUE WHERE user_id = $1
+		), r AS (
+			UPDATE refresh_tokens SET revoked = TRUE WHERE user_id = $1
+		)
+		UPDATE access_tokens SET revoked = TRUE WHERE user_id = $1
+	`
+
+	// PostAccessToken records the id of an access token valid for $4 seconds so that it can be revoked
+	PostAccessToken = `--sql
+		INSERT INTO access_tokens (jti, user_id, session_id, expires_on)
+		VALUES ($1, $2, $3, now() + $4 * interval '1 second')
+	`
+
+	IsAccessTokenRevoked = `--sql
+		SELECT revoked FROM access_tokens WHERE jti = $1 AND user_id = $2
+	`
+
+	// DeleteExpiredTokens purges the expired access tokens and the expired or revoked refresh tokens
+	DeleteExpiredTokens = `--sql
+		WITH a AS (
+			DELETE FROM access_tokens WHERE expires_on < now()
+		)
+		DELETE FROM refresh_tokens WHERE expires_on < now() OR revoked = TRUE
+	`
+
+	SetPassword = `--sql
+		UPDATE accounts SET password = $2 WHERE id = $1
+	`
+
+	GetCredentials = `--sql
+		SELECT * FROM credentials WHERE user_id = $1 ORDER BY id
+	`
+
+	CountCredentials = `--sql
+		SELECT COUNT(*) FROM credentials WHERE user_id = $1 AND kind = 'device'
+	`
+
+	PostCredential = `--sql
+		INSERT INTO credentials (user_id, device, password, created_on)
+		VALUES ($1, $2, $3, now())
+		RETURNING id
+	`
+
+	// SetChosenPassword sets the password chosen by user $1, replacing the previous one
+	SetChosenPassword = `--sql
+		INSERT INTO credentials (user_id, kind, device, password, created_on)
+		VALUES ($1, 'chosen', '', $2, now())
+		ON CONFLICT (user_id) WHERE kind = 'chosen'
+		DO UPDATE SET password = EXCLUDED.password, created_on = now(), last_used_on = NULL
+		RETURNING id
+	`
+
+	GetCredential = `--sql
+		SELECT * FROM credentials WHERE id = $1 AND user_id = $2
+	`
+
+	UseCredential = `--sql
+		UPDATE credentials SET last_used_on = now() WHERE id = $1
+	`
+
+	DeleteCredential = `--sql
+		DELETE FROM credentials WHERE id = $1 AND user_id = $2
+	`
+
+	DeleteUserCredentials = `--sql
+		DELETE FROM credentials WHERE user_id = $1
+	`
+
+	// PostRecoveryCode replaces the unused recovery codes of user $1 with the hash $2 of a code valid for $3 seconds
+	PostRecoveryCode = `--sql
+		WITH d AS (
+			DELETE FROM recovery_codes WHERE user_id = $1 AND used_on IS NULL
+		)
+		INSERT INTO recovery_codes (user_id, code, created_on, expires_on)
+		VALUES ($1, $2, now(), now() + $3 * interval '1 second')
+		RETURNING expires_on
+	`
+
+	// UseRecoveryCode spends the code of hash $2 of the user named $1 unless it expired, returning the id of the user
+	UseRecoveryCode = `--sql
+		UPDATE recovery_codes SET used_on = now()
+		WHERE code = $2 AND used_on IS NULL AND expires_on > now()
+		AND user_id = (SELECT id FROM accounts WHERE name = $1)
+		RETURNING user_id
+	`
+
+	// IsLoginThrottled tells whether name $1 failed to log in $3 times or ip $2 failed $4 times during the last $5 seconds
+	IsLoginThrottled = `--sql
+		SELECT COUNT(*) FILTER (WHERE name = $1) >= $3 OR COUNT(*) FILTER (WHERE ip = $2) >= $4
+		FROM login_failures WHERE created_on > now() - $5 * interval '1 second'
+	`
+
+	// PostLoginFailure records that name $1 failed to log in from ip $2, forgetting the failures older than $3 seconds
+	PostLoginFailure = `--sql
+		WITH d AS (
+			DELETE FROM login_failures WHERE created_on < now() - $3 * interval '1 second'
+		)
+		INSERT INTO login_failures (name, ip, created_on)
+		VALUES ($1, $2, now())
+	`
+
+	// PostOidcLogin remembers the login started with state $1 at provider $2, forgetting the logins older than $5 seconds
+	PostOidcLogin = `--sql
+		WITH d AS (
+			DELETE FROM oidc_logins WHERE created_on < now() - $5 * interval '1 second'
+		)
+		INSERT INTO oidc_logins (state, provider, nonce, verifier, created_on)
+		VALUES ($1, $2, $3, $4, now())
+	`
+
+	// UseOidcLogin ends the login of state $1 at provider $2 unless it is older than $3 seconds
+	UseOidcLogin = `--sql
+		DELETE FROM oidc_logins
+		WHERE state = $1 AND provider = $2 AND created_on > now() - $3 * interval '1 second'
+		RETURNING nonce, verifier
+	`
+
+	// UseIdentity returns the account of subject $2 at issuer $1
+	UseIdentity = `--sql
+		UPDATE identities SET last_used_on = now()
+		WHERE issuer = $1 AND subject = $2
+		RETURNING user_id
+	`
+
+	PostIdentity = `--sql
+		INSERT INTO identities (user_id, issuer, subject, created_on, last_used_on)
+		VALUES ($1, $2, $3, now(), now())
+	`
+
+	IsNameTaken = `--sql
+		SELECT EXISTS (SELECT 1 FROM accounts WHERE name = $1)
+	`
+
+	PostApiKey = `--sql
+		INSERT INTO api_keys (name, user_id, scope, key, prefix, rate_limit, created_by, created_on)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, now())
+		RETURNING id
+	`
+
+	GetApiKeys = `--sql
+		SELECT * FROM api_keys ORDER BY id
+	`
+
+	GetApiKey = `--sql
+		SELECT * FROM api_keys WHERE id = $1
+	`
+
+	RevokeApiKey = `--sql
+		UPDATE api_keys SET revoked = TRUE WHERE id = $1
+	`
+
+	// UseApiKey counts a request of the key of hash $1 in its window of $2 seconds, starting a new window when it elapsed,
+	// the count stops one past the rate limit so that the rejected requests are not counted
+	UseApiKey = `--sql
+		UPDATE api_keys SET
+			last_used_on = now(),
+			window_start = CASE WHEN window_start <= now() - $2 * interval '1 second' THEN now() ELSE window_start END,
+			window_count = CASE WHEN window_start <= now() - $2 * interval '1 second' THEN 1 ELSE LEAST(window_count + 1, rate_limit + 1) END
+		WHERE key = $1 AND revoked = FALSE
+		RETURNING *
+	`
+
 	GetUserById = `--sql
 		SELECT * FROM accounts WHERE id = $1
 	`
@@ -55,11 +550,21 @@ const (
 	`
 
 	PostGeoPoint = `--sql
-		INSERT INTO geopoints (title, user_id, location, amplitudes, picture, sound, created_on) 
-		VALUES (:title,:user_id,GeomFromEWKB(:location),:amplitudes,:picture,:sound,:created_on) 
+		INSERT INTO geopoints (title, user_id, location, amplitudes, picture, sound, created_on, picture_checksum, picture_size, sound_checksum, sound_size, sound_fingerprint, duplicate_of, features, privacy, public_location, locality, region, country, country_code, timezone, sun_elevation, phase, season, hemisphere, month) 
+		VALUES (:title,:user_id,GeomFromEWKB(:location),:amplitudes,:picture,:sound,:created_on,:picture_checksum,:picture_size,:sound_checksum,:sound_size,:sound_fingerprint,:duplicate_of,:features,:privacy,GeomFromEWKB(:public_location),:locality,:region,:country,:country_code,:timezone,:sun_elevation,:phase,:season,:hemisphere,:month) 
 		RETURNING id
 	`
 
+	// GetOriginalGeoPoint finds the first geopoint with the same sound or a fingerprint
+	// differing by at most $3 bits, duplicates of duplicates point to the original
+	GetOriginalGeoPoint = `--sql
+		SELECT COALESCE(duplicate_of, id) FROM geopoints
+		WHERE sound_checksum = $1
+			OR ($2 <> 0 AND sound_fingerprint <> 0 AND length(replace((sound_fingerprint # $2)::bit(64)::text, '0', '')) <= $3)
+		ORDER BY id
+		LIMIT 1
+	`
+
 	EnableGeoPoint = `--sql
 		UPDATE geopoints SET available = TRUE WHERE id = $1 AND available = FALSE
 	`
@@ -68,8 +573,423 @@ const (
 		DELETE FROM geopoints WHERE id = $1
 	`
 
-	MakeAdmin = `--sql
-		UPDATE accounts SET admin = TRUE WHERE id = $1
+	// SetRole gives role $2 to user $1 but keeps at least one admin, the admin column follows the role
+	SetRole = `--sql
+		UPDATE accounts SET role = $2, admin = ($2 = 'admin')
+		WHERE id = $1 AND (role <> 'admin' OR $2 = 'admin' OR (SELECT COUNT(*) FROM accounts WHERE role = 'admin') > 1)
+	`
+
+	GetRole = `--sql
+		SELECT role FROM accounts WHERE id = $1
+	`
+
+	GetTemplates = `--sql
+		SELECT * FROM templates WHERE retired = FALSE ORDER BY name
+	`
+
+	GetAllTemplates = `--sql
+		SELECT * FROM templates ORDER BY id
+	`
+
+	GetTemplateById = `--sql
+		SELECT * FROM templates WHERE id = $1
+	`
+
+	GetTemplatePicture = `--sql
+		SELECT picture FROM templates WHERE name = $1 AND retired = FALSE
+	`
+
+	// LockAsset is held until the end of the transaction by the creations and deletions sharing the asset $1
+	LockAsset = `--sql
+		SELECT pg_advisory_xact_lock(hashtext($1))
+	`
+
+	CountAssetReferences = `--sql
+		SELECT (SELECT COUNT(*) FROM geopoints WHERE picture = $1 OR sound = $1) + (SELECT COUNT(*) FROM templates WHERE picture = $1)
+	`
+
+	PostTemplate = `--sql
+		INSERT INTO templates (name, picture, created_on)
+		VALUES ($1,$2,now())
+		RETURNING id
+	`
+
+	RenameTemplate = `--sql
+		UPDATE templates SET name = $2 WHERE id = $1
+	`
+
+	RetireTemplate = `--sql
+		UPDATE templates SET retired = TRUE WHERE id = $1 AND retired = FALSE
+	`
+
+	PostUpload = `--sql
+		INSERT INTO uploads (id, user_id, kind, size, checksum, created_on)
+		VALUES ($1,$2,$3,$4,$5,now())
+		RETURNING *
+	`
+
+	GetUpload = `--sql
+		SELECT * FROM uploads WHERE id = $1 AND user_id = $2 AND created_on > now() - interval '1 day'
+	`
+
+	GetExpiredUploads = `--sql
+		SELECT * FROM uploads WHERE user_id = $1 AND created_on <= now() - interval '1 day'
+	`
+
+	AppendChunk = `--sql
+		UPDATE uploads SET received = received + $3, chunks = array_append(chunks, $4)
+		WHERE id = $1 AND received = $2 AND received + $3 <= size
+		RETURNING *
+	`
+
+	DeleteUpload = `--sql
+		DELETE FROM uploads WHERE id = $1
+	`
+
+	DeleteExpiredIdempotencyKeys = `--sql
+		DELETE FROM idempotency_keys WHERE user_id = $1 AND created_on <= now() - interval '1 day'
+	`
+
+	// ClaimIdempotencyKey takes over a claim without response after $6 seconds (the request which claimed it crashed)
+	ClaimIdempotencyKey = `--sql
+		INSERT INTO idempotency_keys (user_id, key, route, request_hash, claim, created_on)
+		VALUES ($1,$2,$3,$4,$5,now())
+		ON CONFLICT (user_id, key) DO UPDATE SET route = $3, request_hash = $4, claim = $5, created_on = now()
+		WHERE idempotency_keys.status IS NULL AND idempotency_keys.created_on <= now() - $6 * interval '1 second'
+	`
+
+	GetIdempotentResponse = `--sql
+		SELECT route, request_hash, status, response FROM idempotency_keys WHERE user_id = $1 AND key = $2
+	`
+
+	SaveIdempotentResponse = `--sql
+		UPDATE idempotency_keys SET status = $4, response = $5 WHERE user_id = $1 AND key = $2 AND claim = $3
+	`
+
+	ReleaseIdempotencyKey = `--sql
+		DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND claim = $3 AND response IS NULL
+	`
+
+	InPrivacyZone = `--sql
+		SELECT EXISTS(SELECT 1 FROM privacy_zones WHERE ST_Covers(area, GeomFromEWKB($1)::geography))
+	`
+
+	GetPrivacyZones = `--sql
+		SELECT id, name, ST_AsGeoJSON(area) AS area, created_on FROM privacy_zones ORDER BY id
+	`
+
+	GetPrivacyZone = `--sql
+		SELECT id, name, ST_AsGeoJSON(area) AS area, created_on FROM privacy_zones WHERE id = $1
+	`
+
+	PostPrivacyZone = `--sql
+		INSERT INTO privacy_zones (name, area, created_on)
+		VALUES ($1,ST_GeomFromGeoJSON($2)::geography,now())
+		RETURNING id
+	`
+
+	DeletePrivacyZone = `--sql
+		DELETE FROM privacy_zones WHERE id = $1
+	`
+
+	GetGeoPointsInPrivacyZone = `--sql
+		SELECT geo.id, geo.location FROM geopoints geo, privacy_zones zone
+		WHERE zone.id = $1 AND ST_Covers(zone.area, geo.location)
+	`
+
+	SetPublicLocation = `--sql
+		UPDATE geopoints SET public_location = GeomFromEWKB($2) WHERE id = $1
+	`
+
+	GetNearestLocality = `--sql
+		SELECT name AS locality, region, country, country_code, timezone FROM localities
+		ORDER BY location <-> GeomFromEWKB($1)::geography
+		LIMIT 1
+	`
+
+	DeleteLocalities = `--sql
+		TRUNCATE TABLE localities
+	`
+
+	PostLocality = `--sql
+		INSERT INTO localities (id, name, region, country, country_code, population, timezone, location)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,ST_SetSRID(ST_MakePoint($9,$8),4326)::geography)
+	`
+
+	// LocateGeoPoints sets the nearest locality of every geopoint after an import of the gazetteer
+	LocateGeoPoints = `--sql
+		UPDATE geopoints geo SET (locality, region, country, country_code, timezone) = (
+			SELECT name, region, country, country_code, timezone FROM localities
+			ORDER BY location <-> geo.public_location
+			LIMIT 1
+		)
+		WHERE EXISTS(SELECT 1 FROM localities)
+	`
+
+	// LocateGeoPoint sets the nearest locality of geopoint $1 after its public location changed
+	LocateGeoPoint = `--sql
+		UPDATE geopoints geo SET (locality, region, country, country_code, timezone) = (
+			SELECT name, region, country, country_code, timezone FROM localities
+			ORDER BY location <-> geo.public_location
+			LIMIT 1
+		)
+		WHERE geo.id = $1 AND EXISTS(SELECT 1 FROM localities)
+	`
+
+	SearchGeoPoints = `--sql
+		SELECT id, title, ST_Y(public_location::geometry) AS latitude, ST_X(public_location::geometry) AS longitude,
+			created_on, phase, locality, country
+		FROM geopoints
+		WHERE available = TRUE
+			AND ($1 = '' OR phase = $1)
+			AND ($2 = '' OR season = $2)
+			AND ($3 = 0 OR month = $3)
+			AND ($4 = '' OR country_code = $4)
+			AND ($5::float[] IS NULL OR ST_Intersects(public_location, ST_MakeEnvelope($5[1], $5[2], $5[3], $5[4], 4326)::geography))
+		ORDER BY created_on DESC, id
+		LIMIT $6
+	`
+
+	GetGeoPointsWithoutSolar = `--sql
+		SELECT id, created_on, public_location, timezone FROM geopoints WHERE phase = ''
+	`
+
+	// GetGeoPointsForSolar lists every geopoint when $1 is null, or the geopoint $1
+	GetGeoPointsForSolar = `--sql
+		SELECT id, created_on, public_location, timezone FROM geopoints WHERE $1::int IS NULL OR id = $1
+	`
+
+	SetGeoPointSolar = `--sql
+		UPDATE geopoints SET timezone = $2, sun_elevation = $3, phase = $4, season = $5, hemisphere = $6, month = $7 WHERE id = $1
+	`
+
+	IsGeoPointAvailable = `--sql
+		SELECT available FROM geopoints WHERE id = $1
+	`
+
+	CountEnabledGeoPoints = `--sql
+		SELECT COUNT(*) FROM geopoints WHERE id = ANY($1) AND available = TRUE
+	`
+
+	// walkColumns lists the enabled geopoints of the walk in order and the length of the path between them
+	walkColumns = `
+		w.id, w.title, w.description, w.user_id, w.created_on,
+		ARRAY(
+			SELECT wg.geopoint_id FROM walk_geopoints wg JOIN geopoints geo ON geo.id = wg.geopoint_id
+			WHERE wg.walk_id = w.id AND geo.available = TRUE ORDER BY wg.position
+		) AS geopoints,
+		COALESCE((
+			SELECT ST_Length(ST_MakeLine(geo.public_location::geometry ORDER BY wg.position)::geography)
+			FROM walk_geopoints wg JOIN geopoints geo ON geo.id = wg.geopoint_id
+			WHERE wg.walk_id = w.id AND geo.available = TRUE
+		), 0) AS length`
+
+	GetWalks = `--sql
+		SELECT` + walkColumns + `
+		FROM walks w ORDER BY w.created_on DESC, w.id DESC
+	`
+
+	GetWalk = `--sql
+		SELECT` + walkColumns + `
+		FROM walks w WHERE w.id = $1
+	`
+
+	GetWalkStops = `--sql
+		SELECT wg.position, geo.id, geo.title,
+			ST_Y(geo.public_location::geometry) AS latitude, ST_X(geo.public_location::geometry) AS longitude
+		FROM walk_geopoints wg JOIN geopoints geo ON geo.id = wg.geopoint_id
+		WHERE wg.walk_id = $1 AND geo.available = TRUE
+		ORDER BY wg.position
+	`
+
+	GetWalkOwner = `--sql
+		SELECT user_id FROM walks WHERE id = $1
+	`
+
+	PostWalk = `--sql
+		INSERT INTO walks (title, description, user_id, created_on)
+		VALUES ($1,$2,$3,now())
+		RETURNING id
+	`
+
+	UpdateWalk = `--sql
+		UPDATE walks SET title = $2, description = $3 WHERE id = $1
+	`
+
+	SetWalkGeoPoints = `--sql
+		INSERT INTO walk_geopoints (walk_id, position, geopoint_id)
+		SELECT $1, t.position, t.id FROM UNNEST($2::int[]) WITH ORDINALITY AS t(id, position)
+	`
+
+	DeleteWalkGeoPoints = `--sql
+		DELETE FROM walk_geopoints WHERE walk_id = $1
+	`
+
+	DeleteWalk = `--sql
+		DELETE FROM walks WHERE id = $1
+	`
+
+	GetFavourites = `--sql
+		SELECT ARRAY(
+			SELECT f.geopoint_id FROM favourites f JOIN geopoints geo ON geo.id = f.geopoint_id
+			WHERE f.user_id = $1 AND geo.available = TRUE ORDER BY f.created_on DESC
+		) AS geopoints
+	`
+
+	PostFavourite = `--sql
+		INSERT INTO favourites (user_id, geopoint_id, created_on)
+		SELECT $1, id, now() FROM geopoints WHERE id = $2 AND available = TRUE
+		ON CONFLICT DO NOTHING
+	`
+
+	DeleteFavourite = `--sql
+		DELETE FROM favourites WHERE user_id = $1 AND geopoint_id = $2
+	`
+
+	// playlistColumns lists the enabled geopoints of the playlist in order
+	playlistColumns = `
+		p.id, p.user_id, p.name, p.created_on,
+		ARRAY(
+			SELECT pg.geopoint_id FROM playlist_geopoints pg JOIN geopoints geo ON geo.id = pg.geopoint_id
+			WHERE pg.playlist_id = p.id AND geo.available = TRUE ORDER BY pg.position
+		) AS geopoints`
+
+	GetPlaylists = `--sql
+		SELECT` + playlistColumns + `
+		FROM playlists p WHERE p.user_id = $1 ORDER BY p.name
+	`
+
+	GetPlaylist = `--sql
+		SELECT` + playlistColumns + `
+		FROM playlists p WHERE p.id = $1
+	`
+
+	GetPlaylistOwner = `--sql
+		SELECT user_id FROM playlists WHERE id = $1
+	`
+
+	PostPlaylist = `--sql
+		INSERT INTO playlists (user_id, name, created_on)
+		VALUES ($1,$2,now())
+		RETURNING id
+	`
+
+	RenamePlaylist = `--sql
+		UPDATE playlists SET name = $2 WHERE id = $1
+	`
+
+	DeletePlaylist = `--sql
+		DELETE FROM playlists WHERE id = $1
+	`
+
+	GetPlaylistGeoPoints = `--sql
+		SELECT geopoint_id FROM playlist_geopoints WHERE playlist_id = $1
+	`
+
+	// AppendToPlaylist adds the enabled geopoint at the end of the playlist
+	AppendToPlaylist = `--sql
+		INSERT INTO playlist_geopoints (playlist_id, geopoint_id, position)
+		SELECT $1, id, (SELECT COALESCE(MAX(position), 0) + 1 FROM playlist_geopoints WHERE playlist_id = $1)
+		FROM geopoints WHERE id = $2 AND available = TRUE
+	`
+
+	RemoveFromPlaylist = `--sql
+		DELETE FROM playlist_geopoints WHERE playlist_id = $1 AND geopoint_id = $2
+	`
+
+	OrderPlaylist = `--sql
+		UPDATE playlist_geopoints pg SET position = t.position
+		FROM UNNEST($2::int[]) WITH ORDINALITY AS t(id, position)
+		WHERE pg.playlist_id = $1 AND pg.geopoint_id = t.id
+	`
+
+	// GetComments pages the comments of geopoint $1 after comment $2, the hidden ones only for admins ($4)
+	GetComments = `--sql
+		SELECT com.*, acc.name AS user_name FROM comments com JOIN accounts acc ON acc.id = com.user_id
+		WHERE com.geopoint_id = $1 AND com.id > $2 AND (com.hidden = FALSE OR $4)
+		ORDER BY com.id
+		LIMIT $3
+	`
+
+	GetComment = `--sql
+		SELECT com.*, acc.name AS user_name FROM comments com JOIN accounts acc ON acc.id = com.user_id
+		WHERE com.id = $1
+	`
+
+	CountRecentComments = `--sql
+		SELECT COUNT(*) FROM comments WHERE user_id = $1 AND created_on > now() - $2 * interval '1 second'
+	`
+
+	// PostComment checks that the parent is a comment of the same geopoint
+	PostComment = `--sql
+		INSERT INTO comments (geopoint_id, user_id, parent_id, content, created_on)
+		SELECT $1, $2, $3, $4, now()
+		WHERE $3::int IS NULL OR EXISTS(SELECT 1 FROM comments WHERE id = $3 AND geopoint_id = $1)
+		RETURNING id
+	`
+
+	EditComment = `--sql
+		UPDATE comments SET content = $2, edited_on = now() WHERE id = $1
+	`
+
+	HideComment = `--sql
+		UPDATE comments SET hidden = $2 WHERE id = $1
+	`
+
+	DeleteComment = `--sql
+		DELETE FROM comments WHERE id = $1
+	`
+
+	GetGeoPointsAssets = `--sql
+		SELECT id, picture, sound FROM geopoints
+	`
+
+	GetTemplatesPictures = `--sql
+		SELECT picture FROM templates
+	`
+
+	GetUploadsIds = `--sql
+		SELECT id FROM uploads WHERE created_on > now() - interval '1 day'
+	`
+
+	GetAccountId = `--sql
+		SELECT id FROM accounts WHERE name = $1
+	`
+
+	// CountRecentReports counts the anonymous reports sent from ip $1 during the last $2 seconds
+	CountRecentReports = `--sql
+		SELECT COUNT(*) FROM reports WHERE reporter_id IS NULL AND ip = $1 AND created_on > now() - $2 * interval '1 second'
+	`
+
+	PostReport = `--sql
+		INSERT INTO reports (geopoint_id, account_id, reporter_id, ip, reason, details, created_on)
+		VALUES ($1, $2, $3, $4, $5, $6, now())
+		RETURNING id
+	`
+
+	GetReports = `--sql
+		SELECT * FROM reports WHERE status = $1 ORDER BY created_on, id
+	`
+
+	GetReport = `--sql
+		SELECT * FROM reports WHERE id = $1
+	`
+
+	HandleReport = `--sql
+		UPDATE reports SET status = $2, handled_on = now(), handled_by = $3 WHERE id = $1 AND status = 'pending'
+	`
+
+	// UpdateReported hides geopoint $1 once $2 independent reporters flagged it or an admin upheld a report,
+	// nothing is updated when the state did not change. Reporters are told apart by ip, so that an account
+	// reporting from the ip of an anonymous report counts once, and accounts younger than $3 seconds do not count
+	UpdateReported = `--sql
+		UPDATE geopoints SET reported = NOT reported
+		WHERE id = $1 AND reported <> (
+			(SELECT COUNT(DISTINCT r.ip) FROM reports r LEFT JOIN accounts a ON a.id = r.reporter_id
+				WHERE r.geopoint_id = $1 AND r.status = 'pending'
+				AND (r.reporter_id IS NULL OR a.created_on <= now() - $3 * interval '1 second')) >= $2
+			OR EXISTS(SELECT 1 FROM reports WHERE geopoint_id = $1 AND status = 'resolved')
+		)
 	`
 
 	GeosAsGeoJson = `--sql
@@ -77,11 +997,11 @@ const (
 			'type', 'FeatureCollection',
 			'features', json_agg(ST_AsGeoJSON(t.*)::json)
 			)
-		FROM (SELECT id, title, location FROM geopoints WHERE available = true) as t(id, name, geom);
+		FROM (SELECT id, title, locality, country, public_location FROM geopoints WHERE available = true AND reported = false) as t(id, name, locality, country, geom);
 	`
 
 	GeoAsFeat = `--sql
 		SELECT ST_AsGeoJSON(t.*)
-		FROM (SELECT id,title,location FROM geopoints WHERE id = $1) AS t(id, name, coordinates);
+		FROM (SELECT id,title,locality,country,public_location FROM geopoints WHERE id = $1) AS t(id, name, locality, country, coordinates);
 	`
 )
@@ -0,0 +1,107 @@
+// Package gazetteer reads the dumps of GeoNames (https://download.geonames.org/export/dump/)
+// so that geopoints can be located without calling an external API
+package gazetteer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Locality is a populated place with the names of its region and country
+type Locality struct {
+	Id          int
+	Name        string
+	Region      string
+	Country     string
+	CountryCode string
+	Population  int64
+	Timezone    string
+	Latitude    float64
+	Longitude   float64
+}
+
+const (
+	citiesColumns    = 19
+	countriesColumns = 5
+	regionsColumns   = 2
+)
+
+// Read calls fn with each locality of cities (for instance cities15000.txt), named after
+// countryInfo.txt and admin1CodesASCII.txt
+func Read(cities, countries, regions io.Reader, fn func(Locality) error) error {
+	countryNames := make(map[string]string)
+	if err := readLines(countries, countriesColumns, func(fields []string) error {
+		countryNames[fields[0]] = fields[4]
+		return nil
+	}); err != nil {
+		return fmt.Errorf("could not read countries: %s", err)
+	}
+
+	regionNames := make(map[string]string)
+	if err := readLines(regions, regionsColumns, func(fields []string) error {
+		regionNames[fields[0]] = fields[1]
+		return nil
+	}); err != nil {
+		return fmt.Errorf("could not read regions: %s", err)
+	}
+
+	if err := readLines(cities, citiesColumns, func(fields []string) error {
+		// only the populated places
+		if fields[6] != "P" {
+			return nil
+		}
+
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return err
+		}
+		latitude, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return err
+		}
+		longitude, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			return err
+		}
+		population, _ := strconv.ParseInt(fields[14], 10, 64)
+
+		return fn(Locality{
+			Id:          id,
+			Name:        fields[1],
+			Region:      regionNames[fields[8]+"."+fields[10]],
+			Country:     countryNames[fields[8]],
+			CountryCode: fields[8],
+			Population:  population,
+			Timezone:    fields[17],
+			Latitude:    latitude,
+			Longitude:   longitude,
+		})
+	}); err != nil {
+		return fmt.Errorf("could not read cities: %s", err)
+	}
+
+	return nil
+}
+
+// readLines splits the tab separated lines which are not comments
+func readLines(r io.Reader, minColumns int, fn func([]string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if scanner.Text() == "" || strings.HasPrefix(scanner.Text(), "#") {
+			continue
+		}
+
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < minColumns {
+			return fmt.Errorf("line %d has %d columns instead of %d", line, len(fields), minColumns)
+		}
+		if err := fn(fields); err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+	}
+	return scanner.Err()
+}
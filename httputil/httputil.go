@@ -1,6 +1,7 @@
 package httputil
 
 import (
+	"io"
 	"log"
 	"mime/multipart"
 
@@ -34,10 +35,14 @@ func CheckFileContentType(fileHeader *multipart.FileHeader, matcher matchers.Mat
 	}
 	defer file.Close()
 
+	return CheckContentType(file, matcher)
+}
+
+func CheckContentType(r io.Reader, matcher matchers.Matcher) bool {
 	buffer := make([]byte, 261)
 
-	_, err = file.Read(buffer)
-	if err != nil {
+	_, err := io.ReadFull(r, buffer)
+	if err != nil && err != io.ErrUnexpectedEOF {
 		return false
 	}
 
@@ -0,0 +1,260 @@
+// Package keyring holds the RSA keys signing the tokens, so that they can be rotated
+// without invalidating the tokens signed with the previous keys
+package keyring
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	privateSuffix = ".rsa"
+	publicSuffix  = ".rsa.pub"
+	sinceSuffix   = ".since"
+)
+
+// Key is identified by the name of its files, <kid>.rsa (openssl genrsa -out <kid>.rsa keysize)
+// and optionally <kid>.rsa.pub when the private key was destroyed. Since is the date of <kid>.since,
+// written by the first server loading the key unless it was deployed with the key, so that restarts
+// and replicas agree on it. The modification time of the files, which a copy may preserve, only orders
+// the keys dated together
+type Key struct {
+	Id      string
+	Private *rsa.PrivateKey
+	Public  *rsa.PublicKey
+	Since   time.Time
+
+	modified time.Time
+}
+
+// Keyring signs with the newest private key and verifies with the others until the tokens they
+// signed expired, that is retention after the newest key appeared
+type Keyring struct {
+	folder    string
+	retention time.Duration
+
+	mu      sync.RWMutex
+	keys    map[string]*Key
+	current *Key
+}
+
+// JWK is the public part of a key in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty" example:"RSA"`
+	Use string `json:"use" example:"sig"`
+	Alg string `json:"alg" example:"RS256"`
+	Kid string `json:"kid" example:"app"`
+	N   string `json:"n" example:"0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"`
+	E   string `json:"e" example:"AQAB"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKey decodes the RSA key, for instance from the JWKS of another issuer
+func (j JWK) PublicKey() (*rsa.PublicKey, error) {
+	if j.Kty != "RSA" {
+		return nil, fmt.Errorf("key %q is not an RSA key", j.Kid)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(j.N)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode modulus of key %q: %s", j.Kid, err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(j.E)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode exponent of key %q: %s", j.Kid, err)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+// New loads the keys of the folder, it must contain at least one private key
+func New(folder string, retention time.Duration) (*Keyring, error) {
+	k := &Keyring{folder: folder, retention: retention}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload reads the keys of the folder again, the previous keys are kept when they cannot be read
+func (k *Keyring) Reload() error {
+	entries, err := os.ReadDir(k.folder)
+	if err != nil {
+		return fmt.Errorf("could not read keys folder: %s", err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	keys := make(map[string]*Key)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(strings.HasSuffix(name, privateSuffix) || strings.HasSuffix(name, publicSuffix)) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("could not stat key %s: %s", name, err)
+		}
+		bytes, err := os.ReadFile(filepath.Join(k.folder, name))
+		if err != nil {
+			return fmt.Errorf("could not read key %s: %s", name, err)
+		}
+
+		id := strings.TrimSuffix(strings.TrimSuffix(name, publicSuffix), privateSuffix)
+		key, ok := keys[id]
+		if !ok {
+			key = &Key{Id: id, modified: info.ModTime()}
+			if key.Since, err = k.since(id, now); err != nil {
+				return err
+			}
+			keys[id] = key
+		}
+
+		if strings.HasSuffix(name, publicSuffix) {
+			if key.Public, err = jwt.ParseRSAPublicKeyFromPEM(bytes); err != nil {
+				return fmt.Errorf("could not parse key %s: %s", name, err)
+			}
+		} else {
+			if key.Private, err = jwt.ParseRSAPrivateKeyFromPEM(bytes); err != nil {
+				return fmt.Errorf("could not parse key %s: %s", name, err)
+			}
+			key.modified = info.ModTime()
+		}
+	}
+
+	var current *Key
+	for _, key := range sortedKeys(keys) {
+		if key.Private == nil {
+			continue
+		}
+		if key.Public == nil {
+			key.Public = &key.Private.PublicKey
+		} else if key.Public.N.Cmp(key.Private.N) != 0 {
+			return fmt.Errorf("public key of %s does not match its private key", key.Id)
+		}
+		if current == nil || key.Since.After(current.Since) ||
+			(key.Since.Equal(current.Since) && key.modified.After(current.modified)) {
+			current = key
+		}
+	}
+	if current == nil {
+		return fmt.Errorf("no private key in %s", k.folder)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.current = current
+	return nil
+}
+
+// since reads when the key was first seen, the file is linked once written so that servers loading
+// the key together do not read a partial date
+func (k *Keyring) since(id string, now time.Time) (time.Time, error) {
+	path := filepath.Join(k.folder, id+sinceSuffix)
+	if bytes, err := os.ReadFile(path); err == nil {
+		since, err := time.Parse(time.RFC3339, strings.TrimSpace(string(bytes)))
+		if err != nil {
+			return since, fmt.Errorf("could not parse date of key %s: %s", id, err)
+		}
+		return since, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, fmt.Errorf("could not read date of key %s: %s", id, err)
+	}
+
+	file, err := os.CreateTemp(k.folder, "."+id+sinceSuffix+"*")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not date key %s, write %s by hand: %s", id, path, err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(now.UTC().Format(time.RFC3339) + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not date key %s: %s", id, err)
+	}
+	if err := os.Link(file.Name(), path); errors.Is(err, os.ErrExist) {
+		return k.since(id, now)
+	} else if err != nil {
+		return time.Time{}, fmt.Errorf("could not date key %s: %s", id, err)
+	}
+	return now, nil
+}
+
+// Watch reloads the keys at each interval, for instance after a new key was added to the folder
+func (k *Keyring) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := k.Reload(); err != nil {
+			log.Printf("keyring: %s", err)
+		}
+	}
+}
+
+// Signer is the newest private key
+func (k *Keyring) Signer() (string, *rsa.PrivateKey) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current.Id, k.current.Private
+}
+
+// PublicKey returns the key verifying the tokens with the kid, unless the key expired
+func (k *Keyring) PublicKey(kid string) (*rsa.PublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[kid]
+	if !ok || key.Public == nil || !k.valid(key) {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key.Public, nil
+}
+
+// JWKS lists the keys which are still valid
+func (k *Keyring) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	jwks := JWKS{Keys: make([]JWK, 0)}
+	for _, key := range sortedKeys(k.keys) {
+		if key.Public == nil || !k.valid(key) {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: key.Id,
+			N:   base64.RawURLEncoding.EncodeToString(key.Public.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.Public.E)).Bytes()),
+		})
+	}
+	return jwks
+}
+
+// valid tells whether tokens signed with the key may not have expired yet
+func (k *Keyring) valid(key *Key) bool {
+	return key == k.current || time.Now().Before(k.current.Since.Add(k.retention))
+}
+
+func sortedKeys(keys map[string]*Key) []*Key {
+	sorted := make([]*Key, 0, len(keys))
+	for _, key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Id < sorted[j].Id })
+	return sorted
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"log"
 	"os"
 
 	"github.com/haran/biophonie-api/controller"
+	"github.com/haran/biophonie-api/controller/check"
 	_ "github.com/haran/biophonie-api/docs"
 )
 
@@ -26,9 +30,68 @@ import (
 
 func main() {
 	c := controller.NewController()
+	if len(os.Args) > 1 && os.Args[1] == "check-assets" {
+		checkAssets(c, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import-gazetteer" {
+		importGazetteer(c, os.Args[2:])
+		return
+	}
+
 	r := controller.SetupRouter(c)
 
 	if err := r.Run(":" + os.Getenv("PORT")); err != nil {
 		log.Fatalf("Stopping server: %q", err)
 	}
 }
+
+// checkAssets prints the report of the consistency check of the assets,
+// usage: biophonie-api check-assets [-action report|quarantine|remove] [-grace hours]
+func checkAssets(c *controller.Controller, args []string) {
+	flags := flag.NewFlagSet("check-assets", flag.ExitOnError)
+	action := flags.String("action", check.Report, "what to do with the orphans: report, quarantine or remove")
+	grace := flags.Int("grace", 24, "grace period in hours before an orphan can be quarantined or removed")
+	flags.Parse(args)
+
+	if *action != check.Report && *action != check.Quarantine && *action != check.Remove {
+		log.Fatalf("unknown action %q", *action)
+	}
+
+	result, err := c.CheckAssetsConsistency(context.Background(), check.Options{Action: *action, GraceHours: *grace})
+	if err != nil {
+		log.Fatalf("could not check assets: %q", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Fatalf("could not print report: %q", err)
+	}
+}
+
+// importGazetteer loads the GeoNames dumps used to locate the geopoints,
+// usage: biophonie-api import-gazetteer -cities cities15000.txt -countries countryInfo.txt -regions admin1CodesASCII.txt
+func importGazetteer(c *controller.Controller, args []string) {
+	flags := flag.NewFlagSet("import-gazetteer", flag.ExitOnError)
+	citiesPath := flags.String("cities", "cities15000.txt", "GeoNames dump of the cities")
+	countriesPath := flags.String("countries", "countryInfo.txt", "GeoNames dump of the countries")
+	regionsPath := flags.String("regions", "admin1CodesASCII.txt", "GeoNames dump of the first-order administrative divisions")
+	flags.Parse(args)
+
+	var files []*os.File
+	for _, path := range []string{*citiesPath, *countriesPath, *regionsPath} {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("could not open gazetteer: %q", err)
+		}
+		defer file.Close()
+		files = append(files, file)
+	}
+
+	count, err := c.ImportGazetteer(files[0], files[1], files[2])
+	if err != nil {
+		log.Fatalf("could not import gazetteer: %q", err)
+	}
+	log.Printf("imported %d localities", count)
+}
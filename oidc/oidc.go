@@ -0,0 +1,285 @@
+// Package oidc logs the users in with the identity providers of partner organisations,
+// following the authorization code flow of OpenID Connect with PKCE
+package oidc
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/haran/biophonie-api/keyring"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	timeout       = 10 * time.Second
+	// the keys are not fetched again for an unknown key more often than keysRefresh,
+	// so that forged tokens cannot make us hammer the provider
+	keysRefresh = time.Minute
+)
+
+// ErrVerification is returned when the provider refused the code or its id token is not valid
+var ErrVerification = errors.New("identity could not be verified")
+
+// Config of a provider as registered by the partner organisation
+type Config struct {
+	Name         string `json:"name"`
+	Issuer       string `json:"issuer"`
+	ClientId     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	RedirectUrl  string `json:"redirectUrl"`
+}
+
+// Provider discovers its endpoints and keys on first use
+type Provider struct {
+	Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]*rsa.PublicKey
+	fetchedOn time.Time
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+// Claims of the id token identifying the user
+type Claims struct {
+	*jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+	Email             string `json:"email"`
+}
+
+// Load reads the providers of the JSON file, there are none when the file does not exist
+func Load(file string) (map[string]*Provider, error) {
+	providers := make(map[string]*Provider)
+	bytes, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return providers, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read providers: %s", err)
+	}
+
+	var configs []Config
+	if err := json.Unmarshal(bytes, &configs); err != nil {
+		return nil, fmt.Errorf("could not parse providers: %s", err)
+	}
+	for _, config := range configs {
+		if config.Name == "" || config.Issuer == "" || config.ClientId == "" || config.RedirectUrl == "" {
+			return nil, fmt.Errorf("provider %q must have a name, an issuer, a client id and a redirect url", config.Name)
+		}
+		providers[config.Name] = New(config)
+	}
+	return providers, nil
+}
+
+func New(config Config) *Provider {
+	return &Provider{Config: config, client: &http.Client{Timeout: timeout}}
+}
+
+// Challenge is the S256 code challenge of the PKCE verifier
+func Challenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// AuthCodeURL is where the user logs in, the provider then redirects to the redirect url with a code and the state
+func (p *Provider) AuthCodeURL(state string, nonce string, verifier string) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientId},
+		"redirect_uri":          {p.RedirectUrl},
+		"scope":                 {"openid profile email"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades the code for an id token and verifies it was issued for us in answer to the nonce
+func (p *Provider) Exchange(code string, verifier string, nonce string) (*Claims, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectUrl},
+		"client_id":     {p.ClientId},
+		"client_secret": {p.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	response, err := p.client.PostForm(d.TokenEndpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("could not exchange code: %s", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusBadRequest || response.StatusCode == http.StatusUnauthorized {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return nil, fmt.Errorf("%w: provider refused the code: %s", ErrVerification, body)
+	} else if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not exchange code: provider answered %s", response.Status)
+	}
+
+	var tokens struct {
+		IdToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("could not decode tokens: %s", err)
+	}
+
+	claims := &Claims{RegisteredClaims: &jwt.RegisteredClaims{}}
+	if _, err := jwt.ParseWithClaims(tokens.IdToken, claims, p.verificationKey); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrVerification, err)
+	}
+	if !claims.VerifyExpiresAt(time.Now(), true) {
+		return nil, fmt.Errorf("%w: id token does not expire", ErrVerification)
+	}
+	if !claims.VerifyIssuer(d.Issuer, true) {
+		return nil, fmt.Errorf("%w: id token was issued by %q", ErrVerification, claims.Issuer)
+	}
+	if !claims.VerifyAudience(p.ClientId, true) {
+		return nil, fmt.Errorf("%w: id token was not issued for us", ErrVerification)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: id token does not answer the login", ErrVerification)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: id token has no subject", ErrVerification)
+	}
+	return claims, nil
+}
+
+// IssuerId identifies the provider in the accounts, even when it is renamed in the configuration
+func (p *Provider) IssuerId() (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	return d.Issuer, nil
+}
+
+// verificationKey finds the key of the id token, reloading the keys of the provider when it rotated them,
+// at most once per keysRefresh
+func (p *Provider) verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.findKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.fetchedOn) < keysRefresh {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if err := p.fetchKeys(); err != nil {
+		return nil, err
+	}
+	if key, ok := p.findKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// findKey must be called with the lock held
+func (p *Provider) findKey(kid string) (*rsa.PublicKey, bool) {
+	if key, ok := p.keys[kid]; ok {
+		return key, true
+	}
+	// a provider with a single key may not name it
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func (p *Provider) discover() (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	d := &discovery{}
+	if err := p.get(strings.TrimSuffix(p.Issuer, "/")+discoveryPath, d); err != nil {
+		return nil, fmt.Errorf("could not discover provider %s: %s", p.Name, err)
+	}
+	if d.Issuer != p.Issuer {
+		return nil, fmt.Errorf("provider %s announces issuer %q", p.Name, d.Issuer)
+	}
+	p.discovery = d
+	return d, nil
+}
+
+// fetchKeys must be called with the lock held, after the discovery
+func (p *Provider) fetchKeys() error {
+	p.fetchedOn = time.Now()
+	var jwks keyring.JWKS
+	if err := p.get(p.discovery.JwksUri, &jwks); err != nil {
+		return fmt.Errorf("could not get keys of provider %s: %s", p.Name, err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			return err
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	return nil
+}
+
+func (p *Provider) get(url string, v interface{}) error {
+	response, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, response.Status)
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
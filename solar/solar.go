@@ -0,0 +1,105 @@
+// Package solar places a recording in its day and year: position of the sun, phase of the day and season
+package solar
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	Night = "night"
+	Dawn  = "dawn"
+	Day   = "day"
+	Dusk  = "dusk"
+)
+
+const (
+	Winter = "winter"
+	Spring = "spring"
+	Summer = "summer"
+	Autumn = "autumn"
+)
+
+const (
+	North = "north"
+	South = "south"
+)
+
+const (
+	// the birds start singing with the nautical twilight
+	twilightElevation = -12.
+	// and the light is soft until the sun is a few degrees high
+	dayElevation = 6.
+	degree       = math.Pi / 180
+)
+
+// Position computes the elevation of the sun in degrees at t seen from the coordinates,
+// morning tells whether the sun has not passed the meridian yet
+func Position(t time.Time, latitude, longitude float64) (elevation float64, morning bool) {
+	// days since J2000.0
+	n := float64(t.UTC().UnixNano())/float64(24*time.Hour) + 2440587.5 - 2451545.0
+
+	meanLongitude := math.Mod(280.460+0.9856474*n, 360)
+	meanAnomaly := math.Mod(357.528+0.9856003*n, 360) * degree
+	eclipticLongitude := (meanLongitude + 1.915*math.Sin(meanAnomaly) + 0.020*math.Sin(2*meanAnomaly)) * degree
+	obliquity := (23.439 - 0.0000004*n) * degree
+
+	declination := math.Asin(math.Sin(obliquity) * math.Sin(eclipticLongitude))
+	rightAscension := math.Atan2(math.Cos(obliquity)*math.Sin(eclipticLongitude), math.Cos(eclipticLongitude)) / degree
+
+	siderealTime := math.Mod(18.697374558+24.06570982441908*n, 24) * 15
+	hourAngle := math.Mod(siderealTime+longitude-rightAscension, 360)
+	if hourAngle > 180 {
+		hourAngle -= 360
+	} else if hourAngle < -180 {
+		hourAngle += 360
+	}
+
+	elevation = math.Asin(math.Sin(latitude*degree)*math.Sin(declination)+
+		math.Cos(latitude*degree)*math.Cos(declination)*math.Cos(hourAngle*degree)) / degree
+	return elevation, hourAngle < 0
+}
+
+// Phase labels the moment of the day from the elevation of the sun
+func Phase(elevation float64, morning bool) string {
+	switch {
+	case elevation < twilightElevation:
+		return Night
+	case elevation >= dayElevation:
+		return Day
+	case morning:
+		return Dawn
+	default:
+		return Dusk
+	}
+}
+
+func Hemisphere(latitude float64) string {
+	if latitude < 0 {
+		return South
+	}
+	return North
+}
+
+// Season is the meteorological season of the month in the hemisphere
+func Season(month time.Month, latitude float64) string {
+	seasons := [4]string{Winter, Spring, Summer, Autumn}
+	index := int(month) % 12 / 3
+	if Hemisphere(latitude) == South {
+		index = (index + 2) % 4
+	}
+	return seasons[index]
+}
+
+// Timezone approximates the timezone from the longitude when no locality is known.
+// It ignores the borders of the timezones and the daylight saving time,
+// so the local date can be a day off near midnight: it is replaced once the gazetteer is imported.
+func Timezone(longitude float64) string {
+	offset := int(math.Round(longitude / 15))
+	if offset == 0 {
+		return "Etc/GMT"
+	}
+	// the sign of the Etc zones is inverted
+	return fmt.Sprintf("Etc/GMT%+d", -offset)
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Local stores the assets in a folder served by the api,
+// and the private ones (see Private) in a folder which is not served
+type Local struct {
+	folder        string
+	privateFolder string
+	baseUrl       string
+}
+
+func NewLocal(folder string, privateFolder string, baseUrl string) *Local {
+	return &Local{folder: folder, privateFolder: privateFolder, baseUrl: baseUrl}
+}
+
+func (l *Local) Save(ctx context.Context, key string, file io.Reader, size int64) error {
+	dst := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, file)
+	return err
+}
+
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(l.path(key))
+}
+
+func (l *Local) Remove(ctx context.Context, key string) error {
+	return os.Remove(l.path(key))
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (Object, error) {
+	info, err := os.Stat(l.path(key))
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (l *Local) Move(ctx context.Context, src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(l.path(dst)), 0750); err != nil {
+		return err
+	}
+	err := os.Rename(l.path(src), l.path(dst))
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	// the private folder can be on another device
+	file, err := os.Open(l.path(src))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := l.Save(ctx, dst, file, -1); err != nil {
+		return err
+	}
+	return os.Remove(l.path(src))
+}
+
+// List walks the folder of the prefix, a missing folder is empty
+func (l *Local) List(ctx context.Context, prefix string) ([]Object, error) {
+	root := l.root(prefix)
+	objects := make([]Object, 0)
+	err := filepath.WalkDir(l.path(prefix), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return objects, err
+}
+
+func (l *Local) URL(key string) string {
+	return joinUrl(l.baseUrl, key)
+}
+
+func (l *Local) path(key string) string {
+	return filepath.Join(l.root(key), filepath.FromSlash(key))
+}
+
+func (l *Local) root(key string) string {
+	if Private(key) {
+		return l.privateFolder
+	}
+	return l.folder
+}
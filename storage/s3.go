@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 stores the assets in a bucket of an S3-compatible object storage (AWS, MinIO...),
+// and the private ones (see Private) in a bucket which the public cannot read
+type S3 struct {
+	client        *minio.Client
+	bucket        string
+	privateBucket string
+	baseUrl       string
+}
+
+// NewS3 connects to the object storage and creates the buckets if needed, a new private bucket has no policy.
+// Without baseUrl, the assets are downloaded directly from the bucket.
+func NewS3(endpoint, accessKey, secretKey, bucket string, privateBucket string, useSSL bool, baseUrl string) (*S3, error) {
+	if endpoint == "" || bucket == "" || privateBucket == "" {
+		return nil, fmt.Errorf("s3 endpoint, bucket or private bucket is empty")
+	}
+	if bucket == privateBucket {
+		return nil, fmt.Errorf("s3 private bucket cannot be the bucket of the assets, which is public")
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create s3 client: %s", err)
+	}
+
+	ctx := context.Background()
+	for _, name := range []string{bucket, privateBucket} {
+		exists, err := client.BucketExists(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("could not check bucket %s: %s", name, err)
+		}
+		if !exists {
+			if err := client.MakeBucket(ctx, name, minio.MakeBucketOptions{}); err != nil {
+				return nil, fmt.Errorf("could not create bucket %s: %s", name, err)
+			}
+		}
+	}
+
+	if baseUrl == "" {
+		baseUrl = joinUrl(client.EndpointURL().String(), bucket)
+	}
+
+	return &S3{client: client, bucket: bucket, privateBucket: privateBucket, baseUrl: baseUrl}, nil
+}
+
+func (s *S3) Save(ctx context.Context, key string, file io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucketOf(key), key, file, size, minio.PutObjectOptions{ContentType: contentType(key)})
+	return err
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	// GetObject is lazy, stat first to report missing objects
+	if _, err := s.client.StatObject(ctx, s.bucketOf(key), key, minio.StatObjectOptions{}); err != nil {
+		return nil, s.notExist(key, err)
+	}
+	return s.client.GetObject(ctx, s.bucketOf(key), key, minio.GetObjectOptions{})
+}
+
+func (s *S3) Remove(ctx context.Context, key string) error {
+	if _, err := s.client.StatObject(ctx, s.bucketOf(key), key, minio.StatObjectOptions{}); err != nil {
+		return s.notExist(key, err)
+	}
+	return s.client.RemoveObject(ctx, s.bucketOf(key), key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (Object, error) {
+	info, err := s.client.StatObject(ctx, s.bucketOf(key), key, minio.StatObjectOptions{})
+	if err != nil {
+		return Object{}, s.notExist(key, err)
+	}
+	return Object{Key: key, Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+// Move copies the object on the server side since S3 cannot rename objects, possibly to the other bucket
+func (s *S3) Move(ctx context.Context, src string, dst string) error {
+	_, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucketOf(dst), Object: dst},
+		minio.CopySrcOptions{Bucket: s.bucketOf(src), Object: src},
+	)
+	if err != nil {
+		return s.notExist(src, err)
+	}
+	return s.client.RemoveObject(ctx, s.bucketOf(src), src, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects := make([]Object, 0)
+	for info := range s.client.ListObjects(ctx, s.bucketOf(prefix), minio.ListObjectsOptions{Prefix: prefix + "/", Recursive: true}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		objects = append(objects, Object{Key: info.Key, Size: info.Size, ModTime: info.LastModified})
+	}
+	return objects, nil
+}
+
+func (s *S3) URL(key string) string {
+	return joinUrl(s.baseUrl, key)
+}
+
+func (s *S3) bucketOf(key string) string {
+	if Private(key) {
+		return s.privateBucket
+	}
+	return s.bucket
+}
+
+// notExist converts missing objects to os.ErrNotExist to behave like the local storage
+func (s *S3) notExist(key string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return &os.PathError{Op: "open", Path: key, Err: os.ErrNotExist}
+	}
+	return err
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+type fakeObject struct {
+	content  []byte
+	modified time.Time
+}
+
+// fakeS3 serves the few path-style requests of the minio client used by S3, the signatures are not checked
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]fakeObject
+}
+
+type fakeListResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	MaxKeys     int
+	IsTruncated bool
+	Contents    []fakeListObject
+}
+
+type fakeListObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket, ok := f.buckets[names[0]]
+	if len(names) == 1 || names[1] == "" {
+		f.serveBucket(w, r, names[0], bucket, ok)
+		return
+	}
+	if !ok {
+		fakeError(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key := names[1]
+
+	switch r.Method {
+	case http.MethodPut:
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			source, _ = url.PathUnescape(source)
+			names := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+			object, ok := f.buckets[names[0]][names[1]]
+			if !ok {
+				fakeError(w, r, http.StatusNotFound, "NoSuchKey")
+				return
+			}
+			bucket[key] = fakeObject{content: object.content, modified: time.Now()}
+			fmt.Fprintf(w, `<CopyObjectResult><LastModified>%s</LastModified><ETag>"etag"</ETag></CopyObjectResult>`, time.Now().UTC().Format(time.RFC3339))
+			return
+		}
+		content, err := readFakeBody(r)
+		if err != nil {
+			fakeError(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		bucket[key] = fakeObject{content: content, modified: time.Now()}
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodHead, http.MethodGet:
+		object, ok := bucket[key]
+		if !ok {
+			fakeError(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.content)))
+		w.Header().Set("Last-Modified", object.modified.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+		if r.Method == http.MethodGet {
+			w.Write(object.content)
+		}
+	case http.MethodDelete:
+		delete(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fakeError(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) serveBucket(w http.ResponseWriter, r *http.Request, name string, bucket map[string]fakeObject, exists bool) {
+	switch {
+	case r.Method == http.MethodPut:
+		f.buckets[name] = make(map[string]fakeObject)
+	case r.URL.Query().Has("location"):
+		fmt.Fprint(w, `<LocationConstraint>us-east-1</LocationConstraint>`)
+	case !exists:
+		fakeError(w, r, http.StatusNotFound, "NoSuchBucket")
+	case r.Method == http.MethodGet:
+		prefix := r.URL.Query().Get("prefix")
+		result := fakeListResult{Name: name, Prefix: prefix, MaxKeys: 1000}
+		for key, object := range bucket {
+			if strings.HasPrefix(key, prefix) {
+				result.Contents = append(result.Contents, fakeListObject{
+					Key:          key,
+					LastModified: object.modified.UTC().Format(time.RFC3339),
+					ETag:         `"etag"`,
+					Size:         len(object.content),
+				})
+			}
+		}
+		sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+		result.KeyCount = len(result.Contents)
+		xml.NewEncoder(w).Encode(result)
+	}
+}
+
+// readFakeBody decodes the aws-chunked bodies sent by the minio client without TLS
+func readFakeBody(r *http.Request) ([]byte, error) {
+	if r.Header.Get("X-Amz-Content-Sha256") != "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		return ioutil.ReadAll(r.Body)
+	}
+
+	var content bytes.Buffer
+	reader := bufio.NewReader(r.Body)
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(strings.SplitN(header, ";", 2)[0], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return content.Bytes(), nil
+		}
+		if _, err := io.CopyN(&content, reader, size); err != nil {
+			return nil, err
+		}
+		if _, err := reader.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func fakeError(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, `<Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+	}
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{buckets: make(map[string]map[string]fakeObject)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	endpoint := strings.TrimPrefix(server.URL, "http://")
+
+	if _, err := NewS3(endpoint, "minio", "example123", "biophonie", "biophonie", false, ""); err == nil {
+		t.Error("private bucket was the public one")
+	}
+	s, err := NewS3(endpoint, "minio", "example123", "biophonie", "biophonie-private", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, true, fake.buckets["biophonie"] != nil)
+	assert.Equal(t, true, fake.buckets["biophonie-private"] != nil)
+
+	ctx := context.Background()
+	picture := PictureKey("a.webp")
+	staging := StagingKey("b5b6f0e4", picture)
+	chunk := ChunkKey("0c9d4a2e", "0")
+	for _, key := range []string{staging, chunk} {
+		if err := s.Save(ctx, key, strings.NewReader("content"), 7); err != nil {
+			t.Fatalf("could not save %s: %s", key, err)
+		}
+	}
+
+	// only the published assets are in the public bucket
+	if err := s.Move(ctx, staging, picture); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Move(ctx, chunk, QuarantineKey(chunk)); err != nil {
+		t.Fatal(err)
+	}
+	public := make([]string, 0)
+	for key := range fake.buckets["biophonie"] {
+		public = append(public, key)
+	}
+	assert.Equal(t, []string{picture}, public)
+	_, ok := fake.buckets["biophonie-private"][QuarantineKey(chunk)]
+	assert.Equal(t, true, ok)
+
+	file, err := s.Open(ctx, picture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "content", string(content))
+
+	object, err := s.Stat(ctx, picture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(7), object.Size)
+
+	quarantined, err := s.List(ctx, QuarantineFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(quarantined))
+	assert.Equal(t, QuarantineKey(chunk), quarantined[0].Key)
+
+	for _, key := range []string{staging, chunk} {
+		_, err := s.Stat(ctx, key)
+		assert.Equal(t, true, errors.Is(err, os.ErrNotExist))
+	}
+	if err := s.Remove(ctx, picture); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, true, errors.Is(s.Remove(ctx, picture), os.ErrNotExist))
+	assert.Equal(t, true, errors.Is(s.Move(ctx, staging, picture), os.ErrNotExist))
+
+	assert.Equal(t, server.URL+"/biophonie/"+picture, s.URL(picture))
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	PictureFolder    = "picture"
+	SoundFolder      = "sound"
+	UploadFolder     = "upload"
+	StagingFolder    = "staging"
+	QuarantineFolder = "quarantine"
+)
+
+// Object is a file found in the storage
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage saves the assets (pictures and sounds) and tells where clients can download them
+type Storage interface {
+	Save(ctx context.Context, key string, file io.Reader, size int64) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Remove(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (Object, error)
+	Move(ctx context.Context, src string, dst string) error
+	List(ctx context.Context, prefix string) ([]Object, error)
+	URL(key string) string
+}
+
+// New chooses the backend with the STORAGE_BACKEND environment variable (local by default)
+func New() (Storage, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "local":
+		folder := os.Getenv("ASSETS_FOLDER")
+		if folder == "" {
+			return nil, fmt.Errorf("assets path is empty")
+		}
+		privateFolder := os.Getenv("PRIVATE_ASSETS_FOLDER")
+		if privateFolder == "" {
+			return nil, fmt.Errorf("private assets path is empty")
+		}
+		if rel, err := filepath.Rel(folder, privateFolder); err != nil || !strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("private assets path cannot be in the assets path, which is served")
+		}
+		return NewLocal(folder, privateFolder, urlOrDefault("/api/v1/assets")), nil
+	case "s3":
+		return NewS3(
+			os.Getenv("S3_ENDPOINT"),
+			os.Getenv("S3_ACCESS_KEY"),
+			os.Getenv("S3_SECRET_KEY"),
+			os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_PRIVATE_BUCKET"),
+			os.Getenv("S3_USE_SSL") == "true",
+			os.Getenv("ASSETS_URL"),
+		)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+func PictureKey(name string) string {
+	return path.Join(PictureFolder, name)
+}
+
+func SoundKey(name string) string {
+	return path.Join(SoundFolder, name)
+}
+
+// ChunkKey is the key of a part of a resumable upload,
+// each attempt to send a part has its own name so that concurrent attempts do not overwrite each other
+func ChunkKey(uploadId string, name string) string {
+	return path.Join(UploadFolder, uploadId, name)
+}
+
+// StagingKey is where an asset is written before its geopoint is committed,
+// id keeps concurrent creations with identical assets apart
+func StagingKey(id string, key string) string {
+	return path.Join(StagingFolder, id, key)
+}
+
+// QuarantineKey is where an orphan asset is moved before being deleted by hand
+func QuarantineKey(key string) string {
+	return path.Join(QuarantineFolder, key)
+}
+
+// Private is true for the keys which must not be downloaded: partial uploads, staged and quarantined assets
+func Private(key string) bool {
+	switch strings.SplitN(key, "/", 2)[0] {
+	case UploadFolder, StagingFolder, QuarantineFolder:
+		return true
+	default:
+		return false
+	}
+}
+
+func urlOrDefault(defaultUrl string) string {
+	if assetsUrl := os.Getenv("ASSETS_URL"); assetsUrl != "" {
+		return assetsUrl
+	}
+	return defaultUrl
+}
+
+func joinUrl(baseUrl string, key string) string {
+	return strings.TrimSuffix(baseUrl, "/") + "/" + key
+}
+
+func contentType(key string) string {
+	if mimeType := mime.TypeByExtension(path.Ext(key)); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}